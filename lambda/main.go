@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/davidnewhall/unifi-poller/unifipoller"
+)
+
+// This is the AWS Lambda function. Build it with `make lambda`.
+func main() {
+	lambda.Start(unifipoller.NewLambdaHandler().Handle)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/davidnewhall/unifi-poller/unifipoller"
 )
@@ -9,6 +10,9 @@ import (
 // Keep it simple.
 func main() {
 	if err := unifipoller.Start(); err != nil {
+		if code, ok := err.(unifipoller.ExitCode); ok {
+			os.Exit(int(code)) // The check command already printed its status.
+		}
 		log.Fatalln("[ERROR]", err)
 	}
 }
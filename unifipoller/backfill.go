@@ -0,0 +1,313 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"github.com/spf13/pflag"
+	"golift.io/unifi"
+)
+
+// BackfillReportPath is the API path for a site's historical reports: the site
+// name, the interval (5minutes, hourly or daily) and the type (site, ap or user).
+const BackfillReportPath = "/api/s/%s/stat/report/%s.%s"
+
+const (
+	backfillBucket    = 5 * time.Minute // Presence is checked in 5 minute buckets: time(5m) below.
+	backfillBatchSize = 5000            // Points written per batch.
+)
+
+// backfillIntervals are the report intervals, and the time each report row covers.
+var backfillIntervals = map[string]time.Duration{
+	"5minutes": 5 * time.Minute,
+	"hourly":   time.Hour,
+	"daily":    24 * time.Hour,
+}
+
+// backfillAttrs are the attributes requested from each type of report.
+var backfillAttrs = map[string][]string{
+	"site": {"bytes", "wan-tx_bytes", "wan-rx_bytes", "wlan_bytes", "num_sta", "lan-num_sta", "wlan-num_sta"},
+	"ap":   {"bytes", "num_sta"},
+	"user": {"rx_bytes", "tx_bytes"},
+}
+
+// backfillLive is the measurement the poller writes while it runs, for each
+// type of report. A report row is skipped when the poller has points in its time,
+// for the same AP or user.
+var backfillLive = map[string]string{"site": "subsystems", "ap": "uap", "user": "clients"}
+
+// backfillSlot is a 5 minute bucket, in milliseconds, for one AP or user MAC.
+// The MAC is empty for site reports.
+type backfillSlot struct {
+	mac string
+	ms  int64
+}
+
+// BackfillFlags are the CLI arguments for the backfill command.
+type BackfillFlags struct {
+	Sites    []string
+	Start    string
+	End      string
+	Interval string
+	Types    []string
+	Force    bool
+}
+
+// register adds the backfill command's flags to a flag set.
+func (b *BackfillFlags) register(fs *pflag.FlagSet) {
+	fs.StringSliceVarP(&b.Sites, "site", "s", nil, "Site(s) to backfill. Default is the sites in the config file.")
+	fs.StringVar(&b.Start, "start", "24h", "Start of the range: an RFC3339 time, or a duration ago.")
+	fs.StringVar(&b.End, "end", "0s", "End of the range: an RFC3339 time, or a duration ago.")
+	fs.StringVarP(&b.Interval, "interval", "i", "hourly", "Report interval: 5minutes, hourly or daily.")
+	fs.StringSliceVarP(&b.Types, "type", "t", []string{"site", "ap"}, "Report types: site, ap and/or user.")
+	fs.BoolVarP(&b.Force, "force", "f", false, "Write every report row, even where InfluxDB already has data.")
+}
+
+// RunBackfill runs the backfill command. It reads the controller's historical
+// reports for a time range and writes them, with their original timestamps, to
+// InfluxDB and the other configured outputs, except SNMP and Datadog. Rows for
+// times InfluxDB already has data for (from the poller, or an earlier backfill)
+// are skipped.
+func (u *UnifiPoller) RunBackfill() error {
+	b := u.Flag.Backfill
+	if len(b.Sites) > 0 {
+		u.Config.Sites = b.Sites
+	}
+	step, ok := backfillIntervals[strings.ToLower(b.Interval)]
+	if !ok {
+		return fmt.Errorf("invalid interval: %s (use 5minutes, hourly or daily)", b.Interval)
+	}
+	b.Interval = strings.ToLower(b.Interval)
+	for _, t := range b.Types {
+		if backfillAttrs[t] == nil {
+			return fmt.Errorf("invalid report type: %s (use site, ap or user)", t)
+		}
+	}
+	now := time.Now()
+	start, err := parseBackfillTime(b.Start, now)
+	if err != nil {
+		return err
+	}
+	end, err := parseBackfillTime(b.End, now)
+	if err != nil {
+		return err
+	} else if !end.After(start) {
+		return fmt.Errorf("the end of the range (%v) must be after the start (%v)", end, start)
+	}
+	if err := u.GetUnifi(); err != nil {
+		return err
+	}
+	// The SNMP agent only serves the latest poll, and Datadog sends counters as
+	// the change since the previous write; old rows would break both.
+	u.Config.SNMPListen, u.Config.DatadogAPIKey = "", ""
+	if err := u.GetOutputs(); err != nil {
+		u.CloseOutputs() // The outputs created before the failure.
+		return err
+	}
+	// Flush queued writes (kafka_async) before the process exits.
+	defer u.CloseOutputs()
+	sites, err := u.GetFilteredSites()
+	if err != nil {
+		return err
+	}
+	names := u.backfillNames(sites)
+	for _, site := range sites {
+		for _, t := range b.Types {
+			if err := u.backfillReport(site, b.Interval, t, step, start, end, names); err != nil {
+				return fmt.Errorf("%s %s report for %s: %v", b.Interval, t, site.SiteName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseBackfillTime parses an RFC3339 time, or a duration before now.
+func parseBackfillTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return now, fmt.Errorf("invalid time: %s (use an RFC3339 time or a duration)", s)
+	}
+	return now.Add(-d), nil
+}
+
+// backfillNames returns the current names of devices and clients by MAC; report
+// rows only have a MAC. Errors are logged; rows are written without names.
+func (u *UnifiPoller) backfillNames(sites unifi.Sites) map[string]string {
+	names := make(map[string]string)
+	clients, err := u.Unifi.GetClients(sites)
+	u.LogError(err, "unifi.GetClients()")
+	for _, c := range clients {
+		names[strings.ToLower(c.Mac)] = firstString(c.Name, c.Hostname)
+	}
+	devices, err := u.Unifi.GetDevices(sites)
+	u.LogError(err, "unifi.GetDevices()")
+	if devices != nil {
+		for _, d := range devices.UAPs {
+			names[strings.ToLower(d.Mac)] = d.Name
+		}
+	}
+	return names
+}
+
+// backfillReport reads one report for a site and writes the rows InfluxDB does not have.
+func (u *UnifiPoller) backfillReport(site *unifi.Site, interval, typ string, step time.Duration,
+	start, end time.Time, names map[string]string) error {
+	rows, err := u.getReport(site, interval, typ, start, end)
+	if err != nil {
+		return err
+	}
+	present := make(map[backfillSlot]bool)
+	if u.Influx != nil && !u.Flag.Backfill.Force {
+		if err := u.backfillPresent(present, backfillLive[typ], "", typ, site, start, end); err != nil {
+			return err
+		}
+		if err := u.backfillPresent(present, "report_"+typ, interval, typ, site, start, end); err != nil {
+			return err
+		}
+	}
+	points := []*influx.Point{}
+	var skipped int
+	for _, row := range rows {
+		ms, _ := row["time"].(float64)
+		ts := time.Unix(0, int64(ms)*int64(time.Millisecond))
+		mac := ""
+		if typ != "site" {
+			mac, _ = row[typ].(string)
+		}
+		if backfillCovered(present, strings.ToLower(mac), ts, step) {
+			skipped++
+			continue
+		}
+		pt, err := reportPoint(site, interval, typ, ts, row, names)
+		if err != nil {
+			return err
+		} else if pt != nil {
+			points = append(points, pt)
+		}
+	}
+	for i := 0; i < len(points); i += backfillBatchSize {
+		j := i + backfillBatchSize
+		if j > len(points) {
+			j = len(points)
+		}
+		if err := u.writeBackfill(points[i:j]); err != nil {
+			return err
+		}
+	}
+	u.Logf("Backfilled %s %s report for %s: %d points written, %d rows already present",
+		interval, typ, site.SiteName, len(points), skipped)
+	return nil
+}
+
+// getReport returns a report's rows between start and end.
+func (u *UnifiPoller) getReport(site *unifi.Site, interval, typ string, start, end time.Time) ([]map[string]interface{}, error) {
+	params, err := json.Marshal(map[string]interface{}{
+		"attrs": append([]string{"time"}, backfillAttrs[typ]...),
+		"start": start.UnixNano() / int64(time.Millisecond),
+		"end":   end.UnixNano() / int64(time.Millisecond),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	err = u.Unifi.GetData(fmt.Sprintf(BackfillReportPath, site.Name, interval, typ), &response, string(params))
+	return response.Data, err
+}
+
+// backfillPresent marks the 5 minute buckets a measurement has points in for a site.
+// When interval is provided, only points with that interval tag are counted. AP
+// and user buckets are marked per mac tag; an AP that reported does not cover
+// another that was down.
+func (u *UnifiPoller) backfillPresent(present map[backfillSlot]bool, measurement, interval, typ string,
+	site *unifi.Site, start, end time.Time) error {
+	where := fmt.Sprintf(`"site_name" = '%s'`, strings.Replace(site.SiteName, `'`, `\'`, -1))
+	if interval != "" {
+		where += fmt.Sprintf(` AND "interval" = '%s'`, interval)
+	}
+	group := "time(5m)"
+	if typ != "site" {
+		group += `, "mac"`
+	}
+	q := fmt.Sprintf(`SELECT count(*) FROM "%s" WHERE %s AND time >= %dms AND time < %dms GROUP BY %s`,
+		measurement, where, start.UnixNano()/int64(time.Millisecond), end.UnixNano()/int64(time.Millisecond), group)
+	resp, err := u.Influx.Query(influx.NewQuery(q, u.Config.InfluxDB, "ms"))
+	if err == nil {
+		err = resp.Error()
+	}
+	if err != nil {
+		return fmt.Errorf("influxdb query: %v", err)
+	}
+	for _, r := range resp.Results {
+		for _, s := range r.Series {
+			mac := strings.ToLower(s.Tags["mac"])
+			for _, v := range s.Values {
+				ts, ok := v[0].(json.Number)
+				if !ok {
+					continue
+				}
+				t, _ := ts.Int64()
+				for _, c := range v[1:] {
+					if n, ok := c.(json.Number); ok && n.String() != "0" {
+						present[backfillSlot{mac: mac, ms: t}] = true
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// backfillCovered returns true if any 5 minute bucket in a report row's time has
+// points for the row's MAC.
+func backfillCovered(present map[backfillSlot]bool, mac string, ts time.Time, step time.Duration) bool {
+	for t := ts; t.Before(ts.Add(step)); t = t.Add(backfillBucket) {
+		if present[backfillSlot{mac: mac, ms: t.UnixNano() / int64(time.Millisecond)}] {
+			return true
+		}
+	}
+	return false
+}
+
+// reportPoint returns a report row as a report_<type> point. Every number in the
+// row is a field; the AP or user MAC and its current name are tags.
+func reportPoint(site *unifi.Site, interval, typ string, ts time.Time,
+	row map[string]interface{}, names map[string]string) (*influx.Point, error) {
+	tags := map[string]string{
+		"site_name": site.SiteName,
+		"interval":  interval,
+	}
+	if mac, ok := row[typ].(string); ok && typ != "site" {
+		tags["mac"] = mac
+		tags["name"] = names[strings.ToLower(mac)]
+	}
+	fields := make(map[string]interface{})
+	for k, v := range row {
+		if f, ok := v.(float64); ok && k != "time" {
+			fields[k] = f
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil // Nothing to write; a point needs a field.
+	}
+	return influx.NewPoint("report_"+typ, tags, fields, ts)
+}
+
+// writeBackfill writes a batch of points to InfluxDB and the other outputs.
+// Every destination is written to, even if another fails.
+func (u *UnifiPoller) writeBackfill(points []*influx.Point) error {
+	m := &Metrics{TS: time.Now(), Devices: &unifi.Devices{}}
+	var err error
+	if m.BatchPoints, err = influx.NewBatchPoints(influx.BatchPointsConfig{Database: u.Config.InfluxDB}); err != nil {
+		return err
+	}
+	m.AddPoints(points)
+	return u.writeMetrics(m, u.Outputs)
+}
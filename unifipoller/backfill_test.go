@@ -0,0 +1,65 @@
+package unifipoller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"golift.io/unifi"
+)
+
+func TestBackfillPresent(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.FormValue("q"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[{"statement_id":0,"series":[
+			{"name":"uap","tags":{"mac":"AA:01"},"columns":["time","count_num_sta"],"values":[[1580702400000,3],[1580702700000,0]]},
+			{"name":"uap","tags":{"mac":"aa:02"},"columns":["time","count_num_sta"],"values":[[1580703000000,1]]}]}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	client, err := influx.NewHTTPClient(influx.HTTPConfig{Addr: srv.URL})
+	if err != nil {
+		t.Fatalf("influx.NewHTTPClient: %v", err)
+	}
+	u := &UnifiPoller{Config: &Config{InfluxDB: "unifi"}, Influx: client}
+	site := &unifi.Site{Name: "default", SiteName: "Bob's (default)"}
+	start := time.Unix(1580702400, 0)
+	present := make(map[backfillSlot]bool)
+	if err := u.backfillPresent(present, "uap", "", "ap", site, start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("backfillPresent: %v", err)
+	}
+	want := `SELECT count(*) FROM "uap" WHERE "site_name" = 'Bob\'s (default)' AND time >= 1580702400000ms ` +
+		`AND time < 1580706000000ms GROUP BY time(5m), "mac"`
+	if len(queries) != 1 || queries[0] != want {
+		t.Errorf("wrong query:\n got %v\nwant %s", queries, want)
+	}
+	// An hourly row is covered by any bucket with points for the same AP.
+	for _, test := range []struct {
+		mac  string
+		ts   time.Time
+		step time.Duration
+		want bool
+	}{
+		{"aa:01", start, time.Hour, true},
+		{"aa:01", start.Add(5 * time.Minute), 5 * time.Minute, false}, // count 0.
+		{"aa:02", start, time.Hour, true},
+		{"aa:02", start, 5 * time.Minute, false},
+		{"aa:03", start, time.Hour, false},
+		{"", start, time.Hour, false},
+	} {
+		if got := backfillCovered(present, test.mac, test.ts, test.step); got != test.want {
+			t.Errorf("backfillCovered(%s, %v, %v) = %v, want %v", test.mac, test.ts, test.step, got, test.want)
+		}
+	}
+	queries = nil
+	if err := u.backfillPresent(make(map[backfillSlot]bool), "report_site", "hourly", "site", site, start, start); err != nil {
+		t.Fatalf("backfillPresent: %v", err)
+	}
+	if len(queries) != 1 || !strings.HasSuffix(queries[0], `AND "interval" = 'hourly' AND time >= 1580702400000ms AND time < 1580702400000ms GROUP BY time(5m)`) {
+		t.Errorf("site reports should not group by mac: %v", queries)
+	}
+}
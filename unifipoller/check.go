@@ -0,0 +1,339 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"github.com/spf13/pflag"
+)
+
+// Nagios plugin exit codes.
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+// checkStatus is printed before the check message.
+var checkStatus = map[int]string{
+	checkOK:       "OK",
+	checkWarning:  "WARNING",
+	checkCritical: "CRITICAL",
+	checkUnknown:  "UNKNOWN",
+}
+
+// CheckFlags are the CLI arguments for the check command.
+type CheckFlags struct {
+	Sites       []string
+	Devices     bool
+	Subsystems  []string
+	PortErrors  bool
+	StateFile   string
+	ClientsWarn int
+	ClientsCrit int
+}
+
+// ExitCode is returned by the check command when the plugin exit code is not
+// OK. The status line has already been printed; the caller exits with the code.
+type ExitCode int
+
+// Error satisfies the error interface.
+func (e ExitCode) Error() string {
+	return "check exit code " + strconv.Itoa(int(e))
+}
+
+// checkResult is the outcome of a single condition. Perfdata is already formatted.
+type checkResult struct {
+	Code     int
+	Message  string
+	Perfdata []string
+}
+
+// register adds the check command's flags to a flag set.
+func (c *CheckFlags) register(fs *pflag.FlagSet) {
+	fs.StringSliceVarP(&c.Sites, "site", "s", nil, "Site(s) to check. Default is the sites in the config file.")
+	fs.BoolVarP(&c.Devices, "devices", "d", false, "Critical if any device is not connected.")
+	fs.StringSliceVarP(&c.Subsystems, "subsystem", "S", nil,
+		"Critical if a subsystem's status is not ok; wan, lan, wlan, www or vpn. Repeatable.")
+	fs.BoolVarP(&c.PortErrors, "port-errors", "p", false, "Warning if switch port errors increased since the last check.")
+	fs.StringVar(&c.StateFile, "state-file", "",
+		"Where port error counters are stored between checks. Default is in the temp dir, per user and controller.")
+	fs.IntVarP(&c.ClientsWarn, "clients-warn", "w", 0, "Warning if any access point has this many clients or more.")
+	fs.IntVarP(&c.ClientsCrit, "clients-crit", "C", 0, "Critical if any access point has this many clients or more.")
+}
+
+// RunCheck runs the check command: a Nagios/Icinga compatible plugin. It logs into
+// the controller, collects metrics once and evaluates the requested conditions.
+// This prints a status line with perfdata, and returns an ExitCode unless it is OK.
+func (u *UnifiPoller) RunCheck() error {
+	u.Config.Quiet = true
+	u.disableCollectors()
+	if len(u.Flag.Check.Sites) > 0 {
+		u.Config.Sites = u.Flag.Check.Sites
+	}
+	if u.Flag.Check.StateFile == "" {
+		u.Flag.Check.StateFile = checkStateFile(u.Config.UnifiBase)
+	}
+	code, output := u.check()
+	fmt.Println("UNIFI " + checkStatus[code] + " - " + output)
+	if code != checkOK {
+		return ExitCode(code)
+	}
+	return nil
+}
+
+// checkStateFile returns the default state file for a controller. It is in the
+// temp dir, named for the user and controller, so checks run by other users or
+// against other controllers do not share it.
+func checkStateFile(url string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(strings.TrimRight(url, "/"))))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("unifi-poller-check-%d-%x.json", os.Getuid(), h.Sum32()))
+}
+
+// disableCollectors turns off the optional collectors. The check only reads
+// sites, devices and subsystems, so it skips the extra controller requests.
+func (u *UnifiPoller) disableCollectors() {
+	u.Config.CollectIDS = false
+	u.Config.CollectRogueAPs = false
+	u.Config.CollectTopology = false
+	u.Config.CollectPortMACs = false
+	u.Config.CollectSFP = false
+	u.Config.CollectController = false
+	u.Config.CollectConfig = false
+	u.Config.CollectFirewall = false
+	u.Config.CollectVPN = false
+	u.Config.CollectHotspot = false
+}
+
+// check collects the metrics and returns an exit code and the output line.
+func (u *UnifiPoller) check() (int, string) {
+	c := u.Flag.Check
+	if !c.Devices && len(c.Subsystems) == 0 && !c.PortErrors && c.ClientsWarn < 1 && c.ClientsCrit < 1 {
+		return checkUnknown, "no checks selected, see --help"
+	}
+	if err := u.GetUnifi(); err != nil {
+		return checkUnknown, err.Error()
+	}
+	u.LastCheck = time.Now()
+	metrics, err := u.CollectMetrics()
+	if err != nil {
+		return checkUnknown, err.Error()
+	} else if err := u.AugmentMetrics(metrics); err != nil {
+		return checkUnknown, err.Error()
+	}
+	if errs := metrics.ProcessPoints(); len(errs) > 0 {
+		return checkUnknown, errs[0].Error()
+	}
+	results := []*checkResult{}
+	if c.Devices {
+		results = append(results, checkDevices(metrics.Points()))
+	}
+	for _, s := range c.Subsystems {
+		results = append(results, checkSubsystem(metrics.Points(), strings.ToLower(s)))
+	}
+	if c.ClientsWarn > 0 || c.ClientsCrit > 0 {
+		results = append(results, checkClients(metrics.Points(), c.ClientsWarn, c.ClientsCrit))
+	}
+	if c.PortErrors {
+		results = append(results, checkPortErrors(metrics.Points(), c.StateFile))
+	}
+	return summarizeChecks(results)
+}
+
+// summarizeChecks combines all the results into one status line.
+// The worst result wins; critical is worse than unknown, which is worse than warning.
+func summarizeChecks(results []*checkResult) (int, string) {
+	rank := map[int]int{checkOK: 0, checkWarning: 1, checkUnknown: 2, checkCritical: 3}
+	code := checkOK
+	msgs, perf := []string{}, []string{}
+	for _, r := range results {
+		if rank[r.Code] > rank[code] {
+			code = r.Code
+		}
+		msgs = append(msgs, r.Message)
+		perf = append(perf, r.Perfdata...)
+	}
+	return code, strings.Join(msgs, "; ") + " | " + strings.Join(perf, " ")
+}
+
+// checkDevices returns critical if any device's state is not 1 (connected).
+// A UDM writes uap, usg and usw points; devices are counted once by mac.
+func checkDevices(points []*influx.Point) *checkResult {
+	r := &checkResult{Code: checkOK}
+	seen := make(map[string]bool)
+	down := []string{}
+	for _, p := range points {
+		if !StringInSlice(p.Name(), []string{"uap", "usg", "usw"}) || seen[p.Tags()["mac"]] {
+			continue
+		}
+		seen[p.Tags()["mac"]] = true
+		fields, _ := p.Fields()
+		if state, _ := fieldFloat(fields["state"]); state != 1 {
+			down = append(down, p.Tags()["name"])
+		}
+	}
+	total := len(seen)
+	r.Perfdata = []string{perfdata("devices_connected", float64(total-len(down)), "", 0, 0, total)}
+	if r.Message = fmt.Sprintf("%d of %d devices connected", total-len(down), total); len(down) > 0 {
+		r.Code = checkCritical
+		r.Message += ", not connected: " + strings.Join(down, ", ")
+	} else if total == 0 {
+		r.Code = checkUnknown
+		r.Message = "no devices found"
+	}
+	return r
+}
+
+// checkSubsystem returns critical if a subsystem's status is not ok on any site.
+func checkSubsystem(points []*influx.Point, subsystem string) *checkResult {
+	r := &checkResult{Code: checkUnknown, Message: "subsystem " + subsystem + " not found"}
+	bad := []string{}
+	for _, p := range points {
+		tags := p.Tags()
+		if p.Name() != "subsystems" || tags["subsystem"] != subsystem {
+			continue
+		}
+		r.Code = checkOK
+		if tags["status"] != "ok" {
+			bad = append(bad, tags["name"]+": "+tags["status"])
+		}
+		fields, _ := p.Fields()
+		for _, k := range []string{"num_user", "num_guest", "latency", "drops", "tx_bytes-r", "rx_bytes-r"} {
+			if v, ok := fieldFloat(fields[k]); ok {
+				r.Perfdata = append(r.Perfdata, perfdata(tags["name"]+"_"+subsystem+"_"+k, v, "", 0, 0, -1))
+			}
+		}
+	}
+	if len(bad) > 0 {
+		r.Code = checkCritical
+		r.Message = "subsystem " + subsystem + " status not ok: " + strings.Join(bad, ", ")
+	} else if r.Code == checkOK {
+		r.Message = "subsystem " + subsystem + " ok"
+	}
+	return r
+}
+
+// checkClients compares the client count on every access point to the thresholds.
+func checkClients(points []*influx.Point, warn, crit int) *checkResult {
+	r := &checkResult{Code: checkOK}
+	busy := []string{}
+	for _, p := range points {
+		if p.Name() != "uap" {
+			continue
+		}
+		fields, _ := p.Fields()
+		name := p.Tags()["name"]
+		count, _ := fieldFloat(fields["num_sta"])
+		r.Perfdata = append(r.Perfdata, perfdata(name+"_num_sta", count, "", warn, crit, -1))
+		switch {
+		case crit > 0 && count >= float64(crit):
+			r.Code = checkCritical
+		case warn > 0 && count >= float64(warn):
+			if r.Code == checkOK {
+				r.Code = checkWarning
+			}
+		default:
+			continue
+		}
+		busy = append(busy, fmt.Sprintf("%s: %v", name, count))
+	}
+	if r.Message = "access point client counts ok"; len(busy) > 0 {
+		r.Message = "access point client counts high: " + strings.Join(busy, ", ")
+	}
+	return r
+}
+
+// checkPortErrors compares switch port error counters to the previous check.
+// The counters are saved in a state file. The first check only saves a baseline.
+// Checks for other sites may share the state file, so their ports are kept.
+func checkPortErrors(points []*influx.Point, stateFile string) *checkResult {
+	r := &checkResult{Code: checkOK}
+	previous, current := make(map[string]float64), make(map[string]float64)
+	if b, err := ioutil.ReadFile(stateFile); err == nil {
+		_ = json.Unmarshal(b, &previous)
+	}
+	for port, count := range previous {
+		current[port] = count
+	}
+	increased := []string{}
+	var total float64
+	var compared bool
+	for _, p := range points {
+		if p.Name() != "usw_ports" {
+			continue
+		}
+		fields, _ := p.Fields()
+		port := p.Tags()["port_id"]
+		rx, _ := fieldFloat(fields["rx_errors"])
+		tx, _ := fieldFloat(fields["tx_errors"])
+		current[port] = rx + tx
+		last, ok := previous[port]
+		if compared = compared || ok; ok && current[port] > last {
+			increased = append(increased, port)
+			total += current[port] - last
+			r.Perfdata = append(r.Perfdata, perfdata(port+"_errors", current[port], "c", 0, 0, -1))
+		}
+	}
+	sort.Strings(increased)
+	r.Perfdata = append(r.Perfdata, perfdata("port_errors_increase", total, "", 0, 0, -1))
+	if b, err := json.Marshal(current); err != nil {
+		r.Code, r.Message = checkUnknown, err.Error()
+	} else if err := ioutil.WriteFile(stateFile, b, 0600); err != nil {
+		r.Code, r.Message = checkUnknown, "saving state: "+err.Error()
+	} else if len(increased) > 0 {
+		r.Code = checkWarning
+		r.Message = "switch port errors increased: " + strings.Join(increased, ", ")
+	} else if !compared {
+		r.Message = "switch port error baseline saved"
+	} else {
+		r.Message = "switch port errors not increasing"
+	}
+	return r
+}
+
+// perfdata formats a single Nagios performance data value.
+// Zero thresholds are omitted, as is max when it is less than 0.
+func perfdata(label string, value float64, uom string, warn, crit, max int) string {
+	out := fmt.Sprintf("'%s'=%s%s;", strings.Replace(label, "'", "", -1),
+		strconv.FormatFloat(value, 'f', -1, 64), uom)
+	for _, v := range []int{warn, crit} {
+		if v > 0 {
+			out += strconv.Itoa(v)
+		}
+		out += ";"
+	}
+	if out += "0;"; max >= 0 {
+		out += strconv.Itoa(max)
+	}
+	return strings.TrimRight(out, ";")
+}
+
+// fieldFloat converts an influx field value into a float64.
+func fieldFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int64:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case bool:
+		return float64(boolToInt(val)), true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,148 @@
+package unifipoller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+func TestCheckDevices(t *testing.T) {
+	// A UDM writes uap, usg and usw points with one mac; it is one device.
+	points := []*influx.Point{
+		testPoint(t, "uap", map[string]string{"mac": "aa:01", "name": "Office"}, map[string]interface{}{"state": 1}),
+		testPoint(t, "usw", map[string]string{"mac": "aa:02", "name": "Core"}, map[string]interface{}{"state": 0.0}),
+		testPoint(t, "uap", map[string]string{"mac": "aa:03", "name": "Dream"}, map[string]interface{}{"state": "1"}),
+		testPoint(t, "usg", map[string]string{"mac": "aa:03", "name": "Dream"}, map[string]interface{}{"state": "1"}),
+		testPoint(t, "usw", map[string]string{"mac": "aa:03", "name": "Dream"}, map[string]interface{}{"state": "1"}),
+		testPoint(t, "clients", map[string]string{"mac": "bb:01"}, map[string]interface{}{"state": 0}),
+	}
+	r := checkDevices(points)
+	if r.Code != checkCritical || r.Message != "2 of 3 devices connected, not connected: Core" {
+		t.Errorf("checkDevices = %d %s", r.Code, r.Message)
+	}
+	if len(r.Perfdata) != 1 || r.Perfdata[0] != "'devices_connected'=2;;;0;3" {
+		t.Errorf("wrong perfdata: %v", r.Perfdata)
+	}
+	if r := checkDevices(nil); r.Code != checkUnknown {
+		t.Errorf("no devices should be unknown: %d %s", r.Code, r.Message)
+	}
+}
+
+func TestCheckSubsystem(t *testing.T) {
+	points := []*influx.Point{
+		testPoint(t, "subsystems", map[string]string{"name": "default", "subsystem": "wan", "status": "ok"},
+			map[string]interface{}{"latency": 12, "drops": "3", "gw_name": "Gateway"}),
+		testPoint(t, "subsystems", map[string]string{"name": "lab", "subsystem": "wan", "status": "error"},
+			map[string]interface{}{"gw_name": "Lab"}),
+	}
+	r := checkSubsystem(points, "wan")
+	if r.Code != checkCritical || r.Message != "subsystem wan status not ok: lab: error" {
+		t.Errorf("checkSubsystem = %d %s", r.Code, r.Message)
+	}
+	if strings.Join(r.Perfdata, " ") != "'default_wan_latency'=12;;;0 'default_wan_drops'=3;;;0" {
+		t.Errorf("wrong perfdata: %v", r.Perfdata)
+	}
+	if r := checkSubsystem(points[:1], "wan"); r.Code != checkOK || r.Message != "subsystem wan ok" {
+		t.Errorf("checkSubsystem = %d %s", r.Code, r.Message)
+	}
+	if r := checkSubsystem(points, "vpn"); r.Code != checkUnknown {
+		t.Errorf("a missing subsystem should be unknown: %d %s", r.Code, r.Message)
+	}
+}
+
+func TestCheckClients(t *testing.T) {
+	ap := func(name string, clients int) *influx.Point {
+		return testPoint(t, "uap", map[string]string{"name": name}, map[string]interface{}{"num_sta": clients})
+	}
+	for _, test := range []struct {
+		points []*influx.Point
+		code   int
+		msg    string
+	}{
+		{[]*influx.Point{ap("Office", 5), ap("Lobby", 10)}, checkOK, "access point client counts ok"},
+		{[]*influx.Point{ap("Office", 5), ap("Lobby", 30)}, checkWarning, "access point client counts high: Lobby: 30"},
+		{[]*influx.Point{ap("Office", 50), ap("Lobby", 30)}, checkCritical, "access point client counts high: Office: 50, Lobby: 30"},
+	} {
+		if r := checkClients(test.points, 30, 50); r.Code != test.code || r.Message != test.msg {
+			t.Errorf("checkClients = %d %s, want %d %s", r.Code, r.Message, test.code, test.msg)
+		}
+	}
+	if r := checkClients([]*influx.Point{ap("Office", 5)}, 30, 50); r.Perfdata[0] != "'Office_num_sta'=5;30;50;0" {
+		t.Errorf("wrong perfdata: %v", r.Perfdata)
+	}
+}
+
+func TestCheckPortErrors(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state.json")
+	port := func(site, id string, rx, tx int) *influx.Point {
+		return testPoint(t, "usw_ports", map[string]string{"site_name": site, "port_id": id},
+			map[string]interface{}{"rx_errors": rx, "tx_errors": tx})
+	}
+	if r := checkPortErrors([]*influx.Point{port("default", "Core Port 1", 1, 1)}, state); r.Code != checkOK ||
+		r.Message != "switch port error baseline saved" {
+		t.Errorf("first check = %d %s", r.Code, r.Message)
+	}
+	// Another site's check shares the file and keeps the first site's ports.
+	if r := checkPortErrors([]*influx.Point{port("lab", "Lab Port 1", 0, 0)}, state); r.Code != checkOK {
+		t.Errorf("other site's first check = %d %s", r.Code, r.Message)
+	}
+	r := checkPortErrors([]*influx.Point{port("default", "Core Port 1", 3, 2), port("default", "Core Port 2", 9, 9)}, state)
+	if r.Code != checkWarning || r.Message != "switch port errors increased: Core Port 1" {
+		t.Errorf("second check = %d %s", r.Code, r.Message)
+	}
+	if strings.Join(r.Perfdata, " ") != "'Core Port 1_errors'=5c;;;0 'port_errors_increase'=3;;;0" {
+		t.Errorf("wrong perfdata: %v", r.Perfdata)
+	}
+	r = checkPortErrors([]*influx.Point{port("default", "Core Port 1", 3, 2)}, state)
+	if r.Code != checkOK || r.Message != "switch port errors not increasing" {
+		t.Errorf("third check = %d %s", r.Code, r.Message)
+	}
+	if r := checkPortErrors(nil, filepath.Join(state, "missing", "state.json")); r.Code != checkUnknown {
+		t.Errorf("an unwritable state file should be unknown: %d %s", r.Code, r.Message)
+	}
+}
+
+func TestSummarizeChecks(t *testing.T) {
+	code, output := summarizeChecks([]*checkResult{
+		{Code: checkWarning, Message: "warn", Perfdata: []string{"'a'=1"}},
+		{Code: checkUnknown, Message: "unknown"},
+		{Code: checkOK, Message: "ok", Perfdata: []string{"'b'=2"}},
+	})
+	if code != checkUnknown || output != "warn; unknown; ok | 'a'=1 'b'=2" {
+		t.Errorf("summarizeChecks = %d %s", code, output)
+	}
+	if code, _ := summarizeChecks([]*checkResult{{Code: checkCritical}, {Code: checkUnknown}}); code != checkCritical {
+		t.Errorf("critical should be worse than unknown: %d", code)
+	}
+}
+
+func TestPerfdata(t *testing.T) {
+	for _, test := range []struct {
+		label           string
+		value           float64
+		uom             string
+		warn, crit, max int
+		want            string
+	}{
+		{"devices", 3, "", 0, 0, 4, "'devices'=3;;;0;4"},
+		{"ap's clients", 2.5, "", 10, 20, -1, "'aps clients'=2.5;10;20;0"},
+		{"errors", 7, "c", 0, 0, -1, "'errors'=7c;;;0"},
+	} {
+		if got := perfdata(test.label, test.value, test.uom, test.warn, test.crit, test.max); got != test.want {
+			t.Errorf("perfdata(%s) = %s, want %s", test.label, got, test.want)
+		}
+	}
+}
+
+func TestCheckStateFile(t *testing.T) {
+	a, b := checkStateFile("https://unifi:8443/"), checkStateFile("https://UNIFI:8443")
+	if a != b || a == checkStateFile("https://other:8443") || filepath.Dir(a) != filepath.Clean(os.TempDir()) {
+		t.Errorf("each controller should have its own state file: %s %s", a, b)
+	}
+	if err := error(ExitCode(checkCritical)); err.Error() != "check exit code 2" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -31,6 +31,37 @@ const (
 	defaultInfluxURL  = "http://127.0.0.1:8086"
 	defaultUnifiUser  = "influx"
 	defaultUnifiURL   = "https://127.0.0.1:8443"
+	defaultFileFormat = "jsonl"
+	// Splunk HEC defaults.
+	defaultSplunkSourcetype    = "unifi:ids"
+	defaultSplunkBatchSize     = 100
+	defaultSplunkAckTimeout    = 30 * time.Second
+	defaultLokiFormat          = "logfmt"
+	defaultZabbixHost          = "unifi-poller"
+	defaultZabbixDiscovery     = 10 * time.Minute
+	defaultWebhookTimeout      = 10 * time.Second
+	defaultNATSSubject         = "unifi.{site_name}.{measurement}.{mac}"
+	defaultNATSAckTimeout      = 5 * time.Second
+	defaultSQLiteRetention     = 7 * 24 * time.Hour
+	defaultDatadogURL          = "https://api.datadoghq.com"
+	defaultDatadogNamespace    = "unifi"
+	defaultDatadogCounters     = "rate"
+	defaultCloudWatchNS        = "UniFi"
+	defaultCloudWatchBatchSize = 1000
+	defaultSNMPBaseOID         = "1.3.6.1.4.1.8072.9999.9999.77"      // netSnmpPlaypen; experimental only.
+	defaultSNMPEngineID        = "80001f8804756e6966692d706f6c6c6572" // "unifi-poller"
+	defaultSNMPAuthProto       = "SHA"
+	defaultSNMPPrivProto       = "AES"
+	defaultKafkaTopicPrefix    = "unifi."
+	defaultKafkaFormat         = "json"
+	defaultKafkaCompression    = "gzip"
+	defaultKafkaBatchSize      = 1000
+	defaultKafkaBatchTimeout   = 100 * time.Millisecond
+	defaultKafkaRequiredAcks   = 1
+	defaultOpenTSDBPrefix      = "unifi"
+	defaultOpenTSDBMaxTags     = 8
+	defaultOpenTSDBBatchSize   = 50
+	defaultConfigInventory     = time.Hour
 )
 
 // ENVConfigPrefix is the prefix appended to an env variable tag
@@ -39,12 +70,29 @@ const ENVConfigPrefix = "UP_"
 
 // UnifiPoller contains the application startup data, and auth info for UniFi & Influx.
 type UnifiPoller struct {
-	Influx     influx.Client
-	Unifi      *unifi.Unifi
-	Flag       *Flag
-	Config     *Config
-	errorCount int
-	LastCheck  time.Time
+	Influx      influx.Client
+	Unifi       *unifi.Unifi
+	Flag        *Flag
+	Config      *Config
+	Outputs     []Output
+	errorCount  int
+	onError     func(string)         // optional; receives every error passed to LogError.
+	rogueAPs    map[string]time.Time // last time each rogue AP BSSID was heard.
+	version     string               // controller version from the last poll, to notice upgrades.
+	LastCheck   time.Time
+	configs     map[string]map[string]SiteConfig // site configuration from the last poll, by site/kind and ID.
+	configTime  time.Time                        // last time the configuration inventory was written.
+	tunnels     map[string]string                // state of each VPN tunnel at the last poll, by site/ID.
+	hotspotSeen map[string]time.Time             // hotspot payments and logins already written, by site/kind/ID.
+}
+
+// Output is a destination for metrics other than InfluxDB.
+// Each configured Output is written to by ReportMetrics() every interval.
+// Close releases the output's connections, files and sockets.
+type Output interface {
+	Name() string
+	WriteMetrics(*Metrics) error
+	Close() error
 }
 
 // Flag represents the CLI args available and their settings.
@@ -52,6 +100,11 @@ type Flag struct {
 	ConfigFile string
 	DumpJSON   string
 	ShowVer    bool
+	Command    string
+	Check      *CheckFlags
+	Query      *QueryFlags
+	Topology   *TopologyFlags
+	Backfill   *BackfillFlags
 	*pflag.FlagSet
 }
 
@@ -62,6 +115,19 @@ type Metrics struct {
 	unifi.IDSList
 	unifi.Clients
 	*unifi.Devices
+	RogueAPs    []*RogueAP
+	DeviceLinks []*DeviceLinks
+	PortMACs    []*SwitchMACTable
+	SFPModules  []*SFPModules
+	Controller  *ControllerInfo
+	SiteConfigs []*SiteConfigs
+	Firewall    []*SiteConfigs
+	Forwards    []*PortForward
+	Routes      []*Route
+	VPNTunnels  []*VPNTunnel
+	VPNUsers    []*RemoteUserSession
+	Hotspots    []*Hotspot
+	Events      []*Event
 	influx.BatchPoints
 }
 
@@ -69,22 +135,112 @@ type Metrics struct {
 // This is all of the data stored in the config file.
 // Any with explicit defaults have _omitempty on json and toml tags.
 type Config struct {
-	MaxErrors  int      `json:"max_errors" toml:"max_errors" xml:"max_errors" yaml:"max_errors" env:"MAX_ERRORS"`
-	Interval   Duration `json:"interval,_omitempty" toml:"interval,_omitempty" xml:"interval" yaml:"interval" env:"POLLING_INTERVAL"`
-	Debug      bool     `json:"debug" toml:"debug" xml:"debug" yaml:"debug" env:"DEBUG_MODE"`
-	Quiet      bool     `json:"quiet,_omitempty" toml:"quiet,_omitempty" xml:"quiet" yaml:"quiet" env:"QUIET_MODE"`
-	VerifySSL  bool     `json:"verify_ssl" toml:"verify_ssl" xml:"verify_ssl" yaml:"verify_ssl" env:"VERIFY_SSL"`
-	CollectIDS bool     `json:"collect_ids" toml:"collect_ids" xml:"collect_ids" yaml:"collect_ids" env:"COLLECT_IDS"`
-	ReAuth     bool     `json:"reauthenticate" toml:"reauthenticate" xml:"reauthenticate" yaml:"reauthenticate" env:"REAUTHENTICATE"`
-	Mode       string   `json:"mode" toml:"mode" xml:"mode" yaml:"mode" env:"POLLING_MODE"`
-	InfluxURL  string   `json:"influx_url,_omitempty" toml:"influx_url,_omitempty" xml:"influx_url" yaml:"influx_url" env:"INFLUX_URL"`
-	InfluxUser string   `json:"influx_user,_omitempty" toml:"influx_user,_omitempty" xml:"influx_user" yaml:"influx_user" env:"INFLUX_USER"`
-	InfluxPass string   `json:"influx_pass,_omitempty" toml:"influx_pass,_omitempty" xml:"influx_pass" yaml:"influx_pass" env:"INFLUX_PASS"`
-	InfluxDB   string   `json:"influx_db,_omitempty" toml:"influx_db,_omitempty" xml:"influx_db" yaml:"influx_db" env:"INFLUX_DB"`
-	UnifiUser  string   `json:"unifi_user,_omitempty" toml:"unifi_user,_omitempty" xml:"unifi_user" yaml:"unifi_user" env:"UNIFI_USER"`
-	UnifiPass  string   `json:"unifi_pass,_omitempty" toml:"unifi_pass,_omitempty" xml:"unifi_pass" yaml:"unifi_pass" env:"UNIFI_PASS"`
-	UnifiBase  string   `json:"unifi_url,_omitempty" toml:"unifi_url,_omitempty" xml:"unifi_url" yaml:"unifi_url" env:"UNIFI_URL"`
-	Sites      []string `json:"sites,_omitempty" toml:"sites,_omitempty" xml:"sites" yaml:"sites" env:"POLL_SITES"`
+	MaxErrors               int              `json:"max_errors" toml:"max_errors" xml:"max_errors" yaml:"max_errors" env:"MAX_ERRORS"`
+	Interval                Duration         `json:"interval,_omitempty" toml:"interval,_omitempty" xml:"interval" yaml:"interval" env:"POLLING_INTERVAL"`
+	Debug                   bool             `json:"debug" toml:"debug" xml:"debug" yaml:"debug" env:"DEBUG_MODE"`
+	Quiet                   bool             `json:"quiet,_omitempty" toml:"quiet,_omitempty" xml:"quiet" yaml:"quiet" env:"QUIET_MODE"`
+	VerifySSL               bool             `json:"verify_ssl" toml:"verify_ssl" xml:"verify_ssl" yaml:"verify_ssl" env:"VERIFY_SSL"`
+	CollectIDS              bool             `json:"collect_ids" toml:"collect_ids" xml:"collect_ids" yaml:"collect_ids" env:"COLLECT_IDS"`
+	CollectRogueAPs         bool             `json:"collect_rogue_aps" toml:"collect_rogue_aps" xml:"collect_rogue_aps" yaml:"collect_rogue_aps" env:"COLLECT_ROGUE_APS"`
+	CollectTopology         bool             `json:"collect_topology" toml:"collect_topology" xml:"collect_topology" yaml:"collect_topology" env:"COLLECT_TOPOLOGY"`
+	CollectPortMACs         bool             `json:"collect_port_macs" toml:"collect_port_macs" xml:"collect_port_macs" yaml:"collect_port_macs" env:"COLLECT_PORT_MACS"`
+	PortMACUplinks          bool             `json:"port_mac_uplinks" toml:"port_mac_uplinks" xml:"port_mac_uplinks" yaml:"port_mac_uplinks" env:"PORT_MAC_UPLINKS"`
+	CollectSFP              bool             `json:"collect_sfp" toml:"collect_sfp" xml:"collect_sfp" yaml:"collect_sfp" env:"COLLECT_SFP"`
+	CollectController       bool             `json:"collect_controller" toml:"collect_controller" xml:"collect_controller" yaml:"collect_controller" env:"COLLECT_CONTROLLER"`
+	CollectConfig           bool             `json:"collect_config" toml:"collect_config" xml:"collect_config" yaml:"collect_config" env:"COLLECT_CONFIG"`
+	ConfigInventoryInterval Duration         `json:"config_inventory_interval,_omitempty" toml:"config_inventory_interval,_omitempty" xml:"config_inventory_interval" yaml:"config_inventory_interval" env:"CONFIG_INVENTORY_INTERVAL"`
+	ConfigSnapshotDir       string           `json:"config_snapshot_dir" toml:"config_snapshot_dir" xml:"config_snapshot_dir" yaml:"config_snapshot_dir" env:"CONFIG_SNAPSHOT_DIR"`
+	CollectFirewall         bool             `json:"collect_firewall" toml:"collect_firewall" xml:"collect_firewall" yaml:"collect_firewall" env:"COLLECT_FIREWALL"`
+	CollectVPN              bool             `json:"collect_vpn" toml:"collect_vpn" xml:"collect_vpn" yaml:"collect_vpn" env:"COLLECT_VPN"`
+	CollectHotspot          bool             `json:"collect_hotspot" toml:"collect_hotspot" xml:"collect_hotspot" yaml:"collect_hotspot" env:"COLLECT_HOTSPOT"`
+	ReAuth                  bool             `json:"reauthenticate" toml:"reauthenticate" xml:"reauthenticate" yaml:"reauthenticate" env:"REAUTHENTICATE"`
+	Mode                    string           `json:"mode" toml:"mode" xml:"mode" yaml:"mode" env:"POLLING_MODE"`
+	InfluxURL               string           `json:"influx_url,_omitempty" toml:"influx_url,_omitempty" xml:"influx_url" yaml:"influx_url" env:"INFLUX_URL"`
+	InfluxUser              string           `json:"influx_user,_omitempty" toml:"influx_user,_omitempty" xml:"influx_user" yaml:"influx_user" env:"INFLUX_USER"`
+	InfluxPass              string           `json:"influx_pass,_omitempty" toml:"influx_pass,_omitempty" xml:"influx_pass" yaml:"influx_pass" env:"INFLUX_PASS"`
+	InfluxDB                string           `json:"influx_db,_omitempty" toml:"influx_db,_omitempty" xml:"influx_db" yaml:"influx_db" env:"INFLUX_DB"`
+	UnifiUser               string           `json:"unifi_user,_omitempty" toml:"unifi_user,_omitempty" xml:"unifi_user" yaml:"unifi_user" env:"UNIFI_USER"`
+	UnifiPass               string           `json:"unifi_pass,_omitempty" toml:"unifi_pass,_omitempty" xml:"unifi_pass" yaml:"unifi_pass" env:"UNIFI_PASS"`
+	UnifiBase               string           `json:"unifi_url,_omitempty" toml:"unifi_url,_omitempty" xml:"unifi_url" yaml:"unifi_url" env:"UNIFI_URL"`
+	Sites                   []string         `json:"sites,_omitempty" toml:"sites,_omitempty" xml:"sites" yaml:"sites" env:"POLL_SITES"`
+	NoInflux                bool             `json:"disable_influxdb" toml:"disable_influxdb" xml:"disable_influxdb" yaml:"disable_influxdb" env:"DISABLE_INFLUXDB"`
+	FilePath                string           `json:"file_path" toml:"file_path" xml:"file_path" yaml:"file_path" env:"FILE_PATH"`
+	FileFormat              string           `json:"file_format,_omitempty" toml:"file_format,_omitempty" xml:"file_format" yaml:"file_format" env:"FILE_FORMAT"`
+	FileGzip                bool             `json:"file_gzip" toml:"file_gzip" xml:"file_gzip" yaml:"file_gzip" env:"FILE_GZIP"`
+	FileRetain              int              `json:"file_retain" toml:"file_retain" xml:"file_retain" yaml:"file_retain" env:"FILE_RETAIN"`
+	FileRotateSize          int              `json:"file_rotate_size" toml:"file_rotate_size" xml:"file_rotate_size" yaml:"file_rotate_size" env:"FILE_ROTATE_SIZE"`
+	FileRotateAge           Duration         `json:"file_rotate_age" toml:"file_rotate_age" xml:"file_rotate_age" yaml:"file_rotate_age" env:"FILE_ROTATE_AGE"`
+	SplunkURL               string           `json:"splunk_url" toml:"splunk_url" xml:"splunk_url" yaml:"splunk_url" env:"SPLUNK_URL"`
+	SplunkToken             string           `json:"splunk_token" toml:"splunk_token" xml:"splunk_token" yaml:"splunk_token" env:"SPLUNK_TOKEN"`
+	SplunkIndex             string           `json:"splunk_index" toml:"splunk_index" xml:"splunk_index" yaml:"splunk_index" env:"SPLUNK_INDEX"`
+	SplunkMetricsIndex      string           `json:"splunk_metrics_index" toml:"splunk_metrics_index" xml:"splunk_metrics_index" yaml:"splunk_metrics_index" env:"SPLUNK_METRICS_INDEX"`
+	SplunkSourcetype        string           `json:"splunk_sourcetype,_omitempty" toml:"splunk_sourcetype,_omitempty" xml:"splunk_sourcetype" yaml:"splunk_sourcetype" env:"SPLUNK_SOURCETYPE"`
+	SplunkVerifySSL         bool             `json:"splunk_verify_ssl" toml:"splunk_verify_ssl" xml:"splunk_verify_ssl" yaml:"splunk_verify_ssl" env:"SPLUNK_VERIFY_SSL"`
+	SplunkCAFile            string           `json:"splunk_ca_file" toml:"splunk_ca_file" xml:"splunk_ca_file" yaml:"splunk_ca_file" env:"SPLUNK_CA_FILE"`
+	SplunkBatchSize         int              `json:"splunk_batch_size,_omitempty" toml:"splunk_batch_size,_omitempty" xml:"splunk_batch_size" yaml:"splunk_batch_size" env:"SPLUNK_BATCH_SIZE"`
+	SplunkAck               bool             `json:"splunk_ack" toml:"splunk_ack" xml:"splunk_ack" yaml:"splunk_ack" env:"SPLUNK_ACK"`
+	SplunkAckTimeout        Duration         `json:"splunk_ack_timeout,_omitempty" toml:"splunk_ack_timeout,_omitempty" xml:"splunk_ack_timeout" yaml:"splunk_ack_timeout" env:"SPLUNK_ACK_TIMEOUT"`
+	LokiURL                 string           `json:"loki_url" toml:"loki_url" xml:"loki_url" yaml:"loki_url" env:"LOKI_URL"`
+	LokiUser                string           `json:"loki_user" toml:"loki_user" xml:"loki_user" yaml:"loki_user" env:"LOKI_USER"`
+	LokiPass                string           `json:"loki_pass" toml:"loki_pass" xml:"loki_pass" yaml:"loki_pass" env:"LOKI_PASS"`
+	LokiTenantID            string           `json:"loki_tenant_id" toml:"loki_tenant_id" xml:"loki_tenant_id" yaml:"loki_tenant_id" env:"LOKI_TENANT_ID"`
+	LokiFormat              string           `json:"loki_format,_omitempty" toml:"loki_format,_omitempty" xml:"loki_format" yaml:"loki_format" env:"LOKI_FORMAT"`
+	LokiVerifySSL           bool             `json:"loki_verify_ssl" toml:"loki_verify_ssl" xml:"loki_verify_ssl" yaml:"loki_verify_ssl" env:"LOKI_VERIFY_SSL"`
+	ZabbixServer            string           `json:"zabbix_server" toml:"zabbix_server" xml:"zabbix_server" yaml:"zabbix_server" env:"ZABBIX_SERVER"`
+	ZabbixHost              string           `json:"zabbix_host,_omitempty" toml:"zabbix_host,_omitempty" xml:"zabbix_host" yaml:"zabbix_host" env:"ZABBIX_HOST"`
+	ZabbixDiscoveryInterval Duration         `json:"zabbix_discovery_interval,_omitempty" toml:"zabbix_discovery_interval,_omitempty" xml:"zabbix_discovery_interval" yaml:"zabbix_discovery_interval" env:"ZABBIX_DISCOVERY_INTERVAL"`
+	NATSURL                 string           `json:"nats_url" toml:"nats_url" xml:"nats_url" yaml:"nats_url" env:"NATS_URL"`
+	NATSSubject             string           `json:"nats_subject,_omitempty" toml:"nats_subject,_omitempty" xml:"nats_subject" yaml:"nats_subject" env:"NATS_SUBJECT"`
+	NATSUser                string           `json:"nats_user" toml:"nats_user" xml:"nats_user" yaml:"nats_user" env:"NATS_USER"`
+	NATSPass                string           `json:"nats_pass" toml:"nats_pass" xml:"nats_pass" yaml:"nats_pass" env:"NATS_PASS"`
+	NATSToken               string           `json:"nats_token" toml:"nats_token" xml:"nats_token" yaml:"nats_token" env:"NATS_TOKEN"`
+	NATSCreds               string           `json:"nats_creds" toml:"nats_creds" xml:"nats_creds" yaml:"nats_creds" env:"NATS_CREDS"`
+	NATSJetStream           bool             `json:"nats_jetstream" toml:"nats_jetstream" xml:"nats_jetstream" yaml:"nats_jetstream" env:"NATS_JETSTREAM"`
+	NATSAckTimeout          Duration         `json:"nats_ack_timeout,_omitempty" toml:"nats_ack_timeout,_omitempty" xml:"nats_ack_timeout" yaml:"nats_ack_timeout" env:"NATS_ACK_TIMEOUT"`
+	SQLitePath              string           `json:"sqlite_path" toml:"sqlite_path" xml:"sqlite_path" yaml:"sqlite_path" env:"SQLITE_PATH"`
+	SQLiteRetention         Duration         `json:"sqlite_retention,_omitempty" toml:"sqlite_retention,_omitempty" xml:"sqlite_retention" yaml:"sqlite_retention" env:"SQLITE_RETENTION"`
+	DatadogAPIKey           string           `json:"datadog_api_key" toml:"datadog_api_key" xml:"datadog_api_key" yaml:"datadog_api_key" env:"DATADOG_API_KEY"`
+	DatadogURL              string           `json:"datadog_url,_omitempty" toml:"datadog_url,_omitempty" xml:"datadog_url" yaml:"datadog_url" env:"DATADOG_URL"`
+	DatadogNamespace        string           `json:"datadog_namespace,_omitempty" toml:"datadog_namespace,_omitempty" xml:"datadog_namespace" yaml:"datadog_namespace" env:"DATADOG_NAMESPACE"`
+	DatadogCounters         string           `json:"datadog_counters,_omitempty" toml:"datadog_counters,_omitempty" xml:"datadog_counters" yaml:"datadog_counters" env:"DATADOG_COUNTERS"`
+	DatadogTags             []string         `json:"datadog_tags" toml:"datadog_tags" xml:"datadog_tags" yaml:"datadog_tags" env:"DATADOG_TAGS"`
+	DatadogIncludeTags      []string         `json:"datadog_include_tags,_omitempty" toml:"datadog_include_tags,_omitempty" xml:"datadog_include_tags" yaml:"datadog_include_tags" env:"DATADOG_INCLUDE_TAGS"`
+	CloudWatchRegion        string           `json:"cloudwatch_region" toml:"cloudwatch_region" xml:"cloudwatch_region" yaml:"cloudwatch_region" env:"CLOUDWATCH_REGION"`
+	CloudWatchURL           string           `json:"cloudwatch_url" toml:"cloudwatch_url" xml:"cloudwatch_url" yaml:"cloudwatch_url" env:"CLOUDWATCH_URL"`
+	CloudWatchNamespace     string           `json:"cloudwatch_namespace,_omitempty" toml:"cloudwatch_namespace,_omitempty" xml:"cloudwatch_namespace" yaml:"cloudwatch_namespace" env:"CLOUDWATCH_NAMESPACE"`
+	CloudWatchDimensions    []string         `json:"cloudwatch_dimensions,_omitempty" toml:"cloudwatch_dimensions,_omitempty" xml:"cloudwatch_dimensions" yaml:"cloudwatch_dimensions" env:"CLOUDWATCH_DIMENSIONS"`
+	CloudWatchBatchSize     int              `json:"cloudwatch_batch_size,_omitempty" toml:"cloudwatch_batch_size,_omitempty" xml:"cloudwatch_batch_size" yaml:"cloudwatch_batch_size" env:"CLOUDWATCH_BATCH_SIZE"`
+	CloudWatchAccessKey     string           `json:"cloudwatch_access_key" toml:"cloudwatch_access_key" xml:"cloudwatch_access_key" yaml:"cloudwatch_access_key" env:"CLOUDWATCH_ACCESS_KEY"`
+	CloudWatchSecretKey     string           `json:"cloudwatch_secret_key" toml:"cloudwatch_secret_key" xml:"cloudwatch_secret_key" yaml:"cloudwatch_secret_key" env:"CLOUDWATCH_SECRET_KEY"`
+	SNMPListen              string           `json:"snmp_listen" toml:"snmp_listen" xml:"snmp_listen" yaml:"snmp_listen" env:"SNMP_LISTEN"`
+	SNMPCommunity           string           `json:"snmp_community" toml:"snmp_community" xml:"snmp_community" yaml:"snmp_community" env:"SNMP_COMMUNITY"`
+	SNMPBaseOID             string           `json:"snmp_base_oid,_omitempty" toml:"snmp_base_oid,_omitempty" xml:"snmp_base_oid" yaml:"snmp_base_oid" env:"SNMP_BASE_OID"`
+	SNMPEngineID            string           `json:"snmp_engine_id,_omitempty" toml:"snmp_engine_id,_omitempty" xml:"snmp_engine_id" yaml:"snmp_engine_id" env:"SNMP_ENGINE_ID"`
+	SNMPV3User              string           `json:"snmp_v3_user" toml:"snmp_v3_user" xml:"snmp_v3_user" yaml:"snmp_v3_user" env:"SNMP_V3_USER"`
+	SNMPV3AuthProto         string           `json:"snmp_v3_auth_proto,_omitempty" toml:"snmp_v3_auth_proto,_omitempty" xml:"snmp_v3_auth_proto" yaml:"snmp_v3_auth_proto" env:"SNMP_V3_AUTH_PROTO"`
+	SNMPV3AuthPass          string           `json:"snmp_v3_auth_pass" toml:"snmp_v3_auth_pass" xml:"snmp_v3_auth_pass" yaml:"snmp_v3_auth_pass" env:"SNMP_V3_AUTH_PASS"`
+	SNMPV3PrivProto         string           `json:"snmp_v3_priv_proto,_omitempty" toml:"snmp_v3_priv_proto,_omitempty" xml:"snmp_v3_priv_proto" yaml:"snmp_v3_priv_proto" env:"SNMP_V3_PRIV_PROTO"`
+	SNMPV3PrivPass          string           `json:"snmp_v3_priv_pass" toml:"snmp_v3_priv_pass" xml:"snmp_v3_priv_pass" yaml:"snmp_v3_priv_pass" env:"SNMP_V3_PRIV_PASS"`
+	KafkaBrokers            []string         `json:"kafka_brokers" toml:"kafka_brokers" xml:"kafka_brokers" yaml:"kafka_brokers" env:"KAFKA_BROKERS"`
+	KafkaTopicPrefix        string           `json:"kafka_topic_prefix,_omitempty" toml:"kafka_topic_prefix,_omitempty" xml:"kafka_topic_prefix" yaml:"kafka_topic_prefix" env:"KAFKA_TOPIC_PREFIX"`
+	KafkaFormat             string           `json:"kafka_format,_omitempty" toml:"kafka_format,_omitempty" xml:"kafka_format" yaml:"kafka_format" env:"KAFKA_FORMAT"`
+	KafkaSchemaRegistry     string           `json:"kafka_schema_registry" toml:"kafka_schema_registry" xml:"kafka_schema_registry" yaml:"kafka_schema_registry" env:"KAFKA_SCHEMA_REGISTRY"`
+	KafkaCompression        string           `json:"kafka_compression,_omitempty" toml:"kafka_compression,_omitempty" xml:"kafka_compression" yaml:"kafka_compression" env:"KAFKA_COMPRESSION"`
+	KafkaBatchSize          int              `json:"kafka_batch_size,_omitempty" toml:"kafka_batch_size,_omitempty" xml:"kafka_batch_size" yaml:"kafka_batch_size" env:"KAFKA_BATCH_SIZE"`
+	KafkaBatchTimeout       Duration         `json:"kafka_batch_timeout,_omitempty" toml:"kafka_batch_timeout,_omitempty" xml:"kafka_batch_timeout" yaml:"kafka_batch_timeout" env:"KAFKA_BATCH_TIMEOUT"`
+	KafkaRequiredAcks       int              `json:"kafka_required_acks,_omitempty" toml:"kafka_required_acks,_omitempty" xml:"kafka_required_acks" yaml:"kafka_required_acks" env:"KAFKA_REQUIRED_ACKS"`
+	KafkaAsync              bool             `json:"kafka_async" toml:"kafka_async" xml:"kafka_async" yaml:"kafka_async" env:"KAFKA_ASYNC"`
+	KafkaTLS                bool             `json:"kafka_tls" toml:"kafka_tls" xml:"kafka_tls" yaml:"kafka_tls" env:"KAFKA_TLS"`
+	KafkaCAFile             string           `json:"kafka_ca_file" toml:"kafka_ca_file" xml:"kafka_ca_file" yaml:"kafka_ca_file" env:"KAFKA_CA_FILE"`
+	KafkaSASLMechanism      string           `json:"kafka_sasl_mechanism" toml:"kafka_sasl_mechanism" xml:"kafka_sasl_mechanism" yaml:"kafka_sasl_mechanism" env:"KAFKA_SASL_MECHANISM"`
+	KafkaUser               string           `json:"kafka_user" toml:"kafka_user" xml:"kafka_user" yaml:"kafka_user" env:"KAFKA_USER"`
+	KafkaPass               string           `json:"kafka_pass" toml:"kafka_pass" xml:"kafka_pass" yaml:"kafka_pass" env:"KAFKA_PASS"`
+	OpenTSDBURL             string           `json:"opentsdb_url" toml:"opentsdb_url" xml:"opentsdb_url" yaml:"opentsdb_url" env:"OPENTSDB_URL"`
+	OpenTSDBPrefix          string           `json:"opentsdb_prefix,_omitempty" toml:"opentsdb_prefix,_omitempty" xml:"opentsdb_prefix" yaml:"opentsdb_prefix" env:"OPENTSDB_PREFIX"`
+	OpenTSDBTags            []string         `json:"opentsdb_tags,_omitempty" toml:"opentsdb_tags,_omitempty" xml:"opentsdb_tags" yaml:"opentsdb_tags" env:"OPENTSDB_TAGS"`
+	OpenTSDBMaxTags         int              `json:"opentsdb_max_tags,_omitempty" toml:"opentsdb_max_tags,_omitempty" xml:"opentsdb_max_tags" yaml:"opentsdb_max_tags" env:"OPENTSDB_MAX_TAGS"`
+	OpenTSDBBatchSize       int              `json:"opentsdb_batch_size,_omitempty" toml:"opentsdb_batch_size,_omitempty" xml:"opentsdb_batch_size" yaml:"opentsdb_batch_size" env:"OPENTSDB_BATCH_SIZE"`
+	Webhooks                []*WebhookConfig `json:"webhook" toml:"webhook" xml:"webhook" yaml:"webhook"`
 }
 
 // Duration is used to UnmarshalTOML into a time.Duration value.
@@ -0,0 +1,98 @@
+package unifipoller
+
+import (
+	"fmt"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// ControllerSysinfoPath is the API path for the controller's system information.
+// It describes the whole controller; any site works.
+const ControllerSysinfoPath = "/api/s/%s/stat/sysinfo"
+
+// ControllerInfo is the controller's system information.
+type ControllerInfo struct {
+	URL                    string         `json:"-"`
+	ResponseTime           time.Duration  `json:"-"` // How long the sysinfo request took.
+	Version                string         `json:"version"`
+	PreviousVersion        string         `json:"previous_version"`
+	Build                  string         `json:"build"`
+	Name                   string         `json:"name"`
+	Hostname               string         `json:"hostname"`
+	Timezone               string         `json:"timezone"`
+	IPAddrs                []string       `json:"ip_addrs"`
+	Uptime                 unifi.FlexInt  `json:"uptime"`
+	UpdateAvailable        unifi.FlexBool `json:"update_available"`
+	UpdateDownloaded       unifi.FlexBool `json:"update_downloaded"`
+	Autobackup             unifi.FlexBool `json:"autobackup"`
+	DataRetentionDays      unifi.FlexInt  `json:"data_retention_days"`
+	InformPort             unifi.FlexInt  `json:"inform_port"`
+	HTTPSPort              unifi.FlexInt  `json:"https_port"`
+	UnsupportedDeviceCount unifi.FlexInt  `json:"unsupported_device_count"`
+	// Self-stats: how the controller answered this poll, and how much it returned.
+	ClientsTime time.Duration `json:"-"`
+	DevicesTime time.Duration `json:"-"`
+	Sites       int           `json:"-"`
+	Clients     int           `json:"-"`
+	Devices     int           `json:"-"`
+	Alarms      int           `json:"-"` // New alarms, in every polled site.
+}
+
+// GetControllerInfo returns the controller's system information, read through
+// the first site. The default site is used when there are no sites.
+func (u *UnifiPoller) GetControllerInfo(sites unifi.Sites) (*ControllerInfo, error) {
+	site := &unifi.Site{Name: "default"}
+	if len(sites) > 0 {
+		site = sites[0]
+	}
+	var response []*ControllerInfo
+	start := time.Now()
+	if err := u.getSiteData(ControllerSysinfoPath, site, &response); err != nil {
+		return nil, err
+	} else if len(response) == 0 {
+		return nil, fmt.Errorf("controller returned no sysinfo")
+	}
+	info := response[0]
+	info.URL, info.ResponseTime = u.Config.UnifiBase, time.Since(start)
+	return info, nil
+}
+
+// addSelfStats adds the time the controller took to list the clients and devices,
+// and the number of sites, clients, devices and new alarms, to its information.
+func (c *ControllerInfo) addSelfStats(m *Metrics, clientsTime, devicesTime time.Duration) {
+	c.ClientsTime, c.DevicesTime = clientsTime, devicesTime
+	c.Sites, c.Clients, c.Alarms = len(m.Sites), len(m.Clients), 0
+	for _, s := range m.Sites {
+		c.Alarms += int(s.NumNewAlarms.Val)
+	}
+	if m.Devices != nil {
+		c.Devices = len(m.Devices.UAPs) + len(m.Devices.USGs) + len(m.Devices.USWs) + len(m.Devices.UDMs)
+	}
+}
+
+// controllerVersionEvent returns an event when the controller was upgraded. The
+// old version is the controller's previous_version. After the first poll, an
+// upgrade is a version change since the last poll. On the first poll (and every
+// Lambda invocation) nothing is remembered, so an upgrade is a controller that
+// restarted within the last interval with a different previous_version.
+func (u *UnifiPoller) controllerVersionEvent(info *ControllerInfo) *Event {
+	last := u.version
+	u.version = info.Version
+	old := firstString(info.PreviousVersion, last)
+	switch {
+	case old == "" || old == info.Version || last == info.Version:
+		return nil
+	case last == "" && time.Duration(info.Uptime.Val)*time.Second > u.Config.Interval.Duration:
+		return nil // Upgraded before this poller started.
+	}
+	u.Logf("UniFi Controller %s upgraded from v%s to v%s (build: %s)", info.Hostname, old, info.Version, info.Build)
+	return &Event{
+		Time:    time.Now(),
+		Type:    "controller_version",
+		Subject: info.Hostname,
+		Old:     old,
+		New:     info.Version,
+		Message: fmt.Sprintf("controller version changed from %s to %s (build %s)", old, info.Version, info.Build),
+	}
+}
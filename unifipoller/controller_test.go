@@ -0,0 +1,70 @@
+package unifipoller
+
+import (
+	"testing"
+	"time"
+
+	"golift.io/unifi"
+)
+
+func TestControllerVersionEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		last     string // The version seen on the previous poll.
+		version  string
+		previous string
+		uptime   float64
+		old      string // The event's old version; empty for no event.
+	}{
+		{name: "first poll", version: "5.12.35", previous: "5.11.50", uptime: 86400},
+		{name: "first poll after an upgrade", version: "5.12.35", previous: "5.11.50", uptime: 20, old: "5.11.50"},
+		{name: "first poll after a restart", version: "5.12.35", previous: "5.12.35", uptime: 20},
+		{name: "first poll without a previous version", version: "5.12.35", uptime: 20},
+		{name: "no change", last: "5.12.35", version: "5.12.35", previous: "5.11.50", uptime: 20},
+		{name: "upgraded", last: "5.11.50", version: "5.12.35", previous: "5.11.50", uptime: 86400, old: "5.11.50"},
+		{name: "upgraded twice", last: "5.10.1", version: "5.12.35", previous: "5.11.50", uptime: 20, old: "5.11.50"},
+		{name: "upgraded without a previous version", last: "5.11.50", version: "5.12.35", uptime: 20, old: "5.11.50"},
+	}
+	for _, test := range tests {
+		u := &UnifiPoller{Config: &Config{Quiet: true, Interval: Duration{30 * time.Second}}, version: test.last}
+		info := &ControllerInfo{Hostname: "unifi", Version: test.version, PreviousVersion: test.previous,
+			Uptime: unifi.FlexInt{Val: test.uptime}}
+		e := u.controllerVersionEvent(info)
+		switch {
+		case test.old == "" && e != nil:
+			t.Errorf("%s: unexpected event: %+v", test.name, e)
+		case test.old != "" && (e == nil || e.Old != test.old || e.New != test.version || e.Subject != "unifi"):
+			t.Errorf("%s: wrong event: %+v, want %s to %s", test.name, e, test.old, test.version)
+		}
+		if u.version != test.version {
+			t.Errorf("%s: the version was not remembered: %s", test.name, u.version)
+		}
+	}
+}
+
+func TestControllerPoints(t *testing.T) {
+	m := &Metrics{
+		Sites:   unifi.Sites{{NumNewAlarms: unifi.FlexInt{Val: 2}}, {NumNewAlarms: unifi.FlexInt{Val: 1}}},
+		Clients: unifi.Clients{{}, {}, {}},
+		Devices: &unifi.Devices{UAPs: []*unifi.UAP{{}, {}}, USWs: []*unifi.USW{{}}},
+	}
+	c := &ControllerInfo{Version: "5.12.35", ResponseTime: 250 * time.Millisecond}
+	c.addSelfStats(m, time.Second, 2*time.Second)
+	points, err := ControllerPoints(c, testTime)
+	if err != nil {
+		t.Fatalf("ControllerPoints: %v", err)
+	}
+	fields, err := points[0].Fields()
+	if err != nil {
+		t.Fatalf("Fields: %v", err)
+	}
+	for k, want := range map[string]interface{}{"response_time": 0.25, "clients_response_time": 1.0,
+		"devices_response_time": 2.0, "sites": int64(2), "clients": int64(3), "devices": int64(3), "alarms": int64(3)} {
+		if fields[k] != want {
+			t.Errorf("field %s = %v, want %v", k, fields[k], want)
+		}
+	}
+	if _, ok := fields["version"]; ok || points[0].Tags()["version"] != "5.12.35" {
+		t.Errorf("version should be a tag only: %v %v", points[0].Tags(), fields)
+	}
+}
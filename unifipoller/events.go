@@ -0,0 +1,39 @@
+package unifipoller
+
+import (
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Event is a change noticed between polls, like a controller upgrade. Events are
+// written to the events measurement with the time they were noticed.
+type Event struct {
+	Time     time.Time
+	SiteName string
+	Type     string // What kind of thing changed, like controller_version.
+	Subject  string // Which thing changed, like the controller's hostname.
+	Old      string
+	New      string
+	Message  string
+}
+
+// EventPoints generates change event datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func EventPoints(e *Event) ([]*influx.Point, error) {
+	tags := map[string]string{
+		"site_name": e.SiteName,
+		"type":      e.Type,
+		"subject":   e.Subject,
+	}
+	fields := map[string]interface{}{
+		"message": e.Message,
+		"old":     e.Old,
+		"new":     e.New,
+	}
+	pt, err := influx.NewPoint("events", tags, fields, e.Time)
+	if err != nil {
+		return nil, err
+	}
+	return []*influx.Point{pt}, nil
+}
@@ -0,0 +1,87 @@
+package unifipoller
+
+import "golift.io/unifi"
+
+// API paths for the port forward counters and the gateway's routing table.
+const (
+	PortForwardPath = "/api/s/%s/stat/portforward"
+	RoutingPath     = "/api/s/%s/stat/routing"
+)
+
+// firewallConfigKinds are the kinds of site configuration collected with collect_firewall.
+// Changes to these are config_change events, like the collect_config kinds.
+var firewallConfigKinds = []siteConfigKind{
+	{"firewallrule", "/api/s/%s/rest/firewallrule", []string{"enabled", "ruleset", "rule_index", "action",
+		"protocol", "logging", "src_firewallgroup_ids", "src_address", "dst_firewallgroup_ids", "dst_address", "dst_port"}},
+	{"firewallgroup", "/api/s/%s/rest/firewallgroup", []string{"group_type", "group_members"}},
+	{"portforward", "/api/s/%s/rest/portforward", []string{"enabled", "proto", "src", "dst_port", "fwd",
+		"fwd_port", "pfwd_interface", "log"}},
+	{"routing", "/api/s/%s/rest/routing", []string{"enabled", "type", "static-route_type",
+		"static-route_network", "static-route_nexthop", "static-route_distance", "static-route_interface"}},
+}
+
+// firewallRuleCounters are the hit counters a firewall rule may have. Not every
+// controller provides them; rules without them only have their definition recorded.
+var firewallRuleCounters = []string{"hits", "packets", "bytes"}
+
+// PortForward is a port forward rule with its traffic counters.
+type PortForward struct {
+	SiteName      string         `json:"-"`
+	ID            string         `json:"_id"`
+	Name          string         `json:"name"`
+	Enabled       unifi.FlexBool `json:"enabled"`
+	Proto         string         `json:"proto"`
+	Src           string         `json:"src"`
+	DstPort       string         `json:"dst_port"`
+	Fwd           string         `json:"fwd"`
+	FwdPort       string         `json:"fwd_port"`
+	PfwdInterface string         `json:"pfwd_interface"`
+	RxBytes       unifi.FlexInt  `json:"rx_bytes"`
+	TxBytes       unifi.FlexInt  `json:"tx_bytes"`
+	RxPackets     unifi.FlexInt  `json:"rx_packets"`
+	TxPackets     unifi.FlexInt  `json:"tx_packets"`
+}
+
+// Route is a prefix in the gateway's routing table, and its next hops.
+type Route struct {
+	SiteName string `json:"-"`
+	Pfx      string `json:"pfx"`
+	Nh       []struct {
+		Intf   string `json:"intf"`
+		Gw     string `json:"gw"`
+		T      string `json:"t"` // Route type and flags, like S>* (static, selected, installed).
+		Metric string `json:"metric"`
+	} `json:"nh"`
+}
+
+// GetPortForwards returns the port forwards, with counters, of the provided sites.
+func (u *UnifiPoller) GetPortForwards(sites unifi.Sites) ([]*PortForward, error) {
+	data := []*PortForward{}
+	for _, site := range sites {
+		var response []*PortForward
+		if err := u.getSiteData(PortForwardPath, site, &response); err != nil {
+			return data, err
+		}
+		for _, p := range response {
+			p.SiteName = site.SiteName
+		}
+		data = append(data, response...)
+	}
+	return data, nil
+}
+
+// GetRoutes returns the routing table of the gateway in each of the provided sites.
+func (u *UnifiPoller) GetRoutes(sites unifi.Sites) ([]*Route, error) {
+	data := []*Route{}
+	for _, site := range sites {
+		var response []*Route
+		if err := u.getSiteData(RoutingPath, site, &response); err != nil {
+			return data, err
+		}
+		for _, r := range response {
+			r.SiteName = site.SiteName
+		}
+		data = append(data, response...)
+	}
+	return data, nil
+}
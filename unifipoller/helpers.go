@@ -1,9 +1,17 @@
 package unifipoller
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"strings"
+	"time"
+
+	"golift.io/unifi"
 )
 
 // LogError logs an error and increments the error counter.
@@ -11,6 +19,9 @@ import (
 func (u *UnifiPoller) LogError(err error, prefix string) {
 	if err != nil {
 		u.errorCount++
+		if u.onError != nil {
+			u.onError(prefix + ": " + err.Error())
+		}
 		_ = log.Output(2, fmt.Sprintf("[ERROR] (%v/%v) %v: %v", u.errorCount, u.Config.MaxErrors, prefix, err))
 	}
 }
@@ -43,3 +54,77 @@ func (u *UnifiPoller) LogDebugf(m string, v ...interface{}) {
 func (u *UnifiPoller) LogErrorf(m string, v ...interface{}) {
 	_ = log.Output(2, fmt.Sprintf("[ERROR] "+m, v...))
 }
+
+// boolToInt turns a boolean into a 1 or a 0 for outputs that only accept numbers.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// newHTTPClient returns an http client for outputs. Provide a CA file to validate
+// a certificate signed by a private authority. verifySSL false accepts any certificate.
+func newHTTPClient(timeout time.Duration, verifySSL bool, caFile string) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(verifySSL, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}, nil
+}
+
+// newTLSConfig returns a TLS client config. When caFile is provided, only the
+// certificates in it are trusted. verifySSL false accepts any certificate.
+func newTLSConfig(verifySSL bool, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !verifySSL} // nolint: gosec
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// getSiteData decodes the data list of a site's API path into v, a pointer to a
+// slice. It reads what the unifi library does not decode, such as stat/device
+// fields it leaves out; params are passed to GetData as the request body.
+func (u *UnifiPoller) getSiteData(path string, site *unifi.Site, v interface{}, params ...string) error {
+	response := struct {
+		Data interface{} `json:"data"`
+	}{Data: v}
+	return u.Unifi.GetData(fmt.Sprintf(path, site.Name), &response, params...)
+}
+
+// SiteDevices is the raw stat/device list of each site, by site name. A poll reads
+// it once, and each collector that needs fields the unifi library leaves out
+// decodes its own view of it.
+type SiteDevices map[string]json.RawMessage
+
+// GetSiteDevices returns the raw device list of each of the provided sites.
+func (u *UnifiPoller) GetSiteDevices(sites unifi.Sites) (SiteDevices, error) {
+	devices := make(SiteDevices)
+	for _, site := range sites {
+		var response json.RawMessage
+		if err := u.getSiteData(unifi.DevicePath, site, &response); err != nil {
+			return devices, err
+		}
+		devices[site.Name] = response
+	}
+	return devices, nil
+}
+
+// decode decodes a site's devices into v, a pointer to a slice.
+func (s SiteDevices) decode(site *unifi.Site, v interface{}) error {
+	if s[site.Name] == nil {
+		return fmt.Errorf("devices of site %s were not read", site.Name)
+	}
+	return json.Unmarshal(s[site.Name], v)
+}
@@ -0,0 +1,32 @@
+package unifipoller
+
+import (
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// testTime is the timestamp given to test points.
+var testTime = time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+
+// testPoint returns an influx point or fails the test.
+func testPoint(t *testing.T, name string, tags map[string]string, fields map[string]interface{}) *influx.Point {
+	t.Helper()
+	pt, err := influx.NewPoint(name, tags, fields, testTime)
+	if err != nil {
+		t.Fatalf("influx.NewPoint: %v", err)
+	}
+	return pt
+}
+
+// testMetrics returns metrics with the provided points in the batch.
+func testMetrics(t *testing.T, points ...*influx.Point) *Metrics {
+	t.Helper()
+	bp, err := influx.NewBatchPoints(influx.BatchPointsConfig{})
+	if err != nil {
+		t.Fatalf("influx.NewBatchPoints: %v", err)
+	}
+	bp.AddPoints(points)
+	return &Metrics{TS: testTime, BatchPoints: bp}
+}
@@ -0,0 +1,201 @@
+package unifipoller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// API paths for a site's hotspot: vouchers, guest authorizations, payments, operators
+// and the events that contain operator logins.
+const (
+	VoucherPath         = "/api/s/%s/stat/voucher"
+	GuestPath           = "/api/s/%s/stat/guest"
+	PaymentPath         = "/api/s/%s/stat/payment"
+	HotspotOperatorPath = "/api/s/%s/rest/hotspotop"
+	HotspotEventPath    = "/api/s/%s/stat/event"
+)
+
+const (
+	hotspotWithin = 24   // How many hours back guest authorizations, payments and logins are requested.
+	hotspotEvents = 3000 // The most events requested to find operator logins.
+)
+
+// Hotspot is a site's guest portal data.
+type Hotspot struct {
+	SiteName  string
+	Vouchers  []*Voucher
+	Guests    []*Guest
+	Payments  []*Payment
+	Operators []*HotspotOperator
+	Logins    []*HotspotLogin
+}
+
+// Voucher is a hotspot voucher. Quota is the number of guests that may use it;
+// 0 is unlimited. Duration is in minutes, and QosUsageQuota in megabytes. The
+// code is a credential, so it is not decoded.
+type Voucher struct {
+	ID            string        `json:"_id"`
+	Note          string        `json:"note"`
+	AdminName     string        `json:"admin_name"`
+	CreateTime    unifi.FlexInt `json:"create_time"`
+	Duration      unifi.FlexInt `json:"duration"`
+	Quota         unifi.FlexInt `json:"quota"`
+	Used          unifi.FlexInt `json:"used"`
+	QosUsageQuota unifi.FlexInt `json:"qos_usage_quota"`
+	QosRateMaxUp  unifi.FlexInt `json:"qos_rate_max_up"`
+	QosRateMaxDn  unifi.FlexInt `json:"qos_rate_max_down"`
+	Status        string        `json:"status"`
+	StatusExpires unifi.FlexInt `json:"status_expires"`
+}
+
+// Remaining returns how many more guests may use the voucher, or -1 if unlimited.
+func (v *Voucher) Remaining() float64 {
+	if v.Quota.Val == 0 {
+		return -1
+	} else if r := v.Quota.Val - v.Used.Val; r > 0 {
+		return r
+	}
+	return 0
+}
+
+// Guest is a guest authorization. AuthorizedBy is how: voucher, password, payment
+// or api. Like a voucher's, the voucher code is not decoded.
+type Guest struct {
+	ID            string         `json:"_id"`
+	Mac           string         `json:"mac"`
+	Name          string         `json:"name"`
+	Hostname      string         `json:"hostname"`
+	AuthorizedBy  string         `json:"authorized_by"`
+	Package       string         `json:"package"`
+	ApMac         string         `json:"ap_mac"`
+	Start         unifi.FlexInt  `json:"start"`
+	End           unifi.FlexInt  `json:"end"`
+	Duration      unifi.FlexInt  `json:"duration"`
+	Expired       unifi.FlexBool `json:"expired"`
+	Bytes         unifi.FlexInt  `json:"bytes"`
+	RxBytes       unifi.FlexInt  `json:"rx_bytes"`
+	TxBytes       unifi.FlexInt  `json:"tx_bytes"`
+	QosUsageQuota unifi.FlexInt  `json:"qos_usage_quota"`
+}
+
+// Payment is a hotspot payment made through the guest portal. New is false when
+// an earlier poll already wrote it.
+type Payment struct {
+	ID       string        `json:"_id"`
+	Mac      string        `json:"mac"`
+	Time     unifi.FlexInt `json:"time"`
+	Amount   unifi.FlexInt `json:"amount"`
+	Currency string        `json:"currency"`
+	Provider string        `json:"provider"`
+	Package  string        `json:"package"`
+	Status   string        `json:"status"`
+	New      bool          `json:"-"`
+}
+
+// HotspotOperator is an account that may log into the hotspot manager to print vouchers.
+type HotspotOperator struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Note string `json:"note"`
+}
+
+// HotspotLogin is a hotspot operator logging into the hotspot manager: a login
+// event that names one of the site's operators. Time is in milliseconds. New is
+// false when an earlier poll already wrote it.
+type HotspotLogin struct {
+	ID    string        `json:"_id"`
+	Key   string        `json:"key"`
+	Admin string        `json:"admin"`
+	IP    string        `json:"ip"`
+	Msg   string        `json:"msg"`
+	Time  unifi.FlexInt `json:"time"`
+	New   bool          `json:"-"`
+}
+
+// GetHotspots returns the vouchers, guest authorizations, payments, operators and
+// operator logins of the provided sites. Guests, payments and logins are from the
+// last 24 hours.
+func (u *UnifiPoller) GetHotspots(sites unifi.Sites) ([]*Hotspot, error) {
+	data := []*Hotspot{}
+	within := fmt.Sprintf(`{"within":%d}`, hotspotWithin)
+	events := fmt.Sprintf(`{"within":%d,"_limit":%d}`, hotspotWithin, hotspotEvents)
+	for _, site := range sites {
+		h := &Hotspot{SiteName: site.SiteName}
+		var vouchers []*Voucher
+		if err := u.getSiteData(VoucherPath, site, &vouchers); err != nil {
+			return data, err
+		}
+		var guests []*Guest
+		if err := u.getSiteData(GuestPath, site, &guests, within); err != nil {
+			return data, err
+		}
+		var payments []*Payment
+		if err := u.getSiteData(PaymentPath, site, &payments, within); err != nil {
+			return data, err
+		}
+		var operators []*HotspotOperator
+		if err := u.getSiteData(HotspotOperatorPath, site, &operators); err != nil {
+			return data, err
+		}
+		var logins []*HotspotLogin
+		if err := u.getSiteData(HotspotEventPath, site, &logins, events); err != nil {
+			return data, err
+		}
+		h.Vouchers, h.Guests, h.Payments, h.Operators = vouchers, guests, payments, operators
+		h.Logins = operatorLogins(logins, operators)
+		data = append(data, h)
+	}
+	return data, nil
+}
+
+// operatorLogins returns the login events that name one of the operators.
+func operatorLogins(events []*HotspotLogin, operators []*HotspotOperator) []*HotspotLogin {
+	names := make(map[string]bool)
+	for _, o := range operators {
+		names[o.Name] = true
+	}
+	logins := []*HotspotLogin{}
+	for _, e := range events {
+		if strings.HasSuffix(strings.ToLower(e.Key), "login") && names[e.Admin] {
+			logins = append(logins, e)
+		}
+	}
+	return logins
+}
+
+// flagHotspotNew flags the payments and operator logins no earlier poll wrote.
+// They are requested for the last 24 hours every poll, and only new ones are
+// written, so outputs without InfluxDB's duplicate handling get each one once.
+func (u *UnifiPoller) flagHotspotNew(hotspots []*Hotspot) {
+	if u.hotspotSeen == nil {
+		u.hotspotSeen = make(map[string]time.Time)
+	}
+	now := time.Now()
+	seen := func(site, kind, id string) bool {
+		key := site + "/" + kind + "/" + id
+		_, ok := u.hotspotSeen[key]
+		u.hotspotSeen[key] = now
+		return ok
+	}
+	for _, h := range hotspots {
+		for _, p := range h.Payments {
+			p.New = !seen(h.SiteName, "payment", p.ID)
+		}
+		for _, l := range h.Logins {
+			l.New = !seen(h.SiteName, "login", l.ID)
+		}
+	}
+	for key, t := range u.hotspotSeen {
+		if now.Sub(t) > hotspotWithin*time.Hour {
+			delete(u.hotspotSeen, key)
+		}
+	}
+}
+
+// active returns true if the guest's authorization has not expired.
+func (g *Guest) active(now time.Time) bool {
+	return !g.Expired.Val && int64(g.End.Val) > now.Unix()
+}
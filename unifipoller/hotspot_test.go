@@ -0,0 +1,106 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"golift.io/unifi"
+)
+
+// testHotspot is a site's hotspot data, decoded the way the controller returns it.
+func testHotspot(t *testing.T) *Hotspot {
+	t.Helper()
+	h := &Hotspot{SiteName: "Default (default)"}
+	for v, data := range map[interface{}]string{
+		&h.Vouchers: `[{"_id": "v1", "code": "1234567890", "admin_name": "frontdesk", "quota": 1, "used": 1}]`,
+		&h.Guests: `[{"_id": "g1", "mac": "bb:01", "authorized_by": "voucher", "voucher_code": "1234567890",
+			"end": 4102444800, "rx_bytes": 10}]`,
+		&h.Payments: `[{"_id": "p1", "time": 1580702400, "amount": 5, "currency": "USD"},
+			{"_id": "p2", "time": 1580702500, "amount": 3, "currency": "EUR"},
+			{"_id": "p3", "time": 1580702600, "amount": 2, "currency": "usd"}]`,
+		&h.Operators: `[{"_id": "o1", "name": "frontdesk"}]`,
+	} {
+		if err := json.Unmarshal([]byte(data), v); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+	}
+	var events []*HotspotLogin
+	err := json.Unmarshal([]byte(`[
+		{"_id": "e1", "key": "EVT_HS_Login", "admin": "frontdesk", "ip": "10.0.0.9", "time": 1580702400000},
+		{"_id": "e2", "key": "EVT_AD_Login", "admin": "root", "time": 1580702400000},
+		{"_id": "e3", "key": "EVT_HS_VoucherUsed", "admin": "frontdesk", "time": 1580702400000}]`), &events)
+	if err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	h.Logins = operatorLogins(events, h.Operators)
+	return h
+}
+
+// testHotspotPoints returns the hotspot's points by measurement.
+func testHotspotPoints(t *testing.T, h *Hotspot) map[string][]*influx.Point {
+	t.Helper()
+	points, err := HotspotPoints(h, testTime)
+	if err != nil {
+		t.Fatalf("HotspotPoints: %v", err)
+	}
+	byName := make(map[string][]*influx.Point)
+	for _, pt := range points {
+		byName[pt.Name()] = append(byName[pt.Name()], pt)
+	}
+	return byName
+}
+
+func TestHotspotPoints(t *testing.T) {
+	h := testHotspot(t)
+	if len(h.Logins) != 1 || h.Logins[0].ID != "e1" {
+		t.Fatalf("only the operator's login is an operator login: %v", h.Logins)
+	}
+	u := &UnifiPoller{}
+	u.flagHotspotNew([]*Hotspot{h})
+	points := testHotspotPoints(t, h)
+	for _, pt := range points["hotspot_vouchers"] {
+		if strings.Contains(pt.String(), "1234567890") {
+			t.Errorf("a voucher code was written: %s", pt)
+		}
+	}
+	for _, pt := range points["hotspot_guests"] {
+		if strings.Contains(pt.String(), "1234567890") {
+			t.Errorf("a voucher code was written: %s", pt)
+		}
+	}
+	if len(points["hotspot_payments"]) != 3 || points["hotspot_payments"][0].Tags()["id"] != "p1" {
+		t.Errorf("each payment should be written, tagged with its id: %v", points["hotspot_payments"])
+	}
+	if logins := points["hotspot_operator_logins"]; len(logins) != 1 || logins[0].Time().Unix() != 1580702400 {
+		t.Errorf("wrong operator logins: %v", logins)
+	}
+	summary, _ := points["hotspot"][0].Fields()
+	for k, want := range map[string]float64{"payments": 3, "payments_amount_usd": 7, "payments_amount_eur": 3,
+		"operator_logins": 1, "guests_active": 1} {
+		if summary[k] != want {
+			t.Errorf("summary %s = %v, want %v", k, summary[k], want)
+		}
+	}
+	if _, ok := summary["payments_amount"]; ok {
+		t.Error("amounts in different currencies were added up")
+	}
+	// The next poll reads the same 24 hours; only the new payment is written.
+	h = testHotspot(t)
+	h.Payments = append(h.Payments, &Payment{ID: "p4", Time: unifi.FlexInt{Val: 1580702700}, Amount: unifi.FlexInt{Val: 1}})
+	u.flagHotspotNew([]*Hotspot{h})
+	points = testHotspotPoints(t, h)
+	if p := points["hotspot_payments"]; len(p) != 1 || p[0].Tags()["id"] != "p4" {
+		t.Errorf("only the new payment should be written: %v", p)
+	}
+	if len(points["hotspot_operator_logins"]) != 0 {
+		t.Errorf("a login was written twice: %v", points["hotspot_operator_logins"])
+	}
+	if summary, _ := points["hotspot"][0].Fields(); summary["payments"] != 4.0 || summary["payments_amount_unknown"] != 1.0 {
+		t.Errorf("the summary should count every payment in the last 24 hours: %v", summary)
+	}
+	if operators, _ := points["hotspot_operators"][0].Fields(); operators["logins"] != 1.0 || operators["vouchers"] != 1.0 {
+		t.Errorf("wrong operator fields: %v", operators)
+	}
+}
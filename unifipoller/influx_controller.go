@@ -0,0 +1,45 @@
+package unifipoller
+
+import (
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// ControllerPoints generates UniFi Controller datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func ControllerPoints(c *ControllerInfo, now time.Time) ([]*influx.Point, error) {
+	tags := map[string]string{
+		"url":      c.URL,
+		"name":     c.Name,
+		"hostname": c.Hostname,
+		"version":  c.Version,
+		"build":    c.Build,
+		"timezone": c.Timezone,
+	}
+	fields := map[string]interface{}{
+		"previous_version":         c.PreviousVersion,
+		"ip_addrs":                 strings.Join(c.IPAddrs, ","),
+		"uptime":                   c.Uptime.Val,
+		"update_available":         c.UpdateAvailable.Val,
+		"update_downloaded":        c.UpdateDownloaded.Val,
+		"autobackup":               c.Autobackup.Val,
+		"data_retention_days":      c.DataRetentionDays.Val,
+		"inform_port":              c.InformPort.Val,
+		"https_port":               c.HTTPSPort.Val,
+		"unsupported_device_count": c.UnsupportedDeviceCount.Val,
+		"response_time":            c.ResponseTime.Seconds(),
+		"clients_response_time":    c.ClientsTime.Seconds(),
+		"devices_response_time":    c.DevicesTime.Seconds(),
+		"sites":                    c.Sites,
+		"clients":                  c.Clients,
+		"devices":                  c.Devices,
+		"alarms":                   c.Alarms,
+	}
+	pt, err := influx.NewPoint("controller", tags, fields, now)
+	if err != nil {
+		return nil, err
+	}
+	return []*influx.Point{pt}, nil
+}
@@ -0,0 +1,98 @@
+package unifipoller
+
+import (
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// FirewallRulePoints generates a datapoint for each firewall rule in a site, with
+// its hit counters when the controller provides them.
+// These points can be passed directly to influx.
+func FirewallRulePoints(s *SiteConfigs, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	for _, c := range s.Items {
+		tags := map[string]string{
+			"site_name": s.SiteName,
+			"id":        c.ID(),
+			"name":      c.Name(),
+			"ruleset":   c.Value("ruleset"),
+			"action":    c.Value("action"),
+			"protocol":  c.Value("protocol"),
+		}
+		enabled, _ := c["enabled"].(bool)
+		index, _ := c["rule_index"].(float64)
+		fields := map[string]interface{}{
+			"enabled":    enabled,
+			"rule_index": index,
+			"logging":    c.Value("logging"),
+		}
+		for _, k := range firewallRuleCounters {
+			if v, ok := c[k].(float64); ok {
+				fields[k] = v
+			}
+		}
+		pt, err := influx.NewPoint("firewall_rules", tags, fields, now)
+		if err != nil {
+			return points, err
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
+
+// PortForwardPoints generates port forward datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func PortForwardPoints(p *PortForward, now time.Time) ([]*influx.Point, error) {
+	tags := map[string]string{
+		"site_name":      p.SiteName,
+		"id":             p.ID,
+		"name":           p.Name,
+		"proto":          p.Proto,
+		"dst_port":       p.DstPort,
+		"fwd":            p.Fwd,
+		"fwd_port":       p.FwdPort,
+		"pfwd_interface": p.PfwdInterface,
+	}
+	fields := map[string]interface{}{
+		"enabled":    p.Enabled.Val,
+		"src":        p.Src,
+		"rx_bytes":   p.RxBytes.Val,
+		"tx_bytes":   p.TxBytes.Val,
+		"rx_packets": p.RxPackets.Val,
+		"tx_packets": p.TxPackets.Val,
+	}
+	pt, err := influx.NewPoint("port_forwards", tags, fields, now)
+	if err != nil {
+		return nil, err
+	}
+	return []*influx.Point{pt}, nil
+}
+
+// RoutePoints generates a datapoint for each next hop of a route.
+// These points can be passed directly to influx.
+func RoutePoints(r *Route, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	for _, nh := range r.Nh {
+		tags := map[string]string{
+			"site_name": r.SiteName,
+			"pfx":       r.Pfx,
+			"intf":      nh.Intf,
+			"gw":        nh.Gw,
+			"type":      strings.TrimRight(nh.T, ">* "),
+		}
+		fields := map[string]interface{}{
+			"flags":     nh.T,
+			"metric":    nh.Metric,
+			"selected":  strings.Contains(nh.T, ">"),
+			"installed": strings.Contains(nh.T, "*"),
+		}
+		pt, err := influx.NewPoint("routes", tags, fields, now)
+		if err != nil {
+			return points, err
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
@@ -0,0 +1,152 @@
+package unifipoller
+
+import (
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// HotspotPoints generates a site's voucher, guest, payment, operator and operator
+// login datapoints, and a summary of its guest sessions, for InfluxDB. Payments
+// and logins are only written when they are new; the summary counts the last 24h.
+// These points can be passed directly to influx.
+func HotspotPoints(h *Hotspot, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	add := func(name string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+		pt, err := influx.NewPoint(name, tags, fields, ts)
+		if err == nil {
+			points = append(points, pt)
+		}
+		return err
+	}
+	// Summary counters for the hotspot measurement.
+	sum := map[string]float64{}
+	byOperator := map[string]float64{}
+	for _, v := range h.Vouchers {
+		sum["vouchers"]++
+		if v.Used.Val > 0 {
+			sum["vouchers_used"]++
+		}
+		if v.Remaining() != 0 {
+			sum["vouchers_valid"]++
+		}
+		byOperator[v.AdminName]++
+		tags := map[string]string{
+			"site_name":  h.SiteName,
+			"id":         v.ID,
+			"note":       v.Note,
+			"status":     v.Status,
+			"admin_name": v.AdminName,
+		}
+		fields := map[string]interface{}{
+			"create_time":       v.CreateTime.Val,
+			"duration":          v.Duration.Val,
+			"quota":             v.Quota.Val,
+			"used":              v.Used.Val,
+			"remaining":         v.Remaining(),
+			"qos_usage_quota":   v.QosUsageQuota.Val,
+			"qos_rate_max_up":   v.QosRateMaxUp.Val,
+			"qos_rate_max_down": v.QosRateMaxDn.Val,
+			"status_expires":    v.StatusExpires.Val,
+		}
+		if err := add("hotspot_vouchers", tags, fields, now); err != nil {
+			return points, err
+		}
+	}
+	for _, g := range h.Guests {
+		sum["guests"]++
+		sum["guests_"+firstString(g.AuthorizedBy, "unknown")]++
+		if !g.active(now) {
+			continue
+		}
+		sum["guests_active"]++
+		sum["rx_bytes"] += g.RxBytes.Val
+		sum["tx_bytes"] += g.TxBytes.Val
+		sum["bytes"] += g.Bytes.Val
+		tags := map[string]string{
+			"site_name":     h.SiteName,
+			"mac":           g.Mac,
+			"name":          firstString(g.Name, g.Hostname),
+			"authorized_by": g.AuthorizedBy,
+			"package":       g.Package,
+			"ap_mac":        g.ApMac,
+		}
+		fields := map[string]interface{}{
+			"start":           g.Start.Val,
+			"end":             g.End.Val,
+			"remaining":       g.End.Val - float64(now.Unix()),
+			"duration":        g.Duration.Val,
+			"bytes":           g.Bytes.Val,
+			"rx_bytes":        g.RxBytes.Val,
+			"tx_bytes":        g.TxBytes.Val,
+			"qos_usage_quota": g.QosUsageQuota.Val,
+		}
+		if err := add("hotspot_guests", tags, fields, now); err != nil {
+			return points, err
+		}
+	}
+	for _, p := range h.Payments {
+		sum["payments"]++
+		sum["payments_amount_"+strings.ToLower(firstString(p.Currency, "unknown"))] += p.Amount.Val
+		if !p.New {
+			continue
+		}
+		tags := map[string]string{
+			"site_name": h.SiteName,
+			"id":        p.ID,
+			"provider":  p.Provider,
+			"currency":  p.Currency,
+			"package":   p.Package,
+			"status":    p.Status,
+		}
+		fields := map[string]interface{}{
+			"mac":    p.Mac,
+			"amount": p.Amount.Val,
+		}
+		// Payments are written at the time they were made.
+		ts := now
+		if p.Time.Val > 0 {
+			ts = time.Unix(int64(p.Time.Val), 0)
+		}
+		if err := add("hotspot_payments", tags, fields, ts); err != nil {
+			return points, err
+		}
+	}
+	logins := map[string]float64{}
+	for _, l := range h.Logins {
+		logins[l.Admin]++
+		if !l.New {
+			continue
+		}
+		tags := map[string]string{"site_name": h.SiteName, "id": l.ID, "name": l.Admin}
+		fields := map[string]interface{}{"ip": l.IP, "message": l.Msg}
+		ts := now
+		if l.Time.Val > 0 {
+			ts = time.Unix(0, int64(l.Time.Val)*int64(time.Millisecond))
+		}
+		if err := add("hotspot_operator_logins", tags, fields, ts); err != nil {
+			return points, err
+		}
+	}
+	for _, o := range h.Operators {
+		tags := map[string]string{"site_name": h.SiteName, "name": o.Name}
+		fields := map[string]interface{}{"note": o.Note, "vouchers": byOperator[o.Name], "logins": logins[o.Name]}
+		if err := add("hotspot_operators", tags, fields, now); err != nil {
+			return points, err
+		}
+	}
+	fields := map[string]interface{}{"operators": float64(len(h.Operators)), "operator_logins": float64(len(h.Logins))}
+	for _, k := range []string{"vouchers", "vouchers_used", "vouchers_valid", "guests", "guests_active",
+		"guests_voucher", "guests_password", "guests_payment", "guests_api", "payments",
+		"rx_bytes", "tx_bytes", "bytes"} {
+		fields[k] = sum[k]
+	}
+	for k, v := range sum {
+		if strings.HasPrefix(k, "payments_amount_") {
+			fields[k] = v // One per currency paid in.
+		}
+	}
+	err := add("hotspot", map[string]string{"site_name": h.SiteName}, fields, now)
+	return points, err
+}
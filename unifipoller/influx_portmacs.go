@@ -0,0 +1,42 @@
+package unifipoller
+
+import (
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// USWPortMACPoints generates a datapoint for each MAC address learned on a switch
+// port. The port tags match the usw_ports measurement, so the two can be joined.
+// These points can be passed directly to influx.
+func USWPortMACPoints(s *SwitchMACTable, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	for _, p := range s.PortTable {
+		for _, m := range p.MacTable {
+			tags := map[string]string{
+				"site_name":   s.SiteName,
+				"device_name": s.Name,
+				"device_mac":  s.Mac,
+				"name":        p.Name,
+				"port_idx":    p.PortIdx.Txt,
+				"port_id":     s.Name + " Port " + p.PortIdx.Txt,
+				"is_uplink":   p.IsUplink.Txt,
+				"mac":         m.Mac,
+				"vlan":        m.Vlan.Txt,
+				"static":      m.Static.Txt,
+			}
+			fields := map[string]interface{}{
+				"age":      m.Age.Val,
+				"uptime":   m.Uptime.Val,
+				"ip":       m.IP,
+				"hostname": m.Hostname,
+			}
+			pt, err := influx.NewPoint("usw_port_macs", tags, fields, now)
+			if err != nil {
+				return points, err
+			}
+			points = append(points, pt)
+		}
+	}
+	return points, nil
+}
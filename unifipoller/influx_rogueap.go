@@ -0,0 +1,45 @@
+package unifipoller
+
+import (
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// RogueAPPoints generates neighboring access point datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func RogueAPPoints(r *RogueAP, now time.Time) ([]*influx.Point, error) {
+	tags := map[string]string{
+		"site_name":  r.SiteName,
+		"ap_mac":     r.ApMac,
+		"ap_name":    r.ApName,
+		"bssid":      r.Bssid,
+		"essid":      r.Essid,
+		"channel":    r.Channel.Txt,
+		"band":       r.Band,
+		"radio":      r.Radio,
+		"radio_name": r.RadioName,
+		"security":   r.Security,
+		"oui":        r.Oui,
+	}
+	fields := map[string]interface{}{
+		"rssi":        r.Rssi.Val,
+		"signal":      r.Signal.Val,
+		"noise":       r.Noise.Val,
+		"age":         r.Age.Val,
+		"last_seen":   r.LastSeen.Val,
+		"bw":          r.Bw.Val,
+		"freq":        r.Freq.Val,
+		"center_freq": r.CenterFreq.Val,
+		"is_rogue":    r.IsRogue.Val,
+		"is_ubnt":     r.IsUbnt.Val,
+		"is_adhoc":    r.IsAdhoc.Val,
+		"own_ssid":    r.OwnSSID,
+		"new":         r.New,
+	}
+	pt, err := influx.NewPoint("rogueap", tags, fields, now)
+	if err != nil {
+		return nil, err
+	}
+	return []*influx.Point{pt}, nil
+}
@@ -0,0 +1,49 @@
+package unifipoller
+
+import (
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// SFPPoints generates SFP module diagnostic datapoints for InfluxDB. The port
+// tags match the usw_ports measurement, so the two can be joined.
+// These points can be passed directly to influx.
+func SFPPoints(s *SFPModules, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	for _, p := range s.PortTable {
+		tags := map[string]string{
+			"site_name":   s.SiteName,
+			"device_name": s.Name,
+			"device_mac":  s.Mac,
+			"device_type": s.Type,
+			"model":       s.Model,
+			"name":        p.Name,
+			"port_idx":    p.PortIdx.Txt,
+			"port_id":     s.Name + " Port " + p.PortIdx.Txt,
+			"media":       p.Media,
+			"vendor":      p.SfpVendor,
+			"part":        p.SfpPart,
+			"serial":      p.SfpSerial,
+			"compliance":  p.SfpCompliance,
+		}
+		fields := map[string]interface{}{
+			"temperature": p.SfpTemperature.Val,
+			"voltage":     p.SfpVoltage.Val,
+			"tx_power":    p.SfpTxpower.Val,
+			"rx_power":    p.SfpRxpower.Val,
+			"current":     p.SfpCurrent.Val,
+			"tx_fault":    p.SfpTxfault.Val,
+			"rx_fault":    p.SfpRxfault.Val,
+			"up":          p.Up.Val,
+			"speed":       p.Speed.Val,
+			"rev":         p.SfpRev,
+		}
+		pt, err := influx.NewPoint("sfp_ports", tags, fields, now)
+		if err != nil {
+			return points, err
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
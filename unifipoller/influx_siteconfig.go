@@ -0,0 +1,39 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// SiteConfigPoints generates configuration inventory datapoints for InfluxDB:
+// one per WLAN, network or port profile, in a config_inventory_<kind> measurement.
+// Every object of a kind has the same string fields: the kind's summary settings,
+// and settings, the object's definition as JSON.
+// These points can be passed directly to influx.
+func SiteConfigPoints(s *SiteConfigs, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	for _, c := range s.Items {
+		tags := map[string]string{
+			"site_name": s.SiteName,
+			"kind":      s.Kind,
+			"id":        c.ID(),
+			"name":      c.Name(),
+		}
+		settings, err := json.Marshal(c.Definition())
+		if err != nil {
+			return points, err
+		}
+		fields := map[string]interface{}{"settings": string(settings)}
+		for _, k := range s.Summary {
+			fields[k] = c.Value(k)
+		}
+		pt, err := influx.NewPoint("config_inventory_"+s.Kind, tags, fields, now)
+		if err != nil {
+			return points, err
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
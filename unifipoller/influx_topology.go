@@ -0,0 +1,60 @@
+package unifipoller
+
+import (
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// TopologyPoints generates a device's uplink and LLDP neighbor datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func TopologyPoints(d *DeviceLinks, now time.Time) ([]*influx.Point, error) {
+	points := []*influx.Point{}
+	if d.Uplink.UplinkMac != "" {
+		tags := map[string]string{
+			"site_name":   d.SiteName,
+			"device_name": d.Name,
+			"device_mac":  d.Mac,
+			"device_type": d.Type,
+			"link":        "uplink",
+			"local_port":  d.Uplink.PortIdx.Txt,
+			"remote_mac":  d.Uplink.UplinkMac,
+			"remote_name": d.Uplink.Name,
+			"remote_port": d.Uplink.UplinkRemotePort.Txt,
+		}
+		fields := map[string]interface{}{
+			"speed":          d.Uplink.Speed.Val,
+			"local_port_idx": d.Uplink.PortIdx.Val,
+			"is_wired":       d.Uplink.Type != "wireless",
+		}
+		pt, err := influx.NewPoint("topology", tags, fields, now)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pt)
+	}
+	for _, n := range d.LldpTable {
+		tags := map[string]string{
+			"site_name":       d.SiteName,
+			"device_name":     d.Name,
+			"device_mac":      d.Mac,
+			"device_type":     d.Type,
+			"link":            "lldp",
+			"local_port":      n.LocalPortIdx.Txt,
+			"local_port_name": n.LocalPortName,
+			"remote_mac":      n.ChassisID,
+			"remote_name":     n.Name,
+			"remote_port":     n.PortID,
+		}
+		fields := map[string]interface{}{
+			"local_port_idx": n.LocalPortIdx.Val,
+			"is_wired":       n.IsWired.Val,
+		}
+		pt, err := influx.NewPoint("topology", tags, fields, now)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
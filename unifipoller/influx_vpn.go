@@ -0,0 +1,64 @@
+package unifipoller
+
+import (
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// VPNTunnelPoints generates site-to-site VPN tunnel datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func VPNTunnelPoints(t *VPNTunnel, now time.Time) ([]*influx.Point, error) {
+	tags := map[string]string{
+		"site_name": t.SiteName,
+		"id":        t.ID,
+		"name":      t.Name,
+		"vpn_type":  t.VPNType,
+		"peer":      t.Peer(),
+		"gateway":   t.Gateway,
+		"ifname":    t.Ifname,
+	}
+	fields := map[string]interface{}{
+		"state":      t.State(),
+		"up":         t.State() == "up",
+		"enabled":    t.Enabled.Val,
+		"uptime":     t.Iface.Uptime.Val,
+		"rx_bytes":   t.Iface.RxBytes.Val,
+		"tx_bytes":   t.Iface.TxBytes.Val,
+		"rx_packets": t.Iface.RxPackets.Val,
+		"tx_packets": t.Iface.TxPackets.Val,
+		"rx_errors":  t.Iface.RxErrors.Val,
+		"tx_errors":  t.Iface.TxErrors.Val,
+	}
+	pt, err := influx.NewPoint("vpn_tunnels", tags, fields, now)
+	if err != nil {
+		return nil, err
+	}
+	return []*influx.Point{pt}, nil
+}
+
+// RemoteUserPoints generates remote user VPN session datapoints for InfluxDB.
+// These points can be passed directly to influx.
+func RemoteUserPoints(s *RemoteUserSession, now time.Time) ([]*influx.Point, error) {
+	tags := map[string]string{
+		"site_name": s.SiteName,
+		"id":        s.ID,
+		"name":      s.Name,
+		"network":   s.Network,
+		"vpn_type":  s.Type,
+	}
+	fields := map[string]interface{}{
+		"remote_ip":  s.RemoteIP,
+		"ip":         s.IP,
+		"uptime":     s.Uptime.Val,
+		"rx_bytes":   s.RxBytes.Val,
+		"tx_bytes":   s.TxBytes.Val,
+		"rx_packets": s.RxPackets.Val,
+		"tx_packets": s.TxPackets.Val,
+	}
+	pt, err := influx.NewPoint("vpn_users", tags, fields, now)
+	if err != nil {
+		return nil, err
+	}
+	return []*influx.Point{pt}, nil
+}
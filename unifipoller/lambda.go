@@ -0,0 +1,187 @@
+package unifipoller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// LambdaHandler is an AWS Lambda function handler. The poller (and its controller
+// session and outputs) is kept between warm invocations, and only rebuilt when
+// the configuration changes. Pass Handle to lambda.Start(); see lambda/main.go.
+type LambdaHandler struct {
+	poller *UnifiPoller
+	config string // JSON copy of the config the poller was built with.
+}
+
+// LambdaEvent is the invocation payload. Config may contain any config file
+// parameters (JSON names) and overrides the environment for one invocation.
+// Other payloads, like scheduled events, are accepted and ignored.
+type LambdaEvent struct {
+	Config json.RawMessage `json:"config"`
+}
+
+// LambdaSummary is returned as the result of every invocation.
+type LambdaSummary struct {
+	Sites     int             `json:"sites"`
+	Clients   int             `json:"clients"`
+	UAPs      int             `json:"uaps"`
+	USGs      int             `json:"usgs"`
+	USWs      int             `json:"usws"`
+	UDMs      int             `json:"udms"`
+	IDSEvents int             `json:"ids_events"`
+	Points    int             `json:"points"`
+	Outputs   []string        `json:"outputs"`
+	Reused    bool            `json:"session_reused"`
+	Errors    []string        `json:"errors"`
+	Durations LambdaDurations `json:"durations_ms"`
+}
+
+// LambdaDurations are the time spent on each step, in milliseconds.
+// Login is 0 when the session is reused.
+type LambdaDurations struct {
+	Login   int64 `json:"login"`
+	Collect int64 `json:"collect"`
+	Report  int64 `json:"report"`
+	Total   int64 `json:"total"`
+}
+
+// NewLambdaHandler returns a handler for lambda.Start().
+func NewLambdaHandler() *LambdaHandler {
+	log.SetFlags(0) // Lambda adds timestamps to the logs.
+	return &LambdaHandler{}
+}
+
+// Handle is invoked by the Lambda runtime. It collects metrics once and writes
+// them to the configured outputs. Errors while collecting or reporting are
+// returned in the summary. An error is only returned when the configuration,
+// controller login or outputs are invalid; nothing is collected in that case.
+func (h *LambdaHandler) Handle(ctx context.Context, event LambdaEvent) (*LambdaSummary, error) {
+	defer h.dropOnPanic()
+	start := time.Now()
+	s := &LambdaSummary{Outputs: []string{}, Errors: []string{}}
+	c, err := lambdaConfig(event)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.setup(c, s); err != nil {
+		return nil, err
+	}
+	u := h.poller
+	u.onError = func(msg string) { s.Errors = append(s.Errors, msg) }
+	defer func() { u.onError = nil }()
+	if deadline, ok := ctx.Deadline(); ok {
+		u.LogDebugf("Invocation deadline in %v", time.Until(deadline).Round(time.Millisecond))
+	}
+	u.LastCheck = time.Now()
+	metrics, err := u.CollectMetrics()
+	if len(metrics.Sites) == 0 && s.Reused && len(s.Errors) > 0 {
+		// The saved session may have expired; login and try once more.
+		u.Logf("Collection failed with a reused session, re-authenticating: %v", s.Errors)
+		s.Errors = []string{}
+		if err = u.Unifi.Login(); err == nil {
+			metrics, err = u.CollectMetrics()
+		}
+	}
+	s.Durations.Collect = time.Since(u.LastCheck).Milliseconds()
+	u.LogError(err, "collecting metrics")
+	if err == nil {
+		report := time.Now()
+		_ = u.AugmentMetrics(metrics)
+		_ = u.ReportMetrics(metrics) // Each failed output is logged, and becomes a summary error.
+		s.Durations.Report = time.Since(report).Milliseconds()
+		s.count(metrics)
+	}
+	s.Durations.Total = time.Since(start).Milliseconds()
+	return s, nil
+}
+
+// setup builds a new poller when there is none or the config changed.
+// Otherwise the previous poller and its controller session are reused.
+// The previous poller's outputs are closed before they are replaced.
+func (h *LambdaHandler) setup(c *Config, s *LambdaSummary) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if s.Reused = h.poller != nil && h.config == string(b); s.Reused {
+		s.Outputs = h.poller.outputNames()
+		return nil
+	}
+	if h.poller != nil {
+		h.poller.CloseOutputs()
+		h.poller = nil
+	}
+	u := &UnifiPoller{Flag: &Flag{}, Config: c}
+	login := time.Now()
+	if err := u.GetUnifi(); err != nil {
+		return err
+	}
+	s.Durations.Login = time.Since(login).Milliseconds()
+	if err := u.GetOutputs(); err != nil {
+		u.CloseOutputs() // The outputs created before the failure.
+		return err
+	}
+	h.poller, h.config = u, string(b)
+	s.Outputs = u.outputNames()
+	return nil
+}
+
+// dropOnPanic drops the poller when Handle panics, so the next invocation builds
+// a new one. The Lambda runtime recovers the panic and returns it as an error.
+func (h *LambdaHandler) dropOnPanic() {
+	if r := recover(); r != nil {
+		if h.poller != nil {
+			h.poller.CloseOutputs()
+			h.poller = nil
+		}
+		panic(r)
+	}
+}
+
+// lambdaConfig builds the config from the defaults, an optional config file
+// (UP_CONFIG_FILE), environment variables, then the event's config overrides.
+func lambdaConfig(event LambdaEvent) (*Config, error) {
+	c := defaultConfig()
+	if file := os.Getenv(ENVConfigPrefix + "CONFIG_FILE"); file != "" {
+		if err := c.ParseFile(file); err != nil {
+			return nil, fmt.Errorf("config file: %v", err)
+		}
+	}
+	if err := c.ParseENV(); err != nil {
+		return nil, err
+	}
+	if len(event.Config) > 0 && string(event.Config) != "null" {
+		if err := json.Unmarshal(event.Config, c); err != nil {
+			return nil, fmt.Errorf("event config: %v", err)
+		}
+	}
+	c.Mode = "lambda"
+	return c, nil
+}
+
+// outputNames returns the names of the enabled outputs, including InfluxDB.
+func (u *UnifiPoller) outputNames() []string {
+	names := []string{}
+	if u.Influx != nil {
+		names = append(names, "influxdb")
+	}
+	for _, o := range u.Outputs {
+		names = append(names, o.Name())
+	}
+	return names
+}
+
+// count adds the collected item counts to the summary.
+func (s *LambdaSummary) count(m *Metrics) {
+	s.Sites, s.Clients, s.IDSEvents = len(m.Sites), len(m.Clients), len(m.IDSList)
+	if m.Devices != nil {
+		s.UAPs, s.USGs, s.USWs, s.UDMs = len(m.UAPs), len(m.USGs), len(m.USWs), len(m.UDMs)
+	}
+	if m.BatchPoints != nil {
+		s.Points = len(m.Points())
+	}
+}
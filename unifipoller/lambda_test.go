@@ -0,0 +1,45 @@
+package unifipoller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLambdaConfig(t *testing.T) {
+	t.Setenv(ENVConfigPrefix+"UNIFI_USER", "envuser")
+	t.Setenv(ENVConfigPrefix+"POLL_SITES", "default")
+	c, err := lambdaConfig(LambdaEvent{Config: json.RawMessage(`{"sites": ["lab"]}`)})
+	if err != nil {
+		t.Fatalf("lambdaConfig: %v", err)
+	}
+	// The event overrides the environment, which overrides the defaults.
+	if c.UnifiUser != "envuser" || len(c.Sites) != 1 || c.Sites[0] != "lab" || c.Mode != "lambda" {
+		t.Errorf("wrong config: user %s, sites %v, mode %s", c.UnifiUser, c.Sites, c.Mode)
+	}
+	if _, err := lambdaConfig(LambdaEvent{Config: json.RawMessage(`{"sites": "lab"}`)}); err == nil ||
+		!strings.Contains(err.Error(), "event config") {
+		t.Errorf("wrong error for an invalid event config: %v", err)
+	}
+}
+
+func TestLambdaHandlePanic(t *testing.T) {
+	h := NewLambdaHandler()
+	c, err := lambdaConfig(LambdaEvent{})
+	if err != nil {
+		t.Fatalf("lambdaConfig: %v", err)
+	}
+	b, _ := json.Marshal(c)
+	// A reused poller without a controller client panics while collecting.
+	h.poller, h.config = &UnifiPoller{Flag: &Flag{}, Config: c}, string(b)
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("the panic was not passed on to the Lambda runtime")
+		}
+		if h.poller != nil {
+			t.Error("the poller was kept after a panic")
+		}
+	}()
+	_, _ = h.Handle(context.Background(), LambdaEvent{})
+}
@@ -0,0 +1,257 @@
+package unifipoller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+const (
+	cloudwatchService     = "monitoring"
+	cloudwatchAPIVersion  = "2010-08-01"
+	cloudwatchHTTPTimeout = 30 * time.Second
+	// cloudwatchMaxDimensions is the most dimensions one datum may have.
+	cloudwatchMaxDimensions = 30
+)
+
+// cloudwatchMetrics are the fields sent to CloudWatch for each measurement, and their units.
+var cloudwatchMetrics = map[string]map[string]string{
+	"uap": {"cpu": "Percent", "mem": "Percent", "num_sta": "Count", "user-num_sta": "Count",
+		"guest-num_sta": "Count", "rx_bytes": "Bytes", "tx_bytes": "Bytes", "uptime": "Seconds", "state": "None"},
+	"usw": {"cpu": "Percent", "mem": "Percent", "user-num_sta": "Count", "guest-num_sta": "Count",
+		"rx_bytes": "Bytes", "tx_bytes": "Bytes", "general_temperature": "None", "uptime": "Seconds", "state": "None"},
+	"usg": {"cpu": "Percent", "mem": "Percent", "uptime": "Seconds", "state": "None",
+		"wan1_rx_bytes-r": "Bytes/Second", "wan1_tx_bytes-r": "Bytes/Second", "wan1_up": "None",
+		"wan1_rx_errors": "Count", "wan1_tx_errors": "Count"},
+	"subsystems": {"num_user": "Count", "num_guest": "Count", "num_sta": "Count", "num_ap": "Count",
+		"num_sw": "Count", "num_gw": "Count", "num_disconnected": "Count", "latency": "Milliseconds",
+		"drops": "Count", "rx_bytes-r": "Bytes/Second", "tx_bytes-r": "Bytes/Second",
+		"xput_up": "Megabits/Second", "xput_down": "Megabits/Second"},
+}
+
+// CloudWatchOutput sends key device and site fields to CloudWatch with PutMetricData.
+// Requests are signed with AWS Signature Version 4 using the credentials in the
+// config, or the standard AWS environment variables (set by Lambda).
+type CloudWatchOutput struct {
+	URL        string
+	Region     string
+	Namespace  string
+	Dimensions []string
+	BatchSize  int
+	accessKey  string
+	secretKey  string
+	token      string
+	client     *http.Client
+}
+
+// cloudwatchDatum is one metric value with its dimensions.
+type cloudwatchDatum struct {
+	Name       string
+	Value      float64
+	Unit       string
+	Time       time.Time
+	Dimensions [][2]string
+}
+
+// NewCloudWatchOutput returns a CloudWatch output from the config.
+func NewCloudWatchOutput(c *Config) (*CloudWatchOutput, error) {
+	client, err := newHTTPClient(cloudwatchHTTPTimeout, true, "")
+	if err != nil {
+		return nil, err
+	}
+	cw := &CloudWatchOutput{
+		URL:        strings.TrimRight(c.CloudWatchURL, "/"),
+		Region:     c.CloudWatchRegion,
+		Namespace:  c.CloudWatchNamespace,
+		Dimensions: c.CloudWatchDimensions,
+		BatchSize:  c.CloudWatchBatchSize,
+		accessKey:  c.CloudWatchAccessKey,
+		secretKey:  c.CloudWatchSecretKey,
+		token:      os.Getenv("AWS_SESSION_TOKEN"),
+		client:     client,
+	}
+	if cw.accessKey == "" {
+		cw.accessKey, cw.secretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	} else {
+		cw.token = "" // the environment's session token belongs to the environment's keys.
+	}
+	if cw.accessKey == "" || cw.secretKey == "" {
+		return nil, fmt.Errorf("missing credentials: set cloudwatch_access_key and cloudwatch_secret_key, " +
+			"or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if cw.URL == "" {
+		cw.URL = "https://monitoring." + cw.Region + ".amazonaws.com"
+	}
+	if cw.BatchSize < 1 {
+		cw.BatchSize = defaultCloudWatchBatchSize
+	}
+	return cw, nil
+}
+
+// Name satisfies the Output interface.
+func (cw *CloudWatchOutput) Name() string {
+	return "cloudwatch output"
+}
+
+// Close closes idle connections to CloudWatch.
+func (cw *CloudWatchOutput) Close() error {
+	cw.client.CloseIdleConnections()
+	return nil
+}
+
+// WriteMetrics sends the mapped fields in batches of BatchSize datums.
+func (cw *CloudWatchOutput) WriteMetrics(m *Metrics) error {
+	data := []*cloudwatchDatum{}
+	for _, p := range m.Points() {
+		d, err := cw.datums(p)
+		if err != nil {
+			return err
+		}
+		data = append(data, d...)
+	}
+	for i := 0; i < len(data); i += cw.BatchSize {
+		end := i + cw.BatchSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := cw.put(data[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// datums returns a datum for each mapped field in a point. The dimensions are
+// the configured tags that the point has, in the configured order.
+func (cw *CloudWatchOutput) datums(p *influx.Point) ([]*cloudwatchDatum, error) {
+	metrics, ok := cloudwatchMetrics[p.Name()]
+	if !ok {
+		return nil, nil
+	}
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tags := p.Tags()
+	dims := [][2]string{}
+	for _, name := range cw.Dimensions {
+		if v := tags[name]; v != "" && len(dims) < cloudwatchMaxDimensions {
+			dims = append(dims, [2]string{name, v})
+		}
+	}
+	data := []*cloudwatchDatum{}
+	for field, unit := range metrics {
+		if val, ok := fieldFloat(fields[field]); ok {
+			data = append(data, &cloudwatchDatum{Name: p.Name() + "." + field, Value: val,
+				Unit: unit, Time: p.Time(), Dimensions: dims})
+		}
+	}
+	return data, nil
+}
+
+// put sends one PutMetricData request.
+func (cw *CloudWatchOutput) put(data []*cloudwatchDatum) error {
+	form := url.Values{}
+	form.Set("Action", "PutMetricData")
+	form.Set("Version", cloudwatchAPIVersion)
+	form.Set("Namespace", cw.Namespace)
+	for i, d := range data {
+		prefix := "MetricData.member." + strconv.Itoa(i+1) + "."
+		form.Set(prefix+"MetricName", d.Name)
+		form.Set(prefix+"Value", strconv.FormatFloat(d.Value, 'f', -1, 64))
+		form.Set(prefix+"Unit", d.Unit)
+		form.Set(prefix+"Timestamp", d.Time.UTC().Format(time.RFC3339))
+		for j, dim := range d.Dimensions {
+			dimPrefix := prefix + "Dimensions.member." + strconv.Itoa(j+1) + "."
+			form.Set(dimPrefix+"Name", dim[0])
+			form.Set(dimPrefix+"Value", dim[1])
+		}
+	}
+	body := form.Encode()
+	req, err := http.NewRequest("POST", cw.URL+"/", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	cw.sign(req, body, time.Now().UTC())
+	resp, err := cw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("cloudwatch: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to a request.
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (cw *CloudWatchOutput) sign(req *http.Request, body string, now time.Time) {
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if cw.token != "" {
+		req.Header.Set("X-Amz-Security-Token", cw.token)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{req.Method, path, req.URL.RawQuery,
+		canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := day + "/" + cw.Region + "/" + cloudwatchService + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+	key := sigv4Key(cw.secretKey, day, cw.Region, cloudwatchService)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cw.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(hmacSHA256(key, stringToSign)))
+}
+
+// sigv4Key derives the Signature Version 4 signing key for a day, region and service.
+func sigv4Key(secret, day, region, service string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, s := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	return key
+}
+
+// sha256Hex returns the hex encoded sha256 hash of a string.
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
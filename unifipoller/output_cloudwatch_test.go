@@ -0,0 +1,140 @@
+package unifipoller
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAWSAccessKey = "AKIDEXAMPLE"
+	testAWSSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+func TestSigV4Key(t *testing.T) {
+	// The example in the AWS documentation for deriving a signing key.
+	key := sigv4Key(testAWSSecretKey, "20120215", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Errorf("wrong signing key: %s", got)
+	}
+}
+
+func TestCloudWatchSign(t *testing.T) {
+	cw := &CloudWatchOutput{Region: "us-east-1", accessKey: testAWSAccessKey, secretKey: testAWSSecretKey}
+	body := "Action=PutMetricData&Namespace=UniFi&Version=2010-08-01"
+	req, _ := http.NewRequest("POST", "https://monitoring.us-east-1.amazonaws.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	cw.sign(req, body, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/monitoring/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=d617975910f8a4f8e2a19ad15906252ed9756986ee629ee6ad0f3c9778054327"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("wrong Authorization header:\n got: %s\nwant: %s", got, want)
+	}
+	if req.Header.Get("X-Amz-Date") != "20150830T123600Z" || req.Header.Get("X-Amz-Security-Token") != "" {
+		t.Errorf("wrong signing headers: %v", req.Header)
+	}
+}
+
+func TestCloudWatchOutput(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []url.Values
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := verifySigV4(r, string(body), testAWSSecretKey); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		form, _ := url.ParseQuery(string(body))
+		mu.Lock()
+		requests = append(requests, form)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	c := defaultConfig()
+	c.CloudWatchRegion, c.CloudWatchURL, c.CloudWatchBatchSize = "us-east-1", srv.URL, 2
+	c.CloudWatchAccessKey, c.CloudWatchSecretKey = testAWSAccessKey, testAWSSecretKey
+	cw, err := NewCloudWatchOutput(c)
+	if err != nil {
+		t.Fatalf("NewCloudWatchOutput: %v", err)
+	}
+	m := testMetrics(t,
+		testPoint(t, "uap", map[string]string{"site_name": "default", "name": "Office AP", "mac": "aa:bb"},
+			map[string]interface{}{"cpu": 12.5, "num_sta": 4, "not_mapped": 1}),
+		testPoint(t, "usg", map[string]string{"site_name": "default", "name": "Gateway"},
+			map[string]interface{}{"wan1_rx_bytes-r": 1000.0}),
+		testPoint(t, "clients", map[string]string{"name": "Laptop"}, map[string]interface{}{"rssi": -40}))
+	if err := cw.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2 (3 datums in batches of 2)", len(requests))
+	}
+	names := map[string]url.Values{}
+	for _, form := range requests {
+		if form.Get("Action") != "PutMetricData" || form.Get("Namespace") != c.CloudWatchNamespace {
+			t.Errorf("wrong request: %v", form)
+		}
+		for i := 1; form.Get(fmt.Sprintf("MetricData.member.%d.MetricName", i)) != ""; i++ {
+			names[form.Get(fmt.Sprintf("MetricData.member.%d.MetricName", i))] = form
+		}
+	}
+	for _, name := range []string{"uap.cpu", "uap.num_sta", "usg.wan1_rx_bytes-r"} {
+		if names[name] == nil {
+			t.Errorf("metric %s not sent; got %v", name, names)
+		}
+	}
+	if len(names) != 3 {
+		t.Errorf("got %d metrics, want 3: %v", len(names), names)
+	}
+}
+
+// verifySigV4 checks a request's signature the way AWS does: from the headers
+// and body the server received.
+func verifySigV4(r *http.Request, body, secret string) error {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	parts := map[string]string{}
+	for _, p := range strings.Split(auth, ", ") {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			parts[kv[0]] = kv[1]
+		}
+	}
+	cred := strings.SplitN(parts["Credential"], "/", 2)
+	if len(cred) != 2 || cred[0] != testAWSAccessKey {
+		return fmt.Errorf("bad credential: %s", parts["Credential"])
+	}
+	if sha256Hex(body) != r.Header.Get("X-Amz-Content-Sha256") {
+		return fmt.Errorf("payload hash mismatch")
+	}
+	headers := ""
+	for _, h := range strings.Split(parts["SignedHeaders"], ";") {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		headers += h + ":" + strings.TrimSpace(v) + "\n"
+	}
+	canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, headers,
+		parts["SignedHeaders"], sha256Hex(body)}, "\n")
+	scope := strings.Split(cred[1], "/")
+	if len(scope) != 4 {
+		return fmt.Errorf("bad scope: %s", cred[1])
+	}
+	toSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" + cred[1] + "\n" + sha256Hex(canonical)
+	sig := hex.EncodeToString(hmacSHA256(sigv4Key(secret, scope[0], scope[1], scope[2]), toSign))
+	if sig != parts["Signature"] {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
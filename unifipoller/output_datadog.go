@@ -0,0 +1,258 @@
+package unifipoller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+const (
+	datadogSeriesPath  = "/api/v1/series"
+	datadogHTTPTimeout = 30 * time.Second
+	// datadogMaxPayload is the series API's limit on an uncompressed request body,
+	// minus some room for the JSON wrapper.
+	datadogMaxPayload = 3200000 - 1024
+	// datadogCounterExpire is how long a counter's previous value is kept after
+	// it stops reporting, so clients that leave do not accumulate forever.
+	datadogCounterExpire = time.Hour
+)
+
+// datadogCounterWords identify fields that are ever-increasing counters. Fields
+// ending in -r or _r are already rates from the controller and stay gauges.
+var datadogCounterWords = []string{"bytes", "packets", "errors", "dropped", "retries",
+	"crypts", "frags", "broadcast", "multicast", "attempts"}
+
+// DatadogOutput sends numeric fields to the Datadog series API. Gauges are sent
+// as gauges. Counters are sent as the difference from the previous poll, either
+// as a count or as a per-second rate. The host is the point's device name.
+// Only the influx tags in IncludeTags are sent. They identify a counter between
+// polls, so tags that change often (like uptime or ip) would reset counters.
+type DatadogOutput struct {
+	URL         string
+	APIKey      string
+	Namespace   string
+	Counters    string
+	Tags        []string
+	IncludeTags []string
+	client      *http.Client
+	counters    map[string]datadogCounter // previous counter values by series key.
+}
+
+// datadogCounter is the last value seen for a counter.
+type datadogCounter struct {
+	Value float64
+	Time  time.Time
+}
+
+// datadogSeries is a single metric in a series API request.
+type datadogSeries struct {
+	Metric   string          `json:"metric"`
+	Points   [][2]float64    `json:"points"`
+	Type     string          `json:"type"`
+	Interval int64           `json:"interval,omitempty"`
+	Host     string          `json:"host,omitempty"`
+	Tags     []string        `json:"tags,omitempty"`
+	raw      json.RawMessage // encoded copy; used for batching.
+}
+
+// NewDatadogOutput returns a Datadog series API output from the config.
+func NewDatadogOutput(c *Config) (*DatadogOutput, error) {
+	client, err := newHTTPClient(datadogHTTPTimeout, true, "")
+	if err != nil {
+		return nil, err
+	}
+	d := &DatadogOutput{
+		URL:         strings.TrimRight(c.DatadogURL, "/"),
+		APIKey:      c.DatadogAPIKey,
+		Namespace:   strings.Trim(c.DatadogNamespace, "."),
+		Counters:    strings.ToLower(c.DatadogCounters),
+		Tags:        c.DatadogTags,
+		IncludeTags: c.DatadogIncludeTags,
+		client:      client,
+		counters:    make(map[string]datadogCounter),
+	}
+	if d.Counters != "rate" && d.Counters != "count" {
+		return nil, fmt.Errorf("invalid datadog_counters: %s (use rate or count)", c.DatadogCounters)
+	}
+	return d, nil
+}
+
+// Name satisfies the Output interface.
+func (d *DatadogOutput) Name() string {
+	return "datadog output"
+}
+
+// Close closes idle connections to Datadog.
+func (d *DatadogOutput) Close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
+
+// WriteMetrics converts the points to series and posts them in batches
+// that fit in the API's payload limit.
+func (d *DatadogOutput) WriteMetrics(m *Metrics) error {
+	batch, size := []*datadogSeries{}, 0
+	for _, p := range m.Points() {
+		series, err := d.series(p)
+		if err != nil {
+			return err
+		}
+		for _, s := range series {
+			if s.raw, err = json.Marshal(s); err != nil {
+				return err
+			}
+			if size+len(s.raw)+1 > datadogMaxPayload && len(batch) > 0 {
+				if err := d.post(batch); err != nil {
+					return err
+				}
+				batch, size = []*datadogSeries{}, 0
+			}
+			batch = append(batch, s)
+			size += len(s.raw) + 1
+		}
+	}
+	for key, c := range d.counters {
+		if time.Since(c.Time) > datadogCounterExpire {
+			delete(d.counters, key)
+		}
+	}
+	if len(batch) > 0 {
+		return d.post(batch)
+	}
+	return nil
+}
+
+// series converts a point into one series per numeric field. Counters are only
+// returned once a previous value exists, and not after a counter reset.
+func (d *DatadogOutput) series(p *influx.Point) ([]*datadogSeries, error) {
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tags := p.Tags()
+	host := datadogHost(p.Name(), tags)
+	ddTags := d.tags(tags)
+	ts := p.Time()
+	series := []*datadogSeries{}
+	for name, v := range fields {
+		if _, ok := v.(string); ok {
+			continue
+		}
+		val, ok := fieldFloat(v)
+		if !ok {
+			continue
+		}
+		s := &datadogSeries{Metric: d.metricName(p.Name(), name), Type: "gauge", Host: host, Tags: ddTags}
+		if !isDatadogCounter(name) {
+			s.Points = [][2]float64{{float64(ts.Unix()), val}}
+			series = append(series, s)
+			continue
+		}
+		key := s.Metric + "|" + host + "|" + strings.Join(ddTags, ",")
+		last, seen := d.counters[key]
+		d.counters[key] = datadogCounter{Value: val, Time: ts}
+		interval := ts.Sub(last.Time).Seconds()
+		if !seen || val < last.Value || interval < 1 {
+			continue
+		}
+		s.Type, s.Interval = d.Counters, int64(interval)
+		if s.Points = [][2]float64{{float64(ts.Unix()), val - last.Value}}; d.Counters == "rate" {
+			s.Points[0][1] /= interval
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// tags turns the included influx tags into sorted key:value Datadog tags.
+// Empty tags are skipped.
+func (d *DatadogOutput) tags(tags map[string]string) []string {
+	ddTags := append([]string{}, d.Tags...)
+	for _, k := range d.IncludeTags {
+		if v := tags[k]; v != "" {
+			ddTags = append(ddTags, k+":"+v)
+		}
+	}
+	sort.Strings(ddTags)
+	return ddTags
+}
+
+// metricName returns namespace.measurement.field with invalid characters replaced.
+func (d *DatadogOutput) metricName(measurement, field string) string {
+	name := measurement + "." + field
+	if d.Namespace != "" {
+		name = d.Namespace + "." + name
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// post sends a batch of series to the series API.
+func (d *DatadogOutput) post(batch []*datadogSeries) error {
+	var body bytes.Buffer
+	body.WriteString(`{"series":[`)
+	for i, s := range batch {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(s.raw)
+	}
+	body.WriteString("]}")
+	req, err := http.NewRequest("POST", d.URL+datadogSeriesPath, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", d.APIKey)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("datadog: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// isDatadogCounter returns true if a field is an ever-increasing counter.
+func isDatadogCounter(field string) bool {
+	if strings.HasSuffix(field, "-r") || strings.HasSuffix(field, "_r") {
+		return false
+	}
+	for _, w := range datadogCounterWords {
+		if strings.Contains(field, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// datadogHost returns the device name a point belongs to. Clients use the
+// access point or switch they are connected to.
+func datadogHost(measurement string, tags map[string]string) string {
+	switch {
+	case tags["device_name"] != "":
+		return tags["device_name"]
+	case StringInSlice(measurement, []string{"uap", "usg", "usw"}):
+		return tags["name"]
+	case tags["ap_name"] != "":
+		return tags["ap_name"]
+	default:
+		return tags["sw_name"]
+	}
+}
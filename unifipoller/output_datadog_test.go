@@ -0,0 +1,125 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// testDatadog returns a Datadog output that posts to a test server.
+// Each request's series are sent on the returned channel.
+func testDatadog(t *testing.T, counters string) (*DatadogOutput, <-chan []*datadogSeries) {
+	requests := make(chan []*datadogSeries, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Series []*datadogSeries `json:"series"`
+		}
+		if r.URL.Path != datadogSeriesPath || r.Header.Get("DD-API-KEY") != "key" {
+			http.Error(w, "bad request", http.StatusForbidden)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- body.Series
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	c := defaultConfig()
+	c.DatadogURL, c.DatadogAPIKey, c.DatadogCounters = srv.URL, "key", counters
+	c.DatadogTags = []string{"env:test"}
+	d, err := NewDatadogOutput(c)
+	if err != nil {
+		t.Fatalf("NewDatadogOutput: %v", err)
+	}
+	return d, requests
+}
+
+// datadogPoll writes one uap point and returns the series posted, by metric name.
+func datadogPoll(t *testing.T, d *DatadogOutput, requests <-chan []*datadogSeries,
+	ts time.Time, tags map[string]string, fields map[string]interface{}) map[string]*datadogSeries {
+	t.Helper()
+	pt, err := influx.NewPoint("uap", tags, fields, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteMetrics(testMetrics(t, pt)); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	series := make(map[string]*datadogSeries)
+	select {
+	case batch := <-requests:
+		for _, s := range batch {
+			series[s.Metric] = s
+		}
+	default:
+	}
+	return series
+}
+
+func TestDatadogCounterRate(t *testing.T) {
+	d, requests := testDatadog(t, "rate")
+	tags := map[string]string{"name": "Office AP", "mac": "aa:bb", "site_name": "default", "ip": "10.0.0.5", "uptime": "100"}
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	series := datadogPoll(t, d, requests, start, tags, map[string]interface{}{"rx_bytes": 1000, "cpu": 12.5})
+	if len(series) != 1 || series["unifi.uap.cpu"] == nil {
+		t.Fatalf("first poll should only send the gauge, got %v", series)
+	}
+	cpu := series["unifi.uap.cpu"]
+	if cpu.Type != "gauge" || cpu.Host != "Office AP" || cpu.Points[0][1] != 12.5 {
+		t.Errorf("wrong gauge: %+v", cpu)
+	}
+	if want := []string{"env:test", "mac:aa:bb", "name:Office AP", "site_name:default"}; !reflect.DeepEqual(cpu.Tags, want) {
+		t.Errorf("tags = %v, want %v", cpu.Tags, want)
+	}
+	// Tags that are not included (ip, uptime) change, but the counter continues.
+	tags["ip"], tags["uptime"] = "10.0.0.6", "130"
+	series = datadogPoll(t, d, requests, start.Add(30*time.Second), tags, map[string]interface{}{"rx_bytes": 4000, "cpu": 10.0})
+	rx := series["unifi.uap.rx_bytes"]
+	if rx == nil || rx.Type != "rate" || rx.Interval != 30 || rx.Points[0][1] != 100 {
+		t.Errorf("wrong rate, want 3000 bytes / 30s = 100: %+v", rx)
+	}
+	// A counter reset is not sent, and becomes the new baseline.
+	series = datadogPoll(t, d, requests, start.Add(60*time.Second), tags, map[string]interface{}{"rx_bytes": 500})
+	if rx := series["unifi.uap.rx_bytes"]; rx != nil {
+		t.Errorf("counter reset should not be sent: %+v", rx)
+	}
+	series = datadogPoll(t, d, requests, start.Add(80*time.Second), tags, map[string]interface{}{"rx_bytes": 1500})
+	if rx := series["unifi.uap.rx_bytes"]; rx == nil || rx.Points[0][1] != 50 {
+		t.Errorf("wrong rate after a reset, want 1000 bytes / 20s = 50: %+v", rx)
+	}
+}
+
+func TestDatadogCounterCount(t *testing.T) {
+	d, requests := testDatadog(t, "count")
+	tags := map[string]string{"name": "Switch", "mac": "cc:dd"}
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	datadogPoll(t, d, requests, start, tags, map[string]interface{}{"tx_packets": 10})
+	series := datadogPoll(t, d, requests, start.Add(10*time.Second), tags, map[string]interface{}{"tx_packets": 70})
+	if tx := series["unifi.uap.tx_packets"]; tx == nil || tx.Type != "count" || tx.Interval != 10 || tx.Points[0][1] != 60 {
+		t.Errorf("wrong count, want 60: %+v", tx)
+	}
+	// A different included tag value is a different counter.
+	tags["name"] = "Other Switch"
+	series = datadogPoll(t, d, requests, start.Add(20*time.Second), tags, map[string]interface{}{"tx_packets": 100})
+	if tx := series["unifi.uap.tx_packets"]; tx != nil {
+		t.Errorf("a new counter should wait for a second value: %+v", tx)
+	}
+}
+
+func TestIsDatadogCounter(t *testing.T) {
+	for field, want := range map[string]bool{
+		"rx_bytes": true, "tx_packets": true, "rx_errors": true, "wifi_tx_attempts": true,
+		"rx_bytes-r": false, "bytes_r": false, "cpu": false, "num_sta": false,
+	} {
+		if got := isDatadogCounter(field); got != want {
+			t.Errorf("isDatadogCounter(%s) = %v, want %v", field, got, want)
+		}
+	}
+}
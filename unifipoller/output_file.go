@@ -0,0 +1,385 @@
+package unifipoller
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// rotateTimeFormat is appended to rotated file names. It sorts lexically.
+const rotateTimeFormat = "20060102T150405.000000000"
+
+// FileOutput writes every poll's points to disk as JSON Lines or CSV.
+// Each measurement gets its own file. Files are rotated by size and/or age,
+// optionally gzipped after rotation, and pruned to a retention limit.
+type FileOutput struct {
+	Path    string
+	Format  string
+	MaxSize int64
+	MaxAge  time.Duration
+	Gzip    bool
+	Retain  int
+	files   map[string]*measurementFile
+}
+
+// measurementFile is the currently-open (not rotated) file for one measurement.
+type measurementFile struct {
+	*os.File
+	size    int64
+	opened  time.Time
+	columns []string // only used for csv.
+}
+
+// jsonPoint is the structure written on each line in JSON Lines format.
+type jsonPoint struct {
+	Time        time.Time              `json:"time"`
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+}
+
+// NewFileOutput checks the output directory and returns a file writer.
+func NewFileOutput(c *Config) (*FileOutput, error) {
+	f := &FileOutput{
+		Path:    c.FilePath,
+		Format:  strings.ToLower(c.FileFormat),
+		MaxSize: int64(c.FileRotateSize) * 1024 * 1024,
+		MaxAge:  c.FileRotateAge.Duration,
+		Gzip:    c.FileGzip,
+		Retain:  c.FileRetain,
+		files:   make(map[string]*measurementFile),
+	}
+	switch f.Format {
+	case "json", "jsonl", "jsonlines":
+		f.Format = "jsonl"
+	case "csv":
+	default:
+		return nil, fmt.Errorf("invalid file_format: %s (use jsonl or csv)", c.FileFormat)
+	}
+	if err := os.MkdirAll(f.Path, 0755); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Name satisfies the Output interface.
+func (f *FileOutput) Name() string {
+	return "file output"
+}
+
+// Close closes the open measurement files. They are reopened by the next write.
+func (f *FileOutput) Close() error {
+	var firstErr error
+	for name, mf := range f.files {
+		delete(f.files, name)
+		if err := mf.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WriteMetrics appends all the batched points to their measurement files.
+func (f *FileOutput) WriteMetrics(m *Metrics) error {
+	points := m.Points()
+	if f.Format == "csv" {
+		if err := f.csvHeaders(points); err != nil {
+			return err
+		}
+	}
+	for _, p := range points {
+		fields, err := p.Fields()
+		if err != nil {
+			return err
+		}
+		if err := f.writePoint(p.Name(), p.Tags(), fields, p.Time()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePoint writes a single point and rotates the file if needed.
+func (f *FileOutput) writePoint(name string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	mf, err := f.open(name)
+	if err != nil {
+		return err
+	}
+	var line []byte
+	if f.Format == "csv" {
+		line = csvLine(csvRecord(mf.columns, tags, fields, ts))
+	} else {
+		if line, err = json.Marshal(&jsonPoint{ts, name, tags, fields}); err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	}
+	if err := mf.write(line); err != nil {
+		return err
+	}
+	if (f.MaxSize > 0 && mf.size >= f.MaxSize) || (f.MaxAge > 0 && time.Since(mf.opened) >= f.MaxAge) {
+		_, err = f.rotate(name, mf.columns)
+	}
+	return err
+}
+
+// csvHeaders makes sure each measurement's csv header has every column in the
+// poll's points. Columns are collected for the whole poll first, so a file is
+// rotated at most once per poll, and only when the measurement gains a column.
+// The new header keeps the old header's columns; headers only grow.
+func (f *FileOutput) csvHeaders(points []*influx.Point) error {
+	columns := make(map[string]map[string]bool)
+	for _, p := range points {
+		fields, err := p.Fields()
+		if err != nil {
+			return err
+		}
+		if columns[p.Name()] == nil {
+			columns[p.Name()] = map[string]bool{"time": true}
+		}
+		for k := range p.Tags() {
+			columns[p.Name()]["tag_"+k] = true
+		}
+		for k := range fields {
+			columns[p.Name()][k] = true
+		}
+	}
+	for name, have := range columns {
+		mf, err := f.open(name)
+		if err != nil {
+			return err
+		} else if hasColumns(mf.columns, have) {
+			continue
+		}
+		for _, c := range mf.columns {
+			have[c] = true
+		}
+		if mf.columns == nil {
+			mf.columns = csvColumns(have)
+			err = mf.write(csvLine(mf.columns))
+		} else {
+			_, err = f.rotate(name, csvColumns(have))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open returns the current file for a measurement, opening it if needed.
+// An existing csv file's header is read, so it is appended to after a restart.
+// A csv file without a header this output can use is rotated.
+func (f *FileOutput) open(name string) (*measurementFile, error) {
+	if mf, ok := f.files[name]; ok {
+		return mf, nil
+	}
+	fileName := filepath.Join(f.Path, name+"."+f.Format)
+	var columns []string
+	if f.Format == "csv" {
+		var err error
+		if columns, err = csvFileHeader(fileName); err != nil {
+			if err := f.archive(name, fileName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	f.files[name] = &measurementFile{File: fd, size: s.Size(), opened: time.Now(), columns: columns}
+	return f.files[name], nil
+}
+
+// rotate closes and archives the current file, then opens a new one.
+// A new csv file gets the provided header.
+func (f *FileOutput) rotate(name string, columns []string) (*measurementFile, error) {
+	if mf, ok := f.files[name]; ok {
+		delete(f.files, name)
+		if err := mf.Close(); err != nil {
+			return nil, err
+		}
+		if err := f.archive(name, mf.Name()); err != nil {
+			return nil, err
+		}
+	}
+	mf, err := f.open(name)
+	if err != nil || columns == nil {
+		return mf, err
+	}
+	mf.columns = columns
+	return mf, mf.write(csvLine(columns))
+}
+
+// archive renames a file with a timestamp, gzips it and prunes old files.
+func (f *FileOutput) archive(name, fileName string) error {
+	rotated := filepath.Join(f.Path, name+"."+time.Now().UTC().Format(rotateTimeFormat)+"."+f.Format)
+	if err := os.Rename(fileName, rotated); err != nil {
+		return err
+	}
+	if f.Gzip {
+		if err := gzipFile(rotated); err != nil {
+			return err
+		}
+	}
+	return f.prune(name)
+}
+
+// prune deletes the oldest rotated files for a measurement beyond the retention limit.
+func (f *FileOutput) prune(name string) error {
+	if f.Retain < 1 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(f.Path, name+".*."+f.Format+"*"))
+	if err != nil || len(files) <= f.Retain {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files[:len(files)-f.Retain] {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes to the file and tracks its size.
+func (mf *measurementFile) write(b []byte) error {
+	n, err := mf.Write(b)
+	mf.size += int64(n)
+	return err
+}
+
+// gzipFile compresses a file into file.gz and removes the original.
+func gzipFile(fileName string) error {
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(fileName + ".gz")
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return os.Remove(fileName)
+}
+
+// csvColumns returns the sorted header for a csv file: time, tags then fields.
+// Tags are prefixed with tag_ because some tags and fields share a name.
+func csvColumns(columns map[string]bool) []string {
+	t, v := []string{}, []string{}
+	for c := range columns {
+		switch {
+		case c == "time":
+		case strings.HasPrefix(c, "tag_"):
+			t = append(t, c)
+		default:
+			v = append(v, c)
+		}
+	}
+	sort.Strings(t)
+	sort.Strings(v)
+	return append(append([]string{"time"}, t...), v...)
+}
+
+// hasColumns returns false if the header is missing any of the columns.
+// A nil header (new file) has none.
+func hasColumns(header []string, columns map[string]bool) bool {
+	if header == nil {
+		return false
+	}
+	have := make(map[string]bool, len(header))
+	for _, c := range header {
+		have[c] = true
+	}
+	for c := range columns {
+		if !have[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// csvFileHeader returns the header of an existing csv file; nil if the file is
+// missing or empty. A header that does not start with time is an error.
+func csvFileHeader(fileName string) ([]string, error) {
+	fd, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	header, err := csv.NewReader(fd).Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if header[0] != "time" {
+		return nil, fmt.Errorf("%s: not a csv file from this output", fileName)
+	}
+	return header, nil
+}
+
+// csvRecord orders a point's values to match the csv header. Missing values are empty.
+func csvRecord(columns []string, tags map[string]string, fields map[string]interface{}, ts time.Time) []string {
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		switch v, ok := fields[c]; {
+		case c == "time":
+			record[i] = ts.UTC().Format(time.RFC3339Nano)
+		case strings.HasPrefix(c, "tag_"):
+			record[i] = tags[strings.TrimPrefix(c, "tag_")]
+		case !ok:
+		case v == nil:
+		default:
+			record[i] = formatValue(v)
+		}
+	}
+	return record
+}
+
+// formatValue turns a field value into a string without exponents.
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case string:
+		return val
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// csvLine encodes a single csv record.
+func csvLine(record []string) []byte {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write(record) // Writing to a strings.Builder does not error.
+	w.Flush()
+	return []byte(b.String())
+}
@@ -0,0 +1,163 @@
+package unifipoller
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// testFileOutput returns a file output writing to a temporary directory.
+func testFileOutput(t *testing.T, format string) *FileOutput {
+	t.Helper()
+	c := defaultConfig()
+	c.FilePath, c.FileFormat = t.TempDir(), format
+	f, err := NewFileOutput(c)
+	if err != nil {
+		t.Fatalf("NewFileOutput: %v", err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// testFiles returns the base names of the files in dir that match pattern.
+func testFiles(t *testing.T, dir, pattern string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		t.Fatalf("filepath.Glob: %v", err)
+	}
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	return files
+}
+
+// testFileContent returns a file's content, decompressed if it is gzipped.
+func testFileContent(t *testing.T, fileName string) string {
+	t.Helper()
+	fd, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("os.Open: %v", err)
+	}
+	defer fd.Close()
+	var r io.Reader = fd
+	if strings.HasSuffix(fileName, ".gz") {
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		r = gz
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return string(b)
+}
+
+func TestFileOutputCSVHeader(t *testing.T) {
+	f := testFileOutput(t, "csv")
+	rule := func(fields map[string]interface{}) *influx.Point {
+		return testPoint(t, "firewall_rules", map[string]string{"name": "Block IoT"}, fields)
+	}
+	// Only some rules have counters; one header has the columns of the whole poll.
+	polls := [][]*influx.Point{
+		{rule(map[string]interface{}{"enabled": true}), rule(map[string]interface{}{"enabled": true, "hits": 5})},
+		{rule(map[string]interface{}{"enabled": false})},
+		{rule(map[string]interface{}{"enabled": true, "bytes": 10})},
+	}
+	for _, points := range polls[:2] {
+		if err := f.WriteMetrics(testMetrics(t, points...)); err != nil {
+			t.Fatalf("WriteMetrics: %v", err)
+		}
+	}
+	if files := testFiles(t, f.Path, "firewall_rules.*.csv"); len(files) != 0 {
+		t.Errorf("the file was rotated without a new column: %v", files)
+	}
+	// After a restart, the file's header is read and the file is appended to.
+	_ = f.Close()
+	f = &FileOutput{Path: f.Path, Format: "csv", files: make(map[string]*measurementFile)}
+	if err := f.WriteMetrics(testMetrics(t, polls[1]...)); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	current := filepath.Join(f.Path, "firewall_rules.csv")
+	want := "time,tag_name,enabled,hits\n" +
+		"2020-02-03T04:05:06Z,Block IoT,true,\n" +
+		"2020-02-03T04:05:06Z,Block IoT,true,5\n" +
+		"2020-02-03T04:05:06Z,Block IoT,false,\n" +
+		"2020-02-03T04:05:06Z,Block IoT,false,\n"
+	if got := testFileContent(t, current); got != want {
+		t.Errorf("wrong csv file:\n%s\nwant:\n%s", got, want)
+	}
+	// A new column rotates the file once; the new header keeps the old columns.
+	if err := f.WriteMetrics(testMetrics(t, polls[2]...)); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	if files := testFiles(t, f.Path, "firewall_rules.*.csv"); len(files) != 1 {
+		t.Errorf("want one rotated file, got %v", files)
+	}
+	want = "time,tag_name,bytes,enabled,hits\n2020-02-03T04:05:06Z,Block IoT,10,true,\n"
+	if got := testFileContent(t, current); got != want {
+		t.Errorf("wrong csv file after a new column:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFileOutputRotate(t *testing.T) {
+	f := testFileOutput(t, "jsonl")
+	f.MaxSize, f.Gzip, f.Retain = 1, true, 2 // Rotate after every point.
+	for i := 0; i < 4; i++ {
+		pt := testPoint(t, "uap", map[string]string{"name": "Office"}, map[string]interface{}{"num_sta": i})
+		if err := f.WriteMetrics(testMetrics(t, pt)); err != nil {
+			t.Fatalf("WriteMetrics: %v", err)
+		}
+		time.Sleep(time.Millisecond) // Rotated files are named by time.
+	}
+	files := testFiles(t, f.Path, "uap.*")
+	if len(files) != 3 || files[2] != "uap.jsonl" || !strings.HasSuffix(files[0], ".jsonl.gz") ||
+		!strings.HasSuffix(files[1], ".jsonl.gz") {
+		t.Fatalf("want the current file and 2 gzipped files, got %v", files)
+	}
+	// The oldest rotated files are pruned; the newest are kept.
+	if got := testFileContent(t, filepath.Join(f.Path, files[1])); !strings.Contains(got, `"num_sta":3`) {
+		t.Errorf("the newest rotated file has the wrong point: %s", got)
+	}
+	if got := testFileContent(t, filepath.Join(f.Path, files[0])); !strings.Contains(got, `"num_sta":2`) {
+		t.Errorf("the oldest kept file has the wrong point: %s", got)
+	}
+	if got := testFileContent(t, filepath.Join(f.Path, "uap.jsonl")); got != "" {
+		t.Errorf("the current file should be empty after rotating: %s", got)
+	}
+}
+
+func TestFileOutputCSVRotate(t *testing.T) {
+	f := testFileOutput(t, "csv")
+	f.MaxSize = 1
+	for i := 0; i < 2; i++ {
+		pt := testPoint(t, "uap", map[string]string{"name": "Office"}, map[string]interface{}{"num_sta": i})
+		if err := f.WriteMetrics(testMetrics(t, pt)); err != nil {
+			t.Fatalf("WriteMetrics: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// A file rotated for its size starts with the same header.
+	files := testFiles(t, f.Path, "uap.*.csv")
+	if len(files) != 2 {
+		t.Fatalf("want 2 rotated files, got %v", files)
+	}
+	for i, file := range files {
+		want := "time,tag_name,num_sta\n2020-02-03T04:05:06Z,Office," + string(rune('0'+i)) + "\n"
+		if got := testFileContent(t, filepath.Join(f.Path, file)); got != want {
+			t.Errorf("wrong rotated file %s:\n%s\nwant:\n%s", file, got, want)
+		}
+	}
+	if got := testFileContent(t, filepath.Join(f.Path, "uap.csv")); got != "time,tag_name,num_sta\n" {
+		t.Errorf("the new file should have the header: %q", got)
+	}
+}
@@ -0,0 +1,378 @@
+package unifipoller
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/gzip"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	kafkaRegistryTimeout = 30 * time.Second
+	kafkaDialTimeout     = 10 * time.Second
+)
+
+// kafkaAvroSchema is the schema of every Avro record. Field values are a union
+// of the types a point field may have; uint64 values above the long range are doubles.
+const kafkaAvroSchema = `{"type":"record","name":"Point","namespace":"io.unifipoller","fields":[` +
+	`{"name":"time","type":{"type":"long","logicalType":"timestamp-millis"}},` +
+	`{"name":"measurement","type":"string"},` +
+	`{"name":"tags","type":{"type":"map","values":"string"}},` +
+	`{"name":"fields","type":{"type":"map","values":["null","boolean","long","double","string"]}}]}`
+
+// kafkaAvroCanonical is kafkaAvroSchema in Parsing Canonical Form; its
+// fingerprint identifies the schema in single-object encoded records.
+const kafkaAvroCanonical = `{"name":"io.unifipoller.Point","type":"record","fields":[` +
+	`{"name":"time","type":"long"},{"name":"measurement","type":"string"},` +
+	`{"name":"tags","type":{"type":"map","values":"string"}},` +
+	`{"name":"fields","type":{"type":"map","values":["null","boolean","long","double","string"]}}]}`
+
+// kafkaCompression maps config values to kafka-go codecs.
+var kafkaCompression = map[string]kafka.CompressionCodec{"none": nil, "gzip": gzip.NewCompressionCodec()}
+
+// KafkaOutput produces every point as a JSON or Avro record to a topic per
+// measurement. Records are keyed by the device MAC (or client MAC), so all the
+// records for one device land in the same partition, in order. Each topic has
+// a writer that batches and compresses its records.
+type KafkaOutput struct {
+	Brokers     []string
+	TopicPrefix string
+	Format      string
+	Registry    string
+	ErrorLog    func(err error, prefix string)
+	config      kafka.WriterConfig // Every topic's writer is made from this.
+	client      *http.Client
+	schemaIDs   map[string]uint32 // registry schema ID by topic.
+	fingerprint uint64
+	mu          sync.Mutex
+	writers     map[string]*kafka.Writer
+}
+
+// NewKafkaOutput returns a Kafka producer from the config. Brokers are not
+// contacted until the first write.
+func NewKafkaOutput(c *Config, errorLog func(err error, prefix string)) (*KafkaOutput, error) {
+	k := &KafkaOutput{
+		Brokers:     c.KafkaBrokers,
+		TopicPrefix: c.KafkaTopicPrefix,
+		Format:      strings.ToLower(c.KafkaFormat),
+		Registry:    strings.TrimRight(c.KafkaSchemaRegistry, "/"),
+		ErrorLog:    errorLog,
+		schemaIDs:   make(map[string]uint32),
+		fingerprint: avroFingerprint(kafkaAvroCanonical),
+		writers:     make(map[string]*kafka.Writer),
+	}
+	if k.Format != "json" && k.Format != "avro" {
+		return nil, fmt.Errorf("invalid kafka_format: %s (use json or avro)", c.KafkaFormat)
+	}
+	compression, ok := kafkaCompression[strings.ToLower(c.KafkaCompression)]
+	if !ok {
+		return nil, fmt.Errorf("invalid kafka_compression: %s (use none or gzip)", c.KafkaCompression)
+	}
+	if c.KafkaRequiredAcks != -1 && c.KafkaRequiredAcks != 1 {
+		return nil, fmt.Errorf("invalid kafka_required_acks: %d (use -1 or 1)", c.KafkaRequiredAcks)
+	}
+	dialer := &kafka.Dialer{ClientID: "unifi-poller", Timeout: kafkaDialTimeout, DualStack: true}
+	if c.KafkaTLS || c.KafkaCAFile != "" {
+		var err error
+		if dialer.TLS, err = newTLSConfig(true, c.KafkaCAFile); err != nil {
+			return nil, err
+		}
+	}
+	if c.KafkaSASLMechanism != "" {
+		var err error
+		if dialer.SASLMechanism, err = kafkaSASL(c.KafkaSASLMechanism, c.KafkaUser, c.KafkaPass); err != nil {
+			return nil, err
+		}
+	}
+	if k.Registry != "" {
+		var err error
+		if k.client, err = newHTTPClient(kafkaRegistryTimeout, true, ""); err != nil {
+			return nil, err
+		}
+	}
+	k.config = kafka.WriterConfig{
+		Brokers:          k.Brokers,
+		Dialer:           dialer,
+		Balancer:         &kafka.Murmur2Balancer{}, // Same partitions as the Java client.
+		BatchSize:        c.KafkaBatchSize,
+		BatchTimeout:     c.KafkaBatchTimeout.Duration,
+		RequiredAcks:     c.KafkaRequiredAcks,
+		Async:            c.KafkaAsync,
+		CompressionCodec: compression,
+	}
+	if c.KafkaAsync {
+		// Async writes return right away; delivery errors are logged when they happen.
+		k.config.ErrorLogger = kafka.LoggerFunc(func(msg string, v ...interface{}) {
+			k.ErrorLog(fmt.Errorf(msg, v...), "kafka delivery")
+		})
+	}
+	return k, nil
+}
+
+// kafkaSASL returns a SASL mechanism: plain, scram-sha-256 or scram-sha-512.
+func kafkaSASL(mechanism, user, pass string) (sasl.Mechanism, error) {
+	switch strings.ToLower(mechanism) {
+	case "plain":
+		return plain.Mechanism{Username: user, Password: pass}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, user, pass)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, user, pass)
+	default:
+		return nil, fmt.Errorf("invalid kafka_sasl_mechanism: %s", mechanism)
+	}
+}
+
+// Name satisfies the Output interface.
+func (k *KafkaOutput) Name() string {
+	return "kafka output"
+}
+
+// Close flushes the records still buffered by async writes and closes every writer.
+func (k *KafkaOutput) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for topic, w := range k.writers {
+		_ = w.Close()
+		delete(k.writers, topic)
+	}
+	return nil
+}
+
+// WriteMetrics encodes every point and writes each topic's records with its
+// writer, all topics at once. Unless async is enabled, this waits for delivery
+// and returns a summary of failed records.
+func (k *KafkaOutput) WriteMetrics(m *Metrics) error {
+	topics := make(map[string][]kafka.Message)
+	total := 0
+	for _, p := range m.Points() {
+		msg, err := k.message(p)
+		if err != nil {
+			return err
+		}
+		topics[msg.Topic] = append(topics[msg.Topic], msg)
+		total++
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failed   int
+		firstErr error
+	)
+	for topic, messages := range topics {
+		wg.Add(1)
+		go func(w *kafka.Writer, topic string, messages []kafka.Message) {
+			defer wg.Done()
+			// A failed write does not say which records failed; count them all.
+			if err := w.WriteMessages(context.Background(), messages...); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if failed += len(messages); firstErr == nil {
+					firstErr = fmt.Errorf("%s: %v", topic, err)
+				}
+			}
+		}(k.writer(topic), topic, messages)
+	}
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records failed: %v", failed, total, firstErr)
+	}
+	return nil
+}
+
+// writer returns a topic's writer, creating it on the first write to the topic.
+func (k *KafkaOutput) writer(topic string) *kafka.Writer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if w, ok := k.writers[topic]; ok {
+		return w
+	}
+	config := k.config
+	config.Topic = topic
+	k.writers[topic] = kafka.NewWriter(config)
+	return k.writers[topic]
+}
+
+// message encodes a point as a record for its measurement's topic.
+func (k *KafkaOutput) message(p *influx.Point) (kafka.Message, error) {
+	msg := kafka.Message{Topic: k.TopicPrefix + p.Name(), Time: p.Time()}
+	if key := kafkaKey(p.Tags()); key != "" {
+		msg.Key = []byte(key) // Records without a key go to a random partition.
+	}
+	fields, err := p.Fields()
+	if err != nil {
+		return msg, err
+	}
+	if k.Format == "json" {
+		msg.Value, err = json.Marshal(&jsonPoint{p.Time(), p.Name(), p.Tags(), fields})
+		return msg, err
+	}
+	var b bytes.Buffer
+	if k.Registry == "" {
+		// Avro single-object encoding: a marker, then the schema fingerprint.
+		b.Write([]byte{0xc3, 0x01})
+		_ = binary.Write(&b, binary.LittleEndian, k.fingerprint)
+	} else {
+		// Confluent wire format: a zero byte, then the registry's schema ID.
+		id, err := k.schemaID(msg.Topic)
+		if err != nil {
+			return msg, err
+		}
+		b.WriteByte(0)
+		_ = binary.Write(&b, binary.BigEndian, id)
+	}
+	avroPoint(&b, p.Time(), p.Name(), p.Tags(), fields)
+	msg.Value = b.Bytes()
+	return msg, nil
+}
+
+// schemaID registers the Avro schema for a topic's value subject once, and
+// returns the registry's ID for it. Registering an existing schema returns its ID.
+func (k *KafkaOutput) schemaID(topic string) (uint32, error) {
+	if id, ok := k.schemaIDs[topic]; ok {
+		return id, nil
+	}
+	body, err := json.Marshal(map[string]string{"schema": kafkaAvroSchema})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := k.client.Post(k.Registry+"/subjects/"+topic+"-value/versions",
+		"application/vnd.schemaregistry.v1+json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("schema registry: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	var r struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return 0, fmt.Errorf("schema registry: %v", err)
+	}
+	k.schemaIDs[topic] = r.ID
+	return r.ID, nil
+}
+
+// kafkaKey returns the record key: the device MAC for device measurements (like
+// ports and radios), the MAC for devices and clients, or a name when there is no MAC.
+func kafkaKey(tags map[string]string) string {
+	for _, tag := range []string{"device_mac", "mac", "device_name", "name"} {
+		if tags[tag] != "" {
+			return tags[tag]
+		}
+	}
+	return ""
+}
+
+// avroPoint appends a point to b in Avro binary encoding, using kafkaAvroSchema.
+// Map keys are written in sorted order, so the same point always encodes the same.
+func avroPoint(b *bytes.Buffer, ts time.Time, name string, tags map[string]string, fields map[string]interface{}) {
+	avroLong(b, ts.UnixNano()/int64(time.Millisecond))
+	avroString(b, name)
+	t := make([]string, 0, len(tags))
+	for k := range tags {
+		t = append(t, k)
+	}
+	v := make([]string, 0, len(fields))
+	for k := range fields {
+		v = append(v, k)
+	}
+	sort.Strings(t)
+	sort.Strings(v)
+	// Maps are written as one block of entries, then a zero count.
+	if len(t) > 0 {
+		avroLong(b, int64(len(t)))
+		for _, k := range t {
+			avroString(b, k)
+			avroString(b, tags[k])
+		}
+	}
+	avroLong(b, 0)
+	if len(v) > 0 {
+		avroLong(b, int64(len(v)))
+		for _, k := range v {
+			avroString(b, k)
+			avroUnion(b, fields[k])
+		}
+	}
+	avroLong(b, 0)
+}
+
+// avroUnion writes a field value as the ["null","boolean","long","double","string"] union.
+func avroUnion(b *bytes.Buffer, v interface{}) {
+	switch val := v.(type) {
+	case bool:
+		avroLong(b, 1)
+		b.WriteByte(byte(boolToInt(val)))
+	case int64:
+		avroLong(b, 2)
+		avroLong(b, val)
+	case uint64:
+		if val <= math.MaxInt64 {
+			avroLong(b, 2)
+			avroLong(b, int64(val))
+			return
+		}
+		avroUnion(b, float64(val))
+	case float64:
+		avroLong(b, 3)
+		_ = binary.Write(b, binary.LittleEndian, math.Float64bits(val))
+	case string:
+		avroLong(b, 4)
+		avroString(b, val)
+	default:
+		avroLong(b, 0)
+	}
+}
+
+// avroLong writes a zig-zag encoded variable-length integer.
+func avroLong(b *bytes.Buffer, n int64) {
+	u := uint64(n<<1) ^ uint64(n>>63)
+	for u >= 0x80 {
+		b.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	b.WriteByte(byte(u))
+}
+
+// avroString writes a length-prefixed string.
+func avroString(b *bytes.Buffer, s string) {
+	avroLong(b, int64(len(s)))
+	b.WriteString(s)
+}
+
+// avroFingerprint returns the CRC-64-AVRO (Rabin) fingerprint of a canonical schema.
+func avroFingerprint(schema string) uint64 {
+	const empty = 0xc15d213aa4d7a795
+	var table [256]uint64
+	for i := range table {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (empty & -(fp & 1))
+		}
+		table[i] = fp
+	}
+	fp := uint64(empty)
+	for i := 0; i < len(schema); i++ {
+		fp = (fp >> 8) ^ table[byte(fp)^schema[i]]
+	}
+	return fp
+}
@@ -0,0 +1,432 @@
+package unifipoller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRecord is a record received by fakeKafka.
+type fakeRecord struct {
+	Topic     string
+	Partition int32
+	Key       []byte
+	Value     []byte
+	Time      time.Time
+	Codec     int8
+}
+
+// fakeKafka is a broker that answers ApiVersions, Metadata v1 and Produce v2
+// requests, and records the records it receives.
+type fakeKafka struct {
+	net.Listener
+	t          *testing.T
+	partitions int
+	mu         sync.Mutex
+	records    []*fakeRecord
+	fail       map[string]int16 // topic -> error code for every produce.
+}
+
+// newFakeKafka starts a broker with topics of this many partitions.
+func newFakeKafka(t *testing.T, partitions int) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeKafka{Listener: l, t: t, partitions: partitions, fail: make(map[string]int16)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		r := bytes.NewReader(req)
+		api, version, corr := fakeInt16(r), fakeInt16(r), fakeInt32(r)
+		fakeString(r) // client_id
+		var b bytes.Buffer
+		switch {
+		case api == 18: // ApiVersions: Produce up to v2, Metadata up to v1.
+			fakeWrite(&b, int16(0), int32(3), int16(0), int16(0), int16(2), int16(3), int16(0), int16(1),
+				int16(18), int16(0), int16(0))
+		case api == 3 && version == 1:
+			f.metadata(r, &b)
+		case api == 0 && version == 2:
+			f.produce(r, &b)
+		default:
+			f.t.Errorf("unexpected request: api %d version %d", api, version)
+			return
+		}
+		if err := fakeWrite(conn, int32(b.Len()+4), corr); err != nil {
+			return
+		} else if _, err := conn.Write(b.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeKafka) metadata(r *bytes.Reader, b *bytes.Buffer) {
+	host, port, _ := net.SplitHostPort(f.Addr().String())
+	p, _ := strconv.Atoi(port)
+	fakeWrite(b, int32(1), int32(7)) // One broker, node 7.
+	fakeString(b, host)
+	fakeWrite(b, int32(p))
+	fakeString(b, "")      // rack
+	fakeWrite(b, int32(7)) // controller
+	topics := fakeInt32(r)
+	fakeWrite(b, topics)
+	for ; topics > 0; topics-- {
+		fakeWrite(b, int16(0))
+		fakeString(b, fakeString(r))
+		fakeWrite(b, false, int32(f.partitions))
+		for i := 0; i < f.partitions; i++ {
+			// No error, the partition, leader 7, replicas [7], isr [7].
+			fakeWrite(b, int16(0), int32(i), int32(7), int32(1), int32(7), int32(1), int32(7))
+		}
+	}
+}
+
+// produce decodes a Produce request, checks every message set, and writes its response.
+func (f *fakeKafka) produce(r *bytes.Reader, b *bytes.Buffer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fakeInt16(r) // acks
+	fakeInt32(r) // timeout
+	topics := fakeInt32(r)
+	fakeWrite(b, topics)
+	for ; topics > 0; topics-- {
+		topic := fakeString(r)
+		partitions := fakeInt32(r)
+		fakeString(b, topic)
+		fakeWrite(b, partitions)
+		for ; partitions > 0; partitions-- {
+			partition := fakeInt32(r)
+			set := make([]byte, fakeInt32(r))
+			_, _ = io.ReadFull(r, set)
+			records, err := decodeMessageSet(set, 0)
+			code := f.fail[topic]
+			if err != nil {
+				f.t.Errorf("bad message set: %v", err)
+				code = 2
+			}
+			if code == 0 {
+				for _, rec := range records {
+					rec.Topic, rec.Partition = topic, partition
+				}
+				f.records = append(f.records, records...)
+			}
+			fakeWrite(b, partition, code, int64(0), int64(-1))
+		}
+	}
+	fakeWrite(b, int32(0)) // throttle
+}
+
+func (f *fakeKafka) received() []*fakeRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeRecord{}, f.records...)
+}
+
+// decodeMessageSet checks a v1 message set and returns its messages. A gzip
+// message holds a compressed message set.
+func decodeMessageSet(set []byte, codec int8) ([]*fakeRecord, error) {
+	records := []*fakeRecord{}
+	for r := bytes.NewReader(set); r.Len() > 0; {
+		fakeInt64(r) // offset
+		msg := make([]byte, fakeInt32(r))
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return nil, err
+		}
+		m := bytes.NewReader(msg)
+		if crc := uint32(fakeInt32(m)); crc != crc32.ChecksumIEEE(msg[4:]) {
+			return nil, strconv.ErrSyntax
+		} else if magic := fakeInt8(m); magic != 1 {
+			return nil, strconv.ErrSyntax
+		}
+		attributes, ts := fakeInt8(m), fakeInt64(m)
+		rec := &fakeRecord{Time: time.Unix(0, ts*int64(time.Millisecond)), Codec: codec}
+		rec.Key, rec.Value = fakeBytes(m), fakeBytes(m)
+		if attributes&7 != 1 {
+			records = append(records, rec)
+			continue
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(rec.Value))
+		if err != nil {
+			return nil, err
+		}
+		inner, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := decodeMessageSet(inner, 1)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, compressed...)
+	}
+	return records, nil
+}
+
+func fakeWrite(w io.Writer, v ...interface{}) error {
+	for _, v := range v {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fakeInt8(r io.Reader) (n int8)   { _ = binary.Read(r, binary.BigEndian, &n); return n }
+func fakeInt16(r io.Reader) (n int16) { _ = binary.Read(r, binary.BigEndian, &n); return n }
+func fakeInt32(r io.Reader) (n int32) { _ = binary.Read(r, binary.BigEndian, &n); return n }
+func fakeInt64(r io.Reader) (n int64) { _ = binary.Read(r, binary.BigEndian, &n); return n }
+
+// fakeString reads a string from a reader, or writes s to a buffer.
+func fakeString(rw interface{}, s ...string) string {
+	if b, ok := rw.(*bytes.Buffer); ok {
+		_ = fakeWrite(b, int16(len(s[0])))
+		b.WriteString(s[0])
+		return s[0]
+	}
+	r := rw.(io.Reader)
+	v := make([]byte, fakeInt16(r))
+	_, _ = io.ReadFull(r, v)
+	return string(v)
+}
+
+func fakeBytes(r io.Reader) []byte {
+	n := fakeInt32(r)
+	if n < 0 {
+		return nil
+	}
+	v := make([]byte, n)
+	_, _ = io.ReadFull(r, v)
+	return v
+}
+
+func testKafka(t *testing.T, f *fakeKafka, setup func(c *Config)) *KafkaOutput {
+	t.Helper()
+	c := defaultConfig()
+	c.KafkaBrokers = []string{f.Addr().String()}
+	if setup != nil {
+		setup(c)
+	}
+	k, err := NewKafkaOutput(c, func(err error, prefix string) { t.Errorf("%s: %v", prefix, err) })
+	if err != nil {
+		t.Fatalf("NewKafkaOutput: %v", err)
+	}
+	k.config.MaxAttempts = 1 // Fail right away.
+	t.Cleanup(func() { _ = k.Close() })
+	return k
+}
+
+func TestKafkaOutput(t *testing.T) {
+	f := newFakeKafka(t, 3)
+	k := testKafka(t, f, func(c *Config) { c.KafkaBatchSize = 2 })
+	m := testMetrics(t,
+		testPoint(t, "uap", map[string]string{"mac": "aa:bb:cc:00:00:01", "name": "AP 1"}, map[string]interface{}{"num_sta": 5}),
+		testPoint(t, "uap", map[string]string{"mac": "aa:bb:cc:00:00:02", "name": "AP 2"}, map[string]interface{}{"num_sta": 2}),
+		testPoint(t, "clients", map[string]string{"mac": "11:22:33:44:55:66"}, map[string]interface{}{"rssi": -40}))
+	if err := k.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	records := f.received()
+	if len(records) != 3 {
+		t.Fatalf("broker received %d records, want 3", len(records))
+	}
+	partitions := make(map[string]int32)
+	for _, r := range records {
+		var p jsonPoint
+		if err := json.Unmarshal(r.Value, &p); err != nil {
+			t.Errorf("bad JSON record: %v: %s", err, r.Value)
+		}
+		if r.Topic != "unifi."+p.Measurement || string(r.Key) != p.Tags["mac"] || r.Codec != 1 || !r.Time.Equal(testTime) {
+			t.Errorf("wrong record: %s key %s codec %d at %v", r.Topic, r.Key, r.Codec, r.Time)
+		}
+		partitions[string(r.Key)] = r.Partition
+	}
+	// One device's records stay in one partition.
+	if err := k.WriteMetrics(testMetrics(t, testPoint(t, "uap", map[string]string{"mac": "aa:bb:cc:00:00:01"},
+		map[string]interface{}{"cpu": 1.0}))); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	if records = f.received(); len(records) != 4 || records[3].Partition != partitions["aa:bb:cc:00:00:01"] {
+		t.Errorf("the second record for a device went to another partition: %+v", records)
+	}
+}
+
+func TestKafkaOutputErrors(t *testing.T) {
+	f := newFakeKafka(t, 1)
+	f.fail["unifi.uap"] = 10 // MESSAGE_TOO_LARGE
+	k := testKafka(t, f, func(c *Config) { c.KafkaCompression = "none" })
+	m := testMetrics(t, testPoint(t, "uap", map[string]string{"mac": "aa"}, map[string]interface{}{"cpu": 1.0}),
+		testPoint(t, "usw", map[string]string{"mac": "bb"}, map[string]interface{}{"cpu": 2.0}))
+	if err := k.WriteMetrics(m); err == nil || !strings.HasPrefix(err.Error(), "1 of 2 records failed: unifi.uap: ") {
+		t.Errorf("wrong error: %v", err)
+	}
+	if records := f.received(); len(records) != 1 || records[0].Topic != "unifi.usw" || records[0].Codec != 0 {
+		t.Errorf("the usw record should be delivered uncompressed: %+v", records)
+	}
+	for _, c := range []func(c *Config){
+		func(c *Config) { c.KafkaFormat = "xml" },
+		func(c *Config) { c.KafkaCompression = "snappy" },
+		func(c *Config) { c.KafkaRequiredAcks = 0 },
+		func(c *Config) { c.KafkaSASLMechanism = "gssapi" },
+	} {
+		conf := defaultConfig()
+		c(conf)
+		if _, err := NewKafkaOutput(conf, nil); err == nil {
+			t.Errorf("invalid config accepted: %+v", conf)
+		}
+	}
+}
+
+func TestKafkaOutputAsync(t *testing.T) {
+	f := newFakeKafka(t, 2)
+	k := testKafka(t, f, func(c *Config) { c.KafkaAsync, c.KafkaBatchTimeout = true, Duration{time.Hour} })
+	for i := 0; i < 3; i++ {
+		if err := k.WriteMetrics(testMetrics(t, testPoint(t, "uap", map[string]string{"mac": strconv.Itoa(i)},
+			map[string]interface{}{"cpu": 1.0}))); err != nil {
+			t.Fatalf("WriteMetrics: %v", err)
+		}
+	}
+	// Nothing is sent before the batch timeout, but Close flushes the batches.
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if records := f.received(); len(records) != 3 {
+		t.Errorf("broker received %d records, want 3", len(records))
+	}
+}
+
+func TestKafkaAvroMessage(t *testing.T) {
+	var registered []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registered = append(registered, r.URL.Path)
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := defaultConfig()
+	c.KafkaBrokers, c.KafkaFormat = []string{"127.0.0.1:9092"}, "avro"
+	k, err := NewKafkaOutput(c, nil)
+	if err != nil {
+		t.Fatalf("NewKafkaOutput: %v", err)
+	}
+	p := testPoint(t, "uap", map[string]string{"mac": "aa"}, map[string]interface{}{"cpu": 1.0})
+	msg, err := k.message(p)
+	if err != nil {
+		t.Fatalf("message: %v", err)
+	}
+	// Single-object encoding: the marker, then the little-endian fingerprint.
+	fingerprint := make([]byte, 8)
+	binary.LittleEndian.PutUint64(fingerprint, avroFingerprint(kafkaAvroCanonical))
+	if !bytes.HasPrefix(msg.Value, append([]byte{0xc3, 0x01}, fingerprint...)) || msg.Topic != "unifi.uap" {
+		t.Errorf("wrong single-object record for %s: % x", msg.Topic, msg.Value)
+	}
+	c.KafkaSchemaRegistry = srv.URL + "/"
+	if k, err = NewKafkaOutput(c, nil); err != nil {
+		t.Fatalf("NewKafkaOutput: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if msg, err = k.message(p); err != nil {
+			t.Fatalf("message: %v", err)
+		}
+	}
+	// Confluent wire format: a zero byte, then the big-endian schema ID.
+	if !bytes.HasPrefix(msg.Value, []byte{0, 0, 0, 0, 7}) {
+		t.Errorf("wrong registry record: % x", msg.Value)
+	}
+	if len(registered) != 1 || registered[0] != "/subjects/unifi.uap-value/versions" {
+		t.Errorf("the schema should be registered once per topic: %v", registered)
+	}
+}
+
+func TestKafkaSASL(t *testing.T) {
+	for mechanism, want := range map[string]string{"plain": "PLAIN", "SCRAM-SHA-256": "SCRAM-SHA-256",
+		"scram-sha-512": "SCRAM-SHA-512"} {
+		if m, err := kafkaSASL(mechanism, "poller", "secret"); err != nil || m.Name() != want {
+			t.Errorf("kafkaSASL(%s) = %v %v, want %s", mechanism, m, err, want)
+		}
+	}
+}
+
+func TestAvroFingerprint(t *testing.T) {
+	// Test vectors from the Avro specification's schema fingerprint tests.
+	for schema, want := range map[string]uint64{`"null"`: 7195948357588979594, `"int"`: 8247732601305521295} {
+		if got := avroFingerprint(schema); got != want {
+			t.Errorf("avroFingerprint(%s) = %d, want %d", schema, got, want)
+		}
+	}
+}
+
+func TestAvroPoint(t *testing.T) {
+	var b bytes.Buffer
+	avroPoint(&b, time.Unix(1, 0), "uap", map[string]string{"mac": "aa"},
+		map[string]interface{}{"d": 1.5, "c": "x", "b": true, "a": int64(1)})
+	want := []byte{
+		0xd0, 0x0f, // time: 1000 ms
+		0x06, 'u', 'a', 'p',
+		0x02, 0x06, 'm', 'a', 'c', 0x04, 'a', 'a', 0x00, // tags: one entry, then the end.
+		0x08,                  // fields: four entries, sorted.
+		0x02, 'a', 0x04, 0x02, // long 1
+		0x02, 'b', 0x02, 0x01, // boolean true
+		0x02, 'c', 0x08, 0x02, 'x', // string "x"
+		0x02, 'd', 0x06, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, // double 1.5
+		0x00,
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("wrong encoding:\n got: % x\nwant: % x", b.Bytes(), want)
+	}
+	b.Reset()
+	avroPoint(&b, time.Unix(0, 0), "x", nil, nil)
+	if want := []byte{0x00, 0x02, 'x', 0x00, 0x00}; !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("empty maps: got % x, want % x", b.Bytes(), want)
+	}
+}
+
+func TestKafkaKey(t *testing.T) {
+	tests := []struct {
+		tags map[string]string
+		want string
+	}{
+		{map[string]string{"device_mac": "aa", "mac": "bb", "name": "port"}, "aa"},
+		{map[string]string{"mac": "bb", "name": "AP"}, "bb"},
+		{map[string]string{"device_name": "Core", "name": "port 1"}, "Core"},
+		{map[string]string{"name": "default"}, "default"},
+		{map[string]string{"site_name": "default"}, ""},
+	}
+	for _, test := range tests {
+		if got := kafkaKey(test.tags); got != test.want {
+			t.Errorf("kafkaKey(%v) = %q, want %q", test.tags, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package unifipoller
+
+import (
+	"bufio"
+	"io"
+)
+
+// LineProtocolOutput prints InfluxDB line protocol to a writer, usually stdout.
+// This allows Telegraf (and similar tools) to run the poller as an input.
+type LineProtocolOutput struct {
+	io.Writer
+}
+
+// NewLineProtocolOutput returns an output that prints line protocol to w.
+func NewLineProtocolOutput(w io.Writer) *LineProtocolOutput {
+	return &LineProtocolOutput{Writer: w}
+}
+
+// Name satisfies the Output interface.
+func (l *LineProtocolOutput) Name() string {
+	return "line protocol output"
+}
+
+// Close does nothing; the writer belongs to the caller.
+func (l *LineProtocolOutput) Close() error {
+	return nil
+}
+
+// WriteMetrics prints one line per point. The whole batch is written at once.
+func (l *LineProtocolOutput) WriteMetrics(m *Metrics) error {
+	buf := bufio.NewWriter(l.Writer)
+	for _, p := range m.Points() {
+		if _, err := buf.WriteString(p.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,228 @@
+package unifipoller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golift.io/unifi"
+)
+
+const (
+	lokiPushPath    = "/loki/api/v1/push"
+	lokiHTTPTimeout = 30 * time.Second
+)
+
+// LokiOutput pushes IDS and change events to Grafana Loki as log lines. Labels
+// are kept to a small, low-cardinality set: job, site, subsystem and category.
+// Everything else goes into the log line as logfmt or json. Change events use
+// the subsystem "events" and their type as the category.
+type LokiOutput struct {
+	URL      string
+	User     string
+	Pass     string
+	TenantID string
+	Format   string
+	client   *http.Client
+}
+
+// lokiStream is a set of log lines that share the same labels.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// NewLokiOutput returns a Loki output from the config.
+func NewLokiOutput(c *Config) (*LokiOutput, error) {
+	client, err := newHTTPClient(lokiHTTPTimeout, c.LokiVerifySSL, "")
+	if err != nil {
+		return nil, err
+	}
+	l := &LokiOutput{
+		URL:      strings.TrimRight(c.LokiURL, "/"),
+		User:     c.LokiUser,
+		Pass:     c.LokiPass,
+		TenantID: c.LokiTenantID,
+		Format:   strings.ToLower(c.LokiFormat),
+		client:   client,
+	}
+	if l.Format != "logfmt" && l.Format != "json" {
+		return nil, fmt.Errorf("invalid loki_format: %s (use logfmt or json)", c.LokiFormat)
+	}
+	return l, nil
+}
+
+// Name satisfies the Output interface.
+func (l *LokiOutput) Name() string {
+	return "loki output"
+}
+
+// Close closes idle connections to Loki.
+func (l *LokiOutput) Close() error {
+	l.client.CloseIdleConnections()
+	return nil
+}
+
+// WriteMetrics pushes all the IDS and change events to Loki in one request.
+func (l *LokiOutput) WriteMetrics(m *Metrics) error {
+	if len(m.IDSList) == 0 && len(m.Events) == 0 {
+		return nil
+	}
+	siteNames := make(map[string]string)
+	for _, s := range m.Sites {
+		siteNames[s.ID] = s.Name
+	}
+	streams := make(map[string]*lokiStream)
+	for _, i := range m.IDSList {
+		labels := map[string]string{
+			"job":       "unifi-poller",
+			"site":      siteNames[i.SiteID],
+			"subsystem": i.Subsystem,
+			"category":  i.InnerAlertCategory,
+		}
+		line, err := l.idsLine(i)
+		if err != nil {
+			return err
+		}
+		addLokiLine(streams, labels, i.Datetime, line)
+	}
+	for _, e := range m.Events {
+		labels := map[string]string{
+			"job":       "unifi-poller",
+			"site":      e.SiteName,
+			"subsystem": "events",
+			"category":  e.Type,
+		}
+		line, err := l.eventLine(e)
+		if err != nil {
+			return err
+		}
+		addLokiLine(streams, labels, e.Time, line)
+	}
+	return l.push(streams)
+}
+
+// addLokiLine appends a log line to the stream with the provided labels.
+func addLokiLine(streams map[string]*lokiStream, labels map[string]string, ts time.Time, line string) {
+	key := labels["site"] + "\x00" + labels["subsystem"] + "\x00" + labels["category"]
+	if streams[key] == nil {
+		streams[key] = &lokiStream{Stream: labels}
+	}
+	streams[key].Values = append(streams[key].Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), line})
+}
+
+// eventLine formats a change event (minus labels) as a log line.
+func (l *LokiOutput) eventLine(e *Event) (string, error) {
+	data := map[string]interface{}{
+		"msg":     e.Message,
+		"subject": e.Subject,
+		"old":     e.Old,
+		"new":     e.New,
+	}
+	if l.Format == "json" {
+		b, err := json.Marshal(data)
+		return string(b), err
+	}
+	return logfmt(data), nil
+}
+
+// idsLine formats an IDS event's data (minus labels) as a log line.
+// The data comes from IDSPoints(), so it matches what InfluxDB receives.
+func (l *LokiOutput) idsLine(i *unifi.IDS) (string, error) {
+	pts, err := IDSPoints(i)
+	if err != nil {
+		return "", err
+	}
+	data := map[string]interface{}{
+		"msg":       i.Msg,
+		"src_ip":    i.SrcIP,
+		"dest_ip":   i.DestIP,
+		"signature": i.InnerAlertSignature,
+	}
+	for _, p := range pts {
+		fields, err := p.Fields()
+		if err != nil {
+			return "", err
+		}
+		for k, v := range p.Tags() {
+			data[k] = v
+		}
+		for k, v := range fields {
+			data[k] = v
+		}
+	}
+	delete(data, "subsystem")
+	delete(data, "alert_category")
+	if l.Format == "json" {
+		b, err := json.Marshal(data)
+		return string(b), err
+	}
+	return logfmt(data), nil
+}
+
+// push sends the streams to Loki. Each stream's values are sorted by time.
+func (l *LokiOutput) push(streams map[string]*lokiStream) error {
+	payload := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, s := range streams {
+		// Nanosecond epoch timestamps all have the same number of digits (until 2286).
+		sort.Slice(s.Values, func(i, j int) bool { return s.Values[i][0] < s.Values[j][0] })
+		payload.Streams = append(payload.Streams, s)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", l.URL+lokiPushPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.TenantID)
+	}
+	if l.User != "" {
+		req.SetBasicAuth(l.User, l.Pass)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("loki returned %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// logfmt encodes a map as a logfmt line with sorted keys. Empty values are skipped.
+func logfmt(data map[string]interface{}) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		v := formatValue(data[k])
+		if v == "" {
+			continue
+		}
+		if strings.ContainsAny(v, " =\"\\\t\n") {
+			v = strconv.Quote(v)
+		}
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(k + "=" + v)
+	}
+	return b.String()
+}
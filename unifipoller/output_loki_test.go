@@ -0,0 +1,121 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// testLokiMetrics has IDS events in two sites and two categories, and a change event.
+func testLokiMetrics(t *testing.T) *Metrics {
+	t.Helper()
+	ids := func(site, category string, seconds int) *unifi.IDS {
+		return &unifi.IDS{SiteID: site, Subsystem: "www", InnerAlertCategory: category, Msg: "ET SCAN nmap",
+			SrcIP: "203.0.113.9", DestIP: "10.0.0.5", Proto: "TCP", InnerAlertSignature: "ET SCAN Nmap",
+			Datetime: testTime.Add(time.Duration(seconds) * time.Second)}
+	}
+	m := testMetrics(t)
+	m.Sites = unifi.Sites{{ID: "s1", Name: "default"}, {ID: "s2", Name: "lab"}}
+	m.IDSList = unifi.IDSList{ids("s1", "Attempted Recon", 20), ids("s1", "Attempted Recon", 10),
+		ids("s1", "Misc Attack", 0), ids("s2", "Attempted Recon", 0)}
+	m.Events = []*Event{{Time: testTime, SiteName: "default", Type: "config_change", Subject: "Corp",
+		Old: "wpapsk", New: "open", Message: "wlanconf Corp changed"}}
+	return m
+}
+
+// testLokiPush writes the metrics to a Loki output and returns the pushed streams.
+func testLokiPush(t *testing.T, l *LokiOutput, m *Metrics) []*lokiStream {
+	t.Helper()
+	var payload struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != lokiPushPath || r.Header.Get("X-Scope-OrgID") != "tenant" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	l.URL, l.TenantID, l.client = srv.URL, "tenant", srv.Client()
+	if err := l.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	sort.Slice(payload.Streams, func(i, j int) bool {
+		a, b := payload.Streams[i].Stream, payload.Streams[j].Stream
+		return a["site"]+a["subsystem"]+a["category"] < b["site"]+b["subsystem"]+b["category"]
+	})
+	return payload.Streams
+}
+
+func TestLokiStreams(t *testing.T) {
+	streams := testLokiPush(t, &LokiOutput{Format: "logfmt"}, testLokiMetrics(t))
+	want := []map[string]string{
+		{"job": "unifi-poller", "site": "default", "subsystem": "events", "category": "config_change"},
+		{"job": "unifi-poller", "site": "default", "subsystem": "www", "category": "Attempted Recon"},
+		{"job": "unifi-poller", "site": "default", "subsystem": "www", "category": "Misc Attack"},
+		{"job": "unifi-poller", "site": "lab", "subsystem": "www", "category": "Attempted Recon"},
+	}
+	if len(streams) != len(want) {
+		t.Fatalf("got %d streams, want %d: one per site, subsystem and category", len(streams), len(want))
+	}
+	for i, s := range streams {
+		if !reflect.DeepEqual(s.Stream, want[i]) {
+			t.Errorf("stream %d labels = %v, want %v", i, s.Stream, want[i])
+		}
+	}
+	// Loki rejects out of order lines in a stream; they are sorted by time.
+	if v := streams[1].Values; len(v) != 2 || v[0][0] != "1580702716000000000" || v[1][0] != "1580702726000000000" {
+		t.Errorf("wrong values: %v", v)
+	}
+	wantLine := `dest_ip=10.0.0.5 msg="ET SCAN nmap" proto=TCP signature="ET SCAN Nmap" src_ip=203.0.113.9`
+	if line := streams[3].Values[0][1]; line != wantLine {
+		t.Errorf("wrong IDS line:\n%s\nwant:\n%s", line, wantLine)
+	}
+	wantLine = `msg="wlanconf Corp changed" new=open old=wpapsk subject=Corp`
+	if line := streams[0].Values[0][1]; line != wantLine {
+		t.Errorf("wrong event line:\n%s\nwant:\n%s", line, wantLine)
+	}
+}
+
+func TestLokiJSONLines(t *testing.T) {
+	streams := testLokiPush(t, &LokiOutput{Format: "json"}, testLokiMetrics(t))
+	var ids, event map[string]interface{}
+	if err := json.Unmarshal([]byte(streams[3].Values[0][1]), &ids); err != nil {
+		t.Fatalf("the IDS line is not json: %v", err)
+	}
+	if ids["msg"] != "ET SCAN nmap" || ids["src_ip"] != "203.0.113.9" || ids["proto"] != "TCP" {
+		t.Errorf("wrong IDS line: %v", ids)
+	}
+	// The labels are not repeated in the line.
+	if _, ok := ids["subsystem"]; ok {
+		t.Errorf("the IDS line has the subsystem label: %v", ids)
+	} else if _, ok := ids["alert_category"]; ok {
+		t.Errorf("the IDS line has the category label: %v", ids)
+	}
+	if err := json.Unmarshal([]byte(streams[0].Values[0][1]), &event); err != nil {
+		t.Fatalf("the event line is not json: %v", err)
+	}
+	if want := map[string]interface{}{"msg": "wlanconf Corp changed", "subject": "Corp", "old": "wpapsk",
+		"new": "open"}; !reflect.DeepEqual(event, want) {
+		t.Errorf("event line = %v, want %v", event, want)
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	got := logfmt(map[string]interface{}{"b": "two words", "a": 1.5, "c": "", "d": `say "hi"`, "e": true})
+	if want := `a=1.5 b="two words" d="say \"hi\"" e=true`; got != want {
+		t.Errorf("logfmt = %s, want %s", got, want)
+	}
+	if strings.Contains(logfmt(map[string]interface{}{"x": "a=b"}), "x=a=b") {
+		t.Error("a value with = was not quoted")
+	}
+}
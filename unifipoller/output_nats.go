@@ -0,0 +1,143 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// natsSubjectVar matches a {tag} or {measurement} variable in the subject template.
+var natsSubjectVar = regexp.MustCompile(`{([A-Za-z0-9_-]+)}`)
+
+// natsTokenReplacer removes characters that are not allowed (or have meaning)
+// inside a single NATS subject token.
+var natsTokenReplacer = strings.NewReplacer(" ", "_", "\t", "_", ".", "_", "*", "_", ">", "_")
+
+// NATSOutput publishes every point as JSON to a NATS subject built from its tags.
+// With JetStream enabled, each message is published to a stream and acknowledged.
+type NATSOutput struct {
+	*nats.Conn
+	Subject    string
+	JetStream  bool
+	AckTimeout time.Duration
+	js         nats.JetStreamContext
+}
+
+// NewNATSOutput connects to the NATS servers and returns a publisher.
+func NewNATSOutput(c *Config) (*NATSOutput, error) {
+	n := &NATSOutput{
+		Subject:    c.NATSSubject,
+		JetStream:  c.NATSJetStream,
+		AckTimeout: c.NATSAckTimeout.Duration,
+	}
+	opts := []nats.Option{nats.Name("unifi-poller"), nats.MaxReconnects(-1)}
+	switch {
+	case c.NATSCreds != "":
+		opts = append(opts, nats.UserCredentials(c.NATSCreds))
+	case c.NATSToken != "":
+		opts = append(opts, nats.Token(c.NATSToken))
+	case c.NATSUser != "":
+		opts = append(opts, nats.UserInfo(c.NATSUser, c.NATSPass))
+	}
+	var err error
+	if n.Conn, err = nats.Connect(c.NATSURL, opts...); err != nil {
+		return nil, err
+	}
+	if n.JetStream {
+		if n.js, err = n.Conn.JetStream(); err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Name satisfies the Output interface.
+func (n *NATSOutput) Name() string {
+	return "nats output"
+}
+
+// Close flushes buffered publishes and closes the connection to the NATS server.
+func (n *NATSOutput) Close() error {
+	n.Conn.Close()
+	return nil
+}
+
+// WriteMetrics publishes every point. Core NATS publishes are flushed to the
+// server; JetStream publishes are sent asynchronously and all acks are awaited.
+func (n *NATSOutput) WriteMetrics(m *Metrics) error {
+	futures := []nats.PubAckFuture{}
+	for _, p := range m.Points() {
+		fields, err := p.Fields()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(&jsonPoint{p.Time(), p.Name(), p.Tags(), fields})
+		if err != nil {
+			return err
+		}
+		if !n.JetStream {
+			if err := n.Publish(n.subject(p), data); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := n.js.PublishAsync(n.subject(p), data)
+		if err != nil {
+			return err
+		}
+		futures = append(futures, f)
+	}
+	if !n.JetStream {
+		return n.FlushTimeout(n.AckTimeout)
+	}
+	return n.waitAcks(futures)
+}
+
+// waitAcks waits for every JetStream publish to be acknowledged.
+// Returns the first error and a count of failures.
+func (n *NATSOutput) waitAcks(futures []nats.PubAckFuture) error {
+	timeout := time.NewTimer(n.AckTimeout)
+	defer timeout.Stop()
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, f := range futures {
+		select {
+		case <-f.Ok():
+		case err := <-f.Err():
+			if failed++; firstErr == nil {
+				firstErr = err
+			}
+		case <-timeout.C:
+			return fmt.Errorf("timed out waiting for jetstream acks after %v", n.AckTimeout)
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d jetstream publishes failed: %v", failed, len(futures), firstErr)
+	}
+	return nil
+}
+
+// subject fills in the subject template with the point's measurement and tags.
+// Missing tags become an underscore so every subject has the same token count.
+func (n *NATSOutput) subject(p *influx.Point) string {
+	tags := p.Tags()
+	return natsSubjectVar.ReplaceAllStringFunc(n.Subject, func(v string) string {
+		v = strings.Trim(v, "{}")
+		val := tags[v]
+		if v == "measurement" {
+			val = p.Name()
+		}
+		if val = natsTokenReplacer.Replace(val); val == "" {
+			return "_"
+		}
+		return val
+	})
+}
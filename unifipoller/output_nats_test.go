@@ -0,0 +1,253 @@
+package unifipoller
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+)
+
+// fakeNATS is a NATS server that records CONNECT and PUB messages.
+// Publishes with a reply subject are acknowledged like JetStream does;
+// subjects containing "fail" get an error ack.
+type fakeNATS struct {
+	t     *testing.T
+	ln    net.Listener
+	nonce string
+	mu    sync.Mutex
+	conns []net.Conn
+	auth  []fakeNATSConnect
+	pubs  []fakeNATSPub
+}
+
+// fakeNATSConnect is the part of a CONNECT message the tests check.
+type fakeNATSConnect struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+	Name string `json:"name"`
+	JWT  string `json:"jwt"`
+	Sig  string `json:"sig"`
+}
+
+type fakeNATSPub struct {
+	Subject string
+	Reply   string
+	Data    string
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeNATS{t: t, ln: ln, nonce: "test-nonce"}
+	t.Cleanup(func() { f.ln.Close(); f.drop() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) url() string {
+	return "nats://" + f.ln.Addr().String()
+}
+
+// drop closes every client connection.
+func (f *fakeNATS) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.conns {
+		c.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	_, _ = io.WriteString(conn, `INFO {"server_id":"fake","max_payload":1048576,"nonce":"`+f.nonce+`"}`+"\r\n")
+	r := bufio.NewReader(conn)
+	subs := make(map[string]string) // reply subject prefix -> sid
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		switch args[0] {
+		case "CONNECT":
+			var c fakeNATSConnect
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &c)
+			f.mu.Lock()
+			f.auth = append(f.auth, c)
+			f.mu.Unlock()
+			if c.User == "bad" {
+				_, _ = io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "SUB":
+			subs[strings.TrimSuffix(args[1], "*")] = args[len(args)-1]
+		case "PING":
+			_, _ = io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			pub := fakeNATSPub{Subject: args[1], Data: string(data[:size])}
+			if len(args) == 4 {
+				pub.Reply = args[2]
+				ack := `{"stream":"unifi","seq":1}`
+				if strings.Contains(pub.Subject, "fail") {
+					ack = `{"error":{"code":503,"description":"no stream"}}`
+				}
+				sid := subs[pub.Reply[:strings.LastIndex(pub.Reply, ".")+1]]
+				_, _ = io.WriteString(conn, "MSG "+pub.Reply+" "+sid+" "+strconv.Itoa(len(ack))+"\r\n"+ack+"\r\n")
+			}
+			f.mu.Lock()
+			f.pubs = append(f.pubs, pub)
+			f.mu.Unlock()
+		}
+	}
+}
+
+func (f *fakeNATS) connects() []fakeNATSConnect {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeNATSConnect{}, f.auth...)
+}
+
+func (f *fakeNATS) published() []fakeNATSPub {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeNATSPub{}, f.pubs...)
+}
+
+func testNATSConfig(url string) *Config {
+	return &Config{NATSURL: url, NATSSubject: defaultNATSSubject, NATSAckTimeout: Duration{2 * time.Second}}
+}
+
+func TestNATSOutputPublish(t *testing.T) {
+	f := newFakeNATS(t)
+	c := testNATSConfig(f.url())
+	c.NATSUser, c.NATSPass = "poller", "secret"
+	n, err := NewNATSOutput(c)
+	if err != nil {
+		t.Fatalf("NewNATSOutput: %v", err)
+	}
+	defer n.Close()
+	m := testMetrics(t,
+		testPoint(t, "uap", map[string]string{"site_name": "Main Office", "mac": "aa:bb"}, map[string]interface{}{"num_sta": 5}),
+		testPoint(t, "clients", map[string]string{"site_name": "default"}, map[string]interface{}{"rssi": -40}))
+	if err := n.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	pubs := f.published()
+	if len(pubs) != 2 {
+		t.Fatalf("got %d publishes, want 2", len(pubs))
+	}
+	if pubs[0].Subject != "unifi.Main_Office.uap.aa:bb" || pubs[1].Subject != "unifi.default.clients._" {
+		t.Errorf("wrong subjects: %q, %q", pubs[0].Subject, pubs[1].Subject)
+	}
+	if pubs[0].Reply != "" {
+		t.Errorf("core publish has a reply subject: %q", pubs[0].Reply)
+	}
+	var p struct {
+		Measurement string                 `json:"measurement"`
+		Fields      map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(pubs[0].Data), &p); err != nil || p.Measurement != "uap" || p.Fields["num_sta"] != 5.0 {
+		t.Errorf("wrong payload %s: %v", pubs[0].Data, err)
+	}
+	if a := f.connects()[0]; a.User != "poller" || a.Pass != "secret" || a.Name != "unifi-poller" {
+		t.Errorf("wrong CONNECT: %+v", a)
+	}
+}
+
+func TestNATSOutputJetStream(t *testing.T) {
+	f := newFakeNATS(t)
+	c := testNATSConfig(f.url())
+	c.NATSJetStream = true
+	c.NATSSubject = "unifi.{measurement}"
+	n, err := NewNATSOutput(c)
+	if err != nil {
+		t.Fatalf("NewNATSOutput: %v", err)
+	}
+	defer n.Close()
+	ok := testPoint(t, "uap", nil, map[string]interface{}{"num_sta": 5})
+	if err := n.WriteMetrics(testMetrics(t, ok, ok)); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	bad := testPoint(t, "fail", nil, map[string]interface{}{"x": 1})
+	err = n.WriteMetrics(testMetrics(t, ok, bad, bad))
+	if err == nil || !strings.Contains(err.Error(), "2 of 3 jetstream publishes failed") {
+		t.Errorf("wrong error for failed acks: %v", err)
+	}
+	for _, p := range f.published() {
+		if !strings.HasPrefix(p.Reply, "_INBOX.") {
+			t.Errorf("jetstream publish without an inbox reply subject: %+v", p)
+		}
+	}
+}
+
+func TestNATSOutputAuthError(t *testing.T) {
+	f := newFakeNATS(t)
+	c := testNATSConfig(f.url())
+	c.NATSUser = "bad"
+	if _, err := NewNATSOutput(c); err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("wrong error for a rejected login: %v", err)
+	}
+}
+
+func TestNATSCredentials(t *testing.T) {
+	f := newFakeNATS(t)
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := user.Seed()
+	creds := filepath.Join(t.TempDir(), "user.creds")
+	contents := "-----BEGIN NATS USER JWT-----\neyJ0eXAiOiJKV1QifQ.test.jwt\n------END NATS USER JWT------\n\n" +
+		"************************* IMPORTANT *************************\n\n" +
+		"-----BEGIN USER NKEY SEED-----\n" + string(seed) + "\n------END USER NKEY SEED------\n"
+	if err := ioutil.WriteFile(creds, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := testNATSConfig(f.url())
+	c.NATSCreds = creds
+	n, err := NewNATSOutput(c)
+	if err != nil {
+		t.Fatalf("NewNATSOutput: %v", err)
+	}
+	defer n.Close()
+	a := f.connects()[0]
+	if a.JWT != "eyJ0eXAiOiJKV1QifQ.test.jwt" {
+		t.Errorf("wrong jwt: %q", a.JWT)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(a.Sig)
+	if err != nil {
+		t.Fatalf("decoding signature: %v", err)
+	}
+	if err := user.Verify([]byte(f.nonce), sig); err != nil {
+		t.Errorf("nonce signature does not verify: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package unifipoller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+const (
+	opentsdbPutPath     = "/api/put?details"
+	opentsdbHTTPTimeout = 30 * time.Second
+)
+
+// OpenTSDBOutput posts every numeric field to the OpenTSDB /api/put endpoint.
+// Metric names are prefix.measurement.field. Only whitelisted tags are sent,
+// since OpenTSDB limits the number of tags on a data point.
+type OpenTSDBOutput struct {
+	URL       string
+	Prefix    string
+	Tags      []string
+	MaxTags   int
+	BatchSize int
+	client    *http.Client
+}
+
+// opentsdbPoint is one data point in a put request.
+type opentsdbPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// opentsdbResponse is the body returned by a put request with details.
+type opentsdbResponse struct {
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Errors  []struct {
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+// NewOpenTSDBOutput returns an OpenTSDB output from the config.
+func NewOpenTSDBOutput(c *Config) (*OpenTSDBOutput, error) {
+	client, err := newHTTPClient(opentsdbHTTPTimeout, true, "")
+	if err != nil {
+		return nil, err
+	}
+	o := &OpenTSDBOutput{
+		URL:       strings.TrimRight(c.OpenTSDBURL, "/"),
+		Prefix:    opentsdbSanitize(strings.Trim(c.OpenTSDBPrefix, ".")),
+		Tags:      c.OpenTSDBTags,
+		MaxTags:   c.OpenTSDBMaxTags,
+		BatchSize: c.OpenTSDBBatchSize,
+		client:    client,
+	}
+	if o.MaxTags < 1 {
+		return nil, fmt.Errorf("opentsdb_max_tags must be at least 1")
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = defaultOpenTSDBBatchSize
+	}
+	return o, nil
+}
+
+// Name satisfies the Output interface.
+func (o *OpenTSDBOutput) Name() string {
+	return "opentsdb output"
+}
+
+// Close closes idle connections to OpenTSDB.
+func (o *OpenTSDBOutput) Close() error {
+	o.client.CloseIdleConnections()
+	return nil
+}
+
+// WriteMetrics converts the points and posts them in chunks of BatchSize
+// data points, so large sites do not exceed the server's request size limit.
+func (o *OpenTSDBOutput) WriteMetrics(m *Metrics) error {
+	data := []*opentsdbPoint{}
+	for _, p := range m.Points() {
+		d, err := o.dataPoints(p)
+		if err != nil {
+			return err
+		}
+		data = append(data, d...)
+	}
+	for i := 0; i < len(data); i += o.BatchSize {
+		end := i + o.BatchSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := o.put(data[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataPoints returns a data point for each numeric field in a point. Strings,
+// NaN and infinite values are skipped; booleans are sent as 0 or 1.
+func (o *OpenTSDBOutput) dataPoints(p *influx.Point) ([]*opentsdbPoint, error) {
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tags := o.tags(p.Tags())
+	data := []*opentsdbPoint{}
+	for name, v := range fields {
+		if _, ok := v.(string); ok {
+			continue
+		}
+		val, ok := fieldFloat(v)
+		if !ok || math.IsNaN(val) || math.IsInf(val, 0) {
+			continue
+		}
+		data = append(data, &opentsdbPoint{Metric: o.metricName(p.Name(), name),
+			Timestamp: p.Time().UnixNano() / int64(time.Millisecond), Value: val, Tags: tags})
+	}
+	return data, nil
+}
+
+// tags returns the whitelisted tags a point has, in whitelist order, up to
+// MaxTags. OpenTSDB requires at least one tag; source is used when none match.
+func (o *OpenTSDBOutput) tags(tags map[string]string) map[string]string {
+	t := make(map[string]string)
+	for _, name := range o.Tags {
+		if v := opentsdbSanitize(tags[name]); v != "" && len(t) < o.MaxTags {
+			t[opentsdbSanitize(name)] = v
+		}
+	}
+	if len(t) == 0 {
+		t["source"] = "unifi-poller"
+	}
+	return t
+}
+
+// metricName returns prefix.measurement.field with invalid characters replaced.
+func (o *OpenTSDBOutput) metricName(measurement, field string) string {
+	name := opentsdbSanitize(measurement) + "." + opentsdbSanitize(field)
+	if o.Prefix != "" {
+		name = o.Prefix + "." + name
+	}
+	return name
+}
+
+// put sends one chunk of data points. The server's details, including the
+// first error, are returned when any data point fails.
+func (o *OpenTSDBOutput) put(data []*opentsdbPoint) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Post(o.URL+opentsdbPutPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	var r opentsdbResponse
+	if json.Unmarshal(b, &r) == nil && r.Failed > 0 {
+		msg := ""
+		if len(r.Errors) > 0 {
+			msg = ": " + r.Errors[0].Error
+		}
+		return fmt.Errorf("opentsdb: %d of %d data points failed%s", r.Failed, r.Failed+r.Success, msg)
+	}
+	return fmt.Errorf("opentsdb: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
+
+// opentsdbSanitize replaces characters OpenTSDB does not allow in metric names
+// and tags. Letters, numbers, -, _, . and / are allowed.
+func opentsdbSanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.', r == '/':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
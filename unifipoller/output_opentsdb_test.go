@@ -0,0 +1,126 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenTSDBOutput(t *testing.T) {
+	requests := make(chan []*opentsdbPoint, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data []*opentsdbPoint
+		if r.URL.Path != "/api/put" || r.URL.RawQuery != "details" || json.NewDecoder(r.Body).Decode(&data) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		requests <- data
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	c := defaultConfig()
+	c.OpenTSDBURL, c.OpenTSDBTags, c.OpenTSDBBatchSize = srv.URL+"/", []string{"site_name", "name", "mac"}, 2
+	o, err := NewOpenTSDBOutput(c)
+	if err != nil {
+		t.Fatalf("NewOpenTSDBOutput: %v", err)
+	}
+	m := testMetrics(t,
+		testPoint(t, "uap", map[string]string{"site_name": "default", "name": "Office AP", "mac": "aa:bb", "ip": "10.0.0.5"},
+			map[string]interface{}{"cpu": 12.5, "num_sta": 4, "model": "U7PG2", "has_fan": true}),
+		testPoint(t, "clients", map[string]string{"hostname": "laptop"}, map[string]interface{}{"rssi": -40}))
+	if err := o.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	close(requests)
+	got := map[string]*opentsdbPoint{}
+	batches := 0
+	for data := range requests {
+		if batches++; len(data) != 2 {
+			t.Errorf("want batches of 2 data points, got %d", len(data))
+		}
+		for _, d := range data {
+			got[d.Metric] = d
+		}
+	}
+	if batches != 2 || len(got) != 4 {
+		t.Fatalf("want 4 data points (the string is skipped) in 2 requests, got %d in %d", len(got), batches)
+	}
+	cpu := got["unifi.uap.cpu"]
+	if cpu == nil || cpu.Value != 12.5 || cpu.Timestamp != testTime.UnixNano()/1e6 {
+		t.Fatalf("wrong cpu data point: %+v", cpu)
+	}
+	if want := map[string]string{"site_name": "default", "name": "Office_AP", "mac": "aa_bb"}; !reflect.DeepEqual(cpu.Tags, want) {
+		t.Errorf("tags = %v, want %v", cpu.Tags, want)
+	}
+	if fan := got["unifi.uap.has_fan"]; fan == nil || fan.Value != 1 {
+		t.Errorf("a boolean should be sent as 1: %+v", fan)
+	}
+	// OpenTSDB needs a tag; a point without whitelisted tags gets source.
+	if rssi := got["unifi.clients.rssi"]; rssi == nil || !reflect.DeepEqual(rssi.Tags, map[string]string{"source": "unifi-poller"}) {
+		t.Errorf("wrong fallback tag: %+v", rssi)
+	}
+}
+
+func TestOpenTSDBTags(t *testing.T) {
+	o := &OpenTSDBOutput{Tags: []string{"site_name", "name", "mac", "radio"}, MaxTags: 2}
+	tags := map[string]string{"radio": "ng", "mac": "aa:bb", "name": "", "site_name": "default"}
+	// Empty values are skipped, and the whitelist order decides which tags fit.
+	if got, want := o.tags(tags), map[string]string{"site_name": "default", "mac": "aa_bb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+}
+
+func TestOpenTSDBSanitize(t *testing.T) {
+	for in, want := range map[string]string{
+		"rx_bytes-r":      "rx_bytes-r",
+		"Office AP (2nd)": "Office_AP__2nd_",
+		"aa:bb:cc":        "aa_bb_cc",
+		"site/name.v1":    "site/name.v1",
+		"café":            "caf_",
+		"":                "",
+	} {
+		if got := opentsdbSanitize(in); got != want {
+			t.Errorf("opentsdbSanitize(%q) = %q, want %q", in, got, want)
+		}
+	}
+	o := &OpenTSDBOutput{Prefix: "unifi"}
+	if got := o.metricName("usw_ports", "rx bytes"); got != "unifi.usw_ports.rx_bytes" {
+		t.Errorf("metricName = %s", got)
+	}
+	if o.Prefix = ""; o.metricName("uap", "cpu") != "uap.cpu" {
+		t.Errorf("metricName without a prefix = %s", o.metricName("uap", "cpu"))
+	}
+}
+
+func TestOpenTSDBPutErrors(t *testing.T) {
+	m := testMetrics(t, testPoint(t, "uap", map[string]string{"name": "AP"}, map[string]interface{}{"cpu": 1.0, "mem": 2.0}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"success":1,"failed":1,"errors":[{"datapoint":{},"error":"Unknown metric"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := defaultConfig()
+	c.OpenTSDBURL = srv.URL
+	o, err := NewOpenTSDBOutput(c)
+	if err != nil {
+		t.Fatalf("NewOpenTSDBOutput: %v", err)
+	}
+	if err := o.WriteMetrics(m); err == nil || err.Error() != "opentsdb: 1 of 2 data points failed: Unknown metric" {
+		t.Errorf("wrong error for failed data points: %v", err)
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "  TSD is shutting down  ", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	o.URL = srv.URL
+	if err := o.WriteMetrics(m); err == nil || !strings.HasSuffix(err.Error(), "503 Service Unavailable: TSD is shutting down") {
+		t.Errorf("wrong error for a server error: %v", err)
+	}
+	if _, err := NewOpenTSDBOutput(&Config{OpenTSDBURL: "http://x", OpenTSDBMaxTags: 0}); err == nil {
+		t.Error("opentsdb_max_tags 0 was accepted")
+	}
+}
@@ -0,0 +1,661 @@
+package unifipoller
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+const (
+	// snmpMaxPacket is the largest UDP payload; responses are never larger.
+	snmpMaxPacket = 65507
+	// snmpMaxBulkVarbinds limits the size of a GetBulk response.
+	snmpMaxBulkVarbinds = 500
+	// snmpUnknownEngineIDs is usmStatsUnknownEngineIDs.0, returned in a Report
+	// to SNMPv3 clients discovering the agent's engine ID.
+	snmpUnknownEngineIDs = ".1.3.6.1.6.3.15.1.1.4.0"
+	// snmpMeasurement is a column name for the point's measurement, not a tag or field.
+	snmpMeasurement = "measurement"
+)
+
+// snmpKind is how a tag or field value is encoded in a MIB column.
+type snmpKind int
+
+const (
+	snmpString    snmpKind = iota // DisplayString
+	snmpInteger                   // INTEGER (Integer32)
+	snmpGauge                     // Gauge32
+	snmpCounter32                 // Counter32; larger values wrap.
+	snmpCounter64                 // Counter64
+	snmpTicks                     // TimeTicks; the value is in seconds.
+	snmpStatus                    // INTEGER up(1) or down(2); true or 1 is up.
+)
+
+// snmpColumn is one column in a MIB table. The value comes from the field, or
+// the tag, called Name. When Subsystem is set, only subsystems points for that
+// subsystem provide the value. Scale multiplies numeric values.
+type snmpColumn struct {
+	Name      string
+	Kind      snmpKind
+	Subsystem string
+	Scale     float64
+}
+
+// snmpTable is a MIB table built from the points of one or more measurements.
+// Points with the same KeyTags are merged into one row; the first value seen
+// for a column wins. With ByMeasurement, points from different measurements
+// are never merged, and the measurement sorts first in the key. Rows are sorted by their key and numbered from 1, so an
+// index may change when devices come and go. Column 1 is the row index, and
+// Columns[n] is column n+2. The table is <base>.<OID>, and its cells are
+// <base>.<OID>.1.<column>.<index>, like any SNMP conceptual table.
+type snmpTable struct {
+	OID           int
+	Measurements  []string
+	KeyTags       []string
+	ByMeasurement bool
+	Columns       []snmpColumn
+}
+
+// snmpTables are the tables in UNIFI-POLLER-MIB; see examples/UNIFI-POLLER-MIB.txt.
+// Only append columns, so the published MIB stays valid.
+var snmpTables = []*snmpTable{{
+	OID:          2, // unifiSiteTable
+	Measurements: []string{"subsystems"},
+	KeyTags:      []string{"name"},
+	Columns: []snmpColumn{
+		{Name: "name"},
+		{Name: "desc"},
+		{Name: "status", Subsystem: "wlan"},
+		{Name: "status", Subsystem: "lan"},
+		{Name: "status", Subsystem: "wan"},
+		{Name: "status", Subsystem: "www"},
+		{Name: "num_user", Kind: snmpGauge, Subsystem: "wlan"},
+		{Name: "num_guest", Kind: snmpGauge, Subsystem: "wlan"},
+		{Name: "num_user", Kind: snmpGauge, Subsystem: "lan"},
+		{Name: "num_guest", Kind: snmpGauge, Subsystem: "lan"},
+		{Name: "num_ap", Kind: snmpGauge, Subsystem: "wlan"},
+		{Name: "num_sw", Kind: snmpGauge, Subsystem: "lan"},
+		{Name: "num_gw", Kind: snmpGauge, Subsystem: "wan"},
+		{Name: "wan_ip", Subsystem: "wan"},
+		{Name: "latency", Kind: snmpGauge, Subsystem: "www"},
+	},
+}, {
+	OID:          3, // unifiDeviceTable
+	Measurements: []string{"uap", "usg", "usw"},
+	KeyTags:      []string{"mac"},
+	// A UDM has a row for each role: the uap, usg and usw points share its MAC.
+	ByMeasurement: true,
+	Columns: []snmpColumn{
+		{Name: "name"},
+		{Name: "mac"},
+		{Name: "type"},
+		{Name: "model"},
+		{Name: "serial"},
+		{Name: "site_name"},
+		{Name: "ip"},
+		{Name: "version"},
+		{Name: "state", Kind: snmpInteger},
+		{Name: "uptime", Kind: snmpTicks},
+		{Name: "cpu", Kind: snmpGauge},
+		{Name: "mem", Kind: snmpGauge},
+		{Name: "num_sta", Kind: snmpGauge},
+		{Name: "rx_bytes", Kind: snmpCounter64},
+		{Name: "tx_bytes", Kind: snmpCounter64},
+		{Name: snmpMeasurement},
+	},
+}, {
+	OID:          4, // unifiPortTable; modeled on IF-MIB's ifTable and ifXTable.
+	Measurements: []string{"usw_ports"},
+	KeyTags:      []string{"device_name", "port_idx"},
+	Columns: []snmpColumn{
+		{Name: "port_id"},
+		{Name: "name"},
+		{Name: "device_name"},
+		{Name: "port_idx", Kind: snmpInteger},
+		{Name: "enable", Kind: snmpStatus},
+		{Name: "up", Kind: snmpStatus},
+		{Name: "speed", Kind: snmpGauge},
+		{Name: "rx_bytes", Kind: snmpCounter64},
+		{Name: "tx_bytes", Kind: snmpCounter64},
+		{Name: "rx_packets", Kind: snmpCounter64},
+		{Name: "tx_packets", Kind: snmpCounter64},
+		{Name: "rx_errors", Kind: snmpCounter32},
+		{Name: "tx_errors", Kind: snmpCounter32},
+		{Name: "rx_dropped", Kind: snmpCounter32},
+		{Name: "tx_dropped", Kind: snmpCounter32},
+		{Name: "poe_power", Kind: snmpGauge, Scale: 1000},
+		{Name: "site_name"},
+	},
+}, {
+	OID:          5, // unifiRadioTable
+	Measurements: []string{"uap_vaps"},
+	KeyTags:      []string{"device_mac", "radio_name"},
+	Columns: []snmpColumn{
+		{Name: "device_name"},
+		{Name: "device_mac"},
+		{Name: "radio_name"},
+		{Name: "radio"},
+		{Name: "channel", Kind: snmpInteger},
+		{Name: "tx_power", Kind: snmpInteger},
+		{Name: "num_sta", Kind: snmpGauge},
+		{Name: "cu_total", Kind: snmpGauge},
+		{Name: "site_name"},
+	},
+}}
+
+// SNMPOutput is a standalone SNMP agent (not an AgentX sub-agent). It answers
+// Get, GetNext and GetBulk requests from a MIB that is rebuilt from the points
+// on every poll. SNMPv2c is enabled with a community, and SNMPv3 with a USM user.
+type SNMPOutput struct {
+	Listen    string
+	Community string
+	BaseOID   []int
+	User      string
+	DebugLog  func(msg string, fmt ...interface{})
+	ErrorLog  func(msg string, fmt ...interface{})
+	conn      net.PacketConn
+	decoder   *gosnmp.GoSNMP
+	usm       *gosnmp.UsmSecurityParameters // nil when v3 is disabled.
+	secLevel  gosnmp.SnmpV3MsgFlags         // lowest accepted v3 security level.
+	start     time.Time
+	reports   uint32
+	mu        sync.RWMutex
+	mib       []*snmpVar // sorted by OID.
+}
+
+// snmpVar is one object instance in the MIB.
+type snmpVar struct {
+	oid []int
+	pdu gosnmp.SnmpPDU
+}
+
+// snmpAuthProtocols and snmpPrivProtocols map config values to USM protocols.
+var (
+	snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{"MD5": gosnmp.MD5, "SHA": gosnmp.SHA,
+		"SHA224": gosnmp.SHA224, "SHA256": gosnmp.SHA256, "SHA384": gosnmp.SHA384, "SHA512": gosnmp.SHA512}
+	snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{"DES": gosnmp.DES, "AES": gosnmp.AES,
+		"AES192": gosnmp.AES192, "AES256": gosnmp.AES256, "AES192C": gosnmp.AES192C, "AES256C": gosnmp.AES256C}
+)
+
+// NewSNMPOutput validates the config, opens the UDP listener and starts answering requests.
+func NewSNMPOutput(c *Config, debugLog, errorLog func(msg string, fmt ...interface{})) (*SNMPOutput, error) {
+	base, err := parseOID(c.SNMPBaseOID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snmp_base_oid: %v", err)
+	}
+	s := &SNMPOutput{
+		Listen:    c.SNMPListen,
+		Community: c.SNMPCommunity,
+		BaseOID:   base,
+		User:      c.SNMPV3User,
+		DebugLog:  debugLog,
+		ErrorLog:  errorLog,
+		start:     time.Now(),
+	}
+	if s.Community == "" && s.User == "" {
+		return nil, fmt.Errorf("set snmp_community (v2c), snmp_v3_user (v3), or both")
+	}
+	if err := s.setupUSM(c); err != nil {
+		return nil, err
+	}
+	s.decoder = &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel,
+		SecurityParameters: s.usm}
+	if s.usm == nil {
+		// The decoder needs security parameters to parse (and then reject) v3 requests.
+		s.decoder.SecurityParameters = &gosnmp.UsmSecurityParameters{}
+	}
+	if s.conn, err = net.ListenPacket("udp", s.Listen); err != nil {
+		return nil, err
+	}
+	_ = s.updateMIB(nil) // Empty until the first poll; this does not fail.
+	go s.serve()
+	return s, nil
+}
+
+// setupUSM builds the agent's USM user from the config. Keys are localized to
+// the engine ID once, here.
+func (s *SNMPOutput) setupUSM(c *Config) error {
+	if s.User == "" {
+		return nil
+	}
+	engineID, err := parseEngineID(c.SNMPEngineID)
+	if err != nil {
+		return fmt.Errorf("invalid snmp_engine_id: %v", err)
+	}
+	s.usm = &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID: engineID,
+		// Boots must increase every time the agent starts; the start time does.
+		AuthoritativeEngineBoots: uint32(s.start.Unix() & math.MaxInt32),
+		UserName:                 s.User,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}
+	s.secLevel = gosnmp.NoAuthNoPriv
+	if c.SNMPV3AuthPass != "" {
+		ok := false
+		if s.usm.AuthenticationProtocol, ok = snmpAuthProtocols[strings.ToUpper(c.SNMPV3AuthProto)]; !ok {
+			return fmt.Errorf("invalid snmp_v3_auth_proto: %s", c.SNMPV3AuthProto)
+		}
+		s.usm.AuthenticationPassphrase, s.secLevel = c.SNMPV3AuthPass, gosnmp.AuthNoPriv
+	}
+	if c.SNMPV3PrivPass != "" {
+		ok := false
+		if s.usm.PrivacyProtocol, ok = snmpPrivProtocols[strings.ToUpper(c.SNMPV3PrivProto)]; !ok {
+			return fmt.Errorf("invalid snmp_v3_priv_proto: %s", c.SNMPV3PrivProto)
+		} else if s.secLevel != gosnmp.AuthNoPriv {
+			return fmt.Errorf("snmp_v3_priv_pass requires snmp_v3_auth_pass")
+		}
+		s.usm.PrivacyPassphrase, s.secLevel = c.SNMPV3PrivPass, gosnmp.AuthPriv
+	}
+	return s.usm.InitSecurityKeys()
+}
+
+// Name satisfies the Output interface.
+func (s *SNMPOutput) Name() string {
+	return "snmp output"
+}
+
+// Close stops the SNMP agent and closes its socket.
+func (s *SNMPOutput) Close() error {
+	return s.conn.Close()
+}
+
+// WriteMetrics rebuilds the MIB from the points. Requests in progress keep
+// using the previous MIB.
+func (s *SNMPOutput) WriteMetrics(m *Metrics) error {
+	points := []*influx.Point{}
+	if m.BatchPoints != nil {
+		points = m.Points()
+	}
+	return s.updateMIB(points)
+}
+
+// updateMIB builds the scalars and tables from the points and replaces the MIB.
+func (s *SNMPOutput) updateMIB(points []*influx.Point) error {
+	mib := []*snmpVar{
+		s.newVar(gosnmp.OctetString, Version, 1, 1, 0),                              // unifiPollerVersion
+		s.newVar(gosnmp.Gauge32, uint32(time.Now().Unix()&math.MaxUint32), 1, 2, 0), // unifiPollerLastUpdate
+	}
+	for i, t := range snmpTables {
+		vars, rows, err := s.buildTable(t, points)
+		if err != nil {
+			return err
+		}
+		mib = append(mib, vars...)
+		// unifiSiteCount, unifiDeviceCount, unifiPortCount and unifiRadioCount.
+		mib = append(mib, s.newVar(gosnmp.Gauge32, uint32(rows), 1, 3+i, 0))
+	}
+	sort.Slice(mib, func(i, j int) bool { return compareOID(mib[i].oid, mib[j].oid) < 0 })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mib = mib
+	return nil
+}
+
+// buildTable returns the cells of one table, and the number of rows.
+func (s *SNMPOutput) buildTable(t *snmpTable, points []*influx.Point) ([]*snmpVar, int, error) {
+	rows := make(map[string][]interface{})
+	keys := [][]string{}
+	for _, p := range points {
+		if !StringInSlice(p.Name(), t.Measurements) {
+			continue
+		}
+		fields, err := p.Fields()
+		if err != nil {
+			return nil, 0, err
+		}
+		tags, key := p.Tags(), []string{}
+		if t.ByMeasurement {
+			key = append(key, p.Name())
+		}
+		for _, k := range t.KeyTags {
+			key = append(key, tags[k])
+		}
+		id := strings.Join(key, "\x00")
+		if rows[id] == nil {
+			rows[id] = make([]interface{}, len(t.Columns))
+			keys = append(keys, key)
+		}
+		for i, col := range t.Columns {
+			if rows[id][i] != nil || (col.Subsystem != "" && tags["subsystem"] != col.Subsystem) {
+				continue
+			}
+			if col.Name == snmpMeasurement {
+				rows[id][i] = p.Name()
+			} else if v, ok := fields[col.Name]; ok && v != nil {
+				rows[id][i] = v
+			} else if v, ok := tags[col.Name]; ok {
+				rows[id][i] = v
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return snmpKeyLess(keys[i], keys[j]) })
+	vars := []*snmpVar{}
+	for idx, key := range keys {
+		vars = append(vars, s.newVar(gosnmp.Integer, idx+1, t.OID, 1, 1, idx+1))
+		for i, v := range rows[strings.Join(key, "\x00")] {
+			if v == nil {
+				continue
+			}
+			if asn, val, ok := t.Columns[i].value(v); ok {
+				vars = append(vars, s.newVar(asn, val, t.OID, 1, i+2, idx+1))
+			}
+		}
+	}
+	return vars, len(keys), nil
+}
+
+// value converts a tag or field value to the column's SNMP type.
+func (col snmpColumn) value(v interface{}) (gosnmp.Asn1BER, interface{}, bool) {
+	if col.Kind == snmpString {
+		return gosnmp.OctetString, formatValue(v), true
+	}
+	if col.Kind == snmpCounter64 {
+		switch val := v.(type) {
+		case uint64:
+			return gosnmp.Counter64, val, true
+		case int64:
+			return gosnmp.Counter64, uint64(val), val >= 0
+		}
+	}
+	if col.Kind == snmpStatus {
+		if b, err := strconv.ParseBool(formatValue(v)); err == nil && b {
+			return gosnmp.Integer, 1, true
+		}
+		return gosnmp.Integer, 2, true
+	}
+	f, ok := fieldFloat(v)
+	if !ok || math.IsNaN(f) {
+		return 0, nil, false
+	}
+	if col.Scale != 0 {
+		f *= col.Scale
+	}
+	switch col.Kind {
+	case snmpInteger:
+		return gosnmp.Integer, int(math.Max(math.MinInt32, math.Min(math.MaxInt32, math.Round(f)))), true
+	case snmpGauge:
+		return gosnmp.Gauge32, uint32(math.Max(0, math.Min(math.MaxUint32, math.Round(f)))), true
+	case snmpTicks:
+		return gosnmp.TimeTicks, uint32(math.Max(0, math.Min(math.MaxUint32, f*100))), true
+	case snmpCounter32:
+		return gosnmp.Counter32, uint32(uint64(math.Max(0, f)) & math.MaxUint32), true
+	default: // snmpCounter64 from a float.
+		return gosnmp.Counter64, uint64(math.Max(0, f)), true
+	}
+}
+
+// newVar returns an object instance under the base OID.
+func (s *SNMPOutput) newVar(asn gosnmp.Asn1BER, value interface{}, sub ...int) *snmpVar {
+	oid := append(append([]int{}, s.BaseOID...), sub...)
+	return &snmpVar{oid: oid, pdu: gosnmp.SnmpPDU{Name: formatOID(oid), Type: asn, Value: value}}
+}
+
+// serve answers requests until the listener fails.
+func (s *SNMPOutput) serve() {
+	buf := make([]byte, snmpMaxPacket)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return // Close() was called.
+		} else if err != nil {
+			s.ErrorLog("SNMP agent stopped: %v", err)
+			return
+		}
+		resp, err := s.handle(append([]byte{}, buf[:n]...))
+		if err != nil {
+			s.DebugLog("SNMP request from %v dropped: %v", addr, err)
+			continue
+		}
+		if _, err := s.conn.WriteTo(resp, addr); err != nil {
+			s.DebugLog("SNMP response to %v: %v", addr, err)
+		}
+	}
+}
+
+// handle decodes and authenticates a request, and returns the encoded response.
+func (s *SNMPOutput) handle(req []byte) ([]byte, error) {
+	// This verifies the digest of authenticated v3 requests and decrypts private ones.
+	pkt, err := s.decoder.UnmarshalTrap(req, true)
+	if err != nil {
+		return nil, err
+	}
+	switch pkt.Version {
+	case gosnmp.Version2c:
+		if s.Community == "" || pkt.Community != s.Community {
+			return nil, fmt.Errorf("unknown community")
+		}
+	case gosnmp.Version3:
+		if s.usm == nil {
+			return nil, fmt.Errorf("snmpv3 is disabled")
+		}
+		sp, ok := pkt.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if !ok {
+			return nil, fmt.Errorf("unsupported security model")
+		}
+		if sp.AuthoritativeEngineID != s.usm.AuthoritativeEngineID {
+			if pkt.MsgFlags&gosnmp.Reportable == 0 {
+				return nil, fmt.Errorf("unknown engine ID")
+			}
+			return s.report(pkt, sp.UserName)
+		} else if sp.UserName != s.User {
+			return nil, fmt.Errorf("unknown user: %s", sp.UserName)
+		} else if pkt.MsgFlags&gosnmp.AuthPriv < s.secLevel {
+			return nil, fmt.Errorf("security level too low for user %s", sp.UserName)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported version: %v", pkt.Version)
+	}
+	return s.respond(pkt)
+}
+
+// respond builds the response PDU for a request and encodes it. GetBulk
+// responses are cut in half until they fit in the client's maximum message size.
+func (s *SNMPOutput) respond(pkt *gosnmp.SnmpPacket) ([]byte, error) {
+	vars, err := s.answer(pkt)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := snmpMaxPacket
+	if pkt.MsgMaxSize >= 484 && pkt.MsgMaxSize < snmpMaxPacket {
+		maxSize = int(pkt.MsgMaxSize)
+	}
+	resp := &gosnmp.SnmpPacket{
+		Version:         pkt.Version,
+		Community:       pkt.Community,
+		MsgFlags:        pkt.MsgFlags &^ gosnmp.Reportable,
+		SecurityModel:   gosnmp.UserSecurityModel,
+		ContextEngineID: pkt.ContextEngineID,
+		ContextName:     pkt.ContextName,
+		PDUType:         gosnmp.GetResponse,
+		MsgID:           pkt.MsgID,
+		RequestID:       pkt.RequestID,
+		MsgMaxSize:      snmpMaxPacket,
+		Variables:       vars,
+	}
+	for {
+		if pkt.Version == gosnmp.Version3 {
+			resp.SecurityParameters = s.securityParameters(pkt.SecurityParameters.(*gosnmp.UsmSecurityParameters).UserName)
+			if err := s.usm.InitPacket(resp); err != nil { // New salt for privacy.
+				return nil, err
+			}
+		}
+		out, err := resp.MarshalMsg()
+		if err != nil || len(out) <= maxSize || pkt.PDUType != gosnmp.GetBulkRequest || len(resp.Variables) < 2 {
+			return out, err
+		}
+		resp.Variables = resp.Variables[:len(resp.Variables)/2]
+	}
+}
+
+// answer returns the variable bindings for a Get, GetNext or GetBulk request.
+func (s *SNMPOutput) answer(pkt *gosnmp.SnmpPacket) ([]gosnmp.SnmpPDU, error) {
+	oids := make([][]int, len(pkt.Variables))
+	for i, v := range pkt.Variables {
+		oid, err := parseOID(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		oids[i] = oid
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vars := []gosnmp.SnmpPDU{}
+	switch pkt.PDUType {
+	case gosnmp.GetRequest:
+		for _, oid := range oids {
+			vars = append(vars, s.get(oid))
+		}
+	case gosnmp.GetNextRequest:
+		for _, oid := range oids {
+			vars = append(vars, s.next(oid).pdu)
+		}
+	case gosnmp.GetBulkRequest:
+		nonRepeaters := int(pkt.NonRepeaters)
+		if nonRepeaters > len(oids) {
+			nonRepeaters = len(oids)
+		}
+		for _, oid := range oids[:nonRepeaters] {
+			vars = append(vars, s.next(oid).pdu)
+		}
+		repeaters := oids[nonRepeaters:]
+		for r := uint32(0); r < pkt.MaxRepetitions && len(repeaters) > 0 && len(vars) < snmpMaxBulkVarbinds; r++ {
+			done := true
+			for i, oid := range repeaters {
+				v := s.next(oid)
+				vars, repeaters[i] = append(vars, v.pdu), v.oid
+				done = done && v.pdu.Type == gosnmp.EndOfMibView
+			}
+			if done {
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PDU type: %v", pkt.PDUType)
+	}
+	return vars, nil
+}
+
+// get returns the object instance with this OID. Missing objects under the
+// base OID are noSuchInstance, others are noSuchObject.
+func (s *SNMPOutput) get(oid []int) gosnmp.SnmpPDU {
+	i := sort.Search(len(s.mib), func(i int) bool { return compareOID(s.mib[i].oid, oid) >= 0 })
+	if i < len(s.mib) && compareOID(s.mib[i].oid, oid) == 0 {
+		return s.mib[i].pdu
+	}
+	if len(oid) > len(s.BaseOID) && compareOID(oid[:len(s.BaseOID)], s.BaseOID) == 0 {
+		return gosnmp.SnmpPDU{Name: formatOID(oid), Type: gosnmp.NoSuchInstance}
+	}
+	return gosnmp.SnmpPDU{Name: formatOID(oid), Type: gosnmp.NoSuchObject}
+}
+
+// next returns the first object instance after this OID, or endOfMibView.
+func (s *SNMPOutput) next(oid []int) *snmpVar {
+	i := sort.Search(len(s.mib), func(i int) bool { return compareOID(s.mib[i].oid, oid) > 0 })
+	if i < len(s.mib) {
+		return s.mib[i]
+	}
+	return &snmpVar{oid: oid, pdu: gosnmp.SnmpPDU{Name: formatOID(oid), Type: gosnmp.EndOfMibView}}
+}
+
+// report returns a usmStatsUnknownEngineIDs Report. v3 clients send a request
+// without an engine ID first, to discover the engine ID, boots and time.
+func (s *SNMPOutput) report(pkt *gosnmp.SnmpPacket, user string) ([]byte, error) {
+	s.reports++
+	sp := s.securityParameters(user)
+	sp.AuthenticationProtocol, sp.PrivacyProtocol = gosnmp.NoAuth, gosnmp.NoPriv
+	resp := &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           gosnmp.NoAuthNoPriv,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: sp,
+		ContextEngineID:    s.usm.AuthoritativeEngineID,
+		PDUType:            gosnmp.Report,
+		MsgID:              pkt.MsgID,
+		RequestID:          pkt.RequestID,
+		MsgMaxSize:         snmpMaxPacket,
+		Variables:          []gosnmp.SnmpPDU{{Name: snmpUnknownEngineIDs, Type: gosnmp.Counter32, Value: s.reports}},
+	}
+	return resp.MarshalMsg()
+}
+
+// securityParameters returns a copy of the agent's USM parameters with the current engine time.
+func (s *SNMPOutput) securityParameters(user string) *gosnmp.UsmSecurityParameters {
+	sp := s.usm.Copy().(*gosnmp.UsmSecurityParameters)
+	sp.UserName = user
+	sp.AuthoritativeEngineTime = uint32(time.Since(s.start).Seconds())
+	return sp
+}
+
+// parseOID parses a dotted OID, with or without a leading dot.
+func parseOID(oid string) ([]int, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(oid), "."), ".")
+	ints := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad OID %q: %v", oid, err)
+		}
+		ints[i] = int(n)
+	}
+	return ints, nil
+}
+
+// formatOID returns an OID in the dotted form gosnmp uses: .1.3.6.1
+func formatOID(oid []int) string {
+	var b strings.Builder
+	for _, n := range oid {
+		b.WriteString("." + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// compareOID orders OIDs lexicographically, the order SNMP walks them in.
+func compareOID(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// parseEngineID decodes a hex engine ID, like 80001f8804756e6966692d706f6c6c6572.
+func parseEngineID(id string) (string, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.ReplaceAll(strings.ToLower(id), ":", ""), "0x"))
+	if err != nil {
+		return "", err
+	} else if len(b) < 5 || len(b) > 32 {
+		return "", fmt.Errorf("must be 5 to 32 bytes")
+	}
+	return string(b), nil
+}
+
+// snmpKeyLess sorts table rows by key; numeric parts (like port numbers) sort numerically.
+func snmpKeyLess(a, b []string) bool {
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(a[i])
+		y, errY := strconv.Atoi(b[i])
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		return a[i] < b[i]
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package unifipoller
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+// testSNMP starts an agent on a random local port with the points in its MIB.
+func testSNMP(t *testing.T, setup func(c *Config), points ...*influx.Point) *SNMPOutput {
+	t.Helper()
+	c := defaultConfig()
+	c.SNMPListen, c.SNMPCommunity = "127.0.0.1:0", "public"
+	if setup != nil {
+		setup(c)
+	}
+	logf := func(msg string, v ...interface{}) { t.Logf(msg, v...) }
+	s, err := NewSNMPOutput(c, logf, logf)
+	if err != nil {
+		t.Fatalf("NewSNMPOutput: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	if err := s.updateMIB(points); err != nil {
+		t.Fatalf("updateMIB: %v", err)
+	}
+	return s
+}
+
+// testSNMPClient returns a client connected to the agent.
+func testSNMPClient(t *testing.T, s *SNMPOutput, setup func(g *gosnmp.GoSNMP)) *gosnmp.GoSNMP {
+	t.Helper()
+	g := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(s.conn.LocalAddr().(*net.UDPAddr).Port),
+		Version: gosnmp.Version2c, Community: "public", Timeout: time.Second, Retries: 1, MaxOids: gosnmp.MaxOids}
+	if setup != nil {
+		setup(g)
+	}
+	if err := g.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { _ = g.Conn.Close() })
+	return g
+}
+
+func TestCompareOID(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want int
+	}{
+		{[]int{1, 3, 6}, []int{1, 3, 6}, 0},
+		{[]int{1, 3, 6}, []int{1, 3, 7}, -1},
+		{[]int{1, 3, 10}, []int{1, 3, 9}, 1},
+		{[]int{1, 3}, []int{1, 3, 6}, -1},
+		{[]int{1, 3, 6, 1}, []int{1, 3, 6}, 1},
+		{[]int{1, 4}, []int{1, 3, 6, 1}, 1},
+	}
+	for _, test := range tests {
+		if got := compareOID(test.a, test.b); (got > 0) != (test.want > 0) || (got < 0) != (test.want < 0) {
+			t.Errorf("compareOID(%v, %v) = %d, want sign of %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSNMPNext(t *testing.T) {
+	s := testSNMP(t, nil, testPoint(t, "usw_ports",
+		map[string]string{"device_name": "Core", "port_idx": "2", "site_name": "default"},
+		map[string]interface{}{"rx_bytes": int64(100)}))
+	base := append([]int{}, s.BaseOID...)
+	first := s.next([]int{1, 3})
+	if want := formatOID(append(base, 1, 1, 0)); first.pdu.Name != want || first.pdu.Value != Version {
+		t.Errorf("next before the base OID = %s %v, want %s (the version)", first.pdu.Name, first.pdu.Value, want)
+	}
+	// A table OID returns its first cell: the index of row 1.
+	cell := s.next(append(base, 4))
+	if want := formatOID(append(base, 4, 1, 1, 1)); cell.pdu.Name != want || cell.pdu.Value != 1 {
+		t.Errorf("next of the port table = %s %v, want %s = 1", cell.pdu.Name, cell.pdu.Value, want)
+	}
+	// Walking visits every object once, in order, then ends.
+	oid, seen := []int{1, 3}, 0
+	for v := s.next(oid); v.pdu.Type != gosnmp.EndOfMibView; v = s.next(oid) {
+		if compareOID(v.oid, oid) <= 0 {
+			t.Fatalf("walk went backwards: %v after %v", v.oid, oid)
+		}
+		oid, seen = v.oid, seen+1
+	}
+	if seen != len(s.mib) {
+		t.Errorf("walk visited %d objects, want %d", seen, len(s.mib))
+	}
+	if end := s.next(oid); end.pdu.Name != formatOID(oid) {
+		t.Errorf("endOfMibView should name the requested OID: %s", end.pdu.Name)
+	}
+}
+
+func TestSNMPDeviceTable(t *testing.T) {
+	// A UDM's uap, usg and usw points share a MAC, but each is a row.
+	tags := map[string]string{"mac": "aa:bb", "name": "Dream Machine", "type": "udm"}
+	s := testSNMP(t, nil,
+		testPoint(t, "usw", tags, map[string]interface{}{"cpu": 5.0, "num_sta": 3}),
+		testPoint(t, "uap", tags, map[string]interface{}{"cpu": 5.0, "num_sta": 7}),
+		testPoint(t, "usg", tags, map[string]interface{}{"cpu": 5.0, "num_sta": 10}),
+		testPoint(t, "uap", map[string]string{"mac": "00:11", "name": "AP"}, map[string]interface{}{"num_sta": 1}))
+	cell := func(column, row int) interface{} {
+		return s.get(append(append([]int{}, s.BaseOID...), 3, 1, column, row)).Value
+	}
+	if count := s.get(append(append([]int{}, s.BaseOID...), 1, 4, 0)).Value; count != uint32(4) {
+		t.Fatalf("unifiDeviceCount = %v, want 4", count)
+	}
+	// Rows sort by measurement, then MAC.
+	for row, want := range []struct {
+		role, mac string
+		clients   uint32
+	}{{"uap", "00:11", 1}, {"uap", "aa:bb", 7}, {"usg", "aa:bb", 10}, {"usw", "aa:bb", 3}} {
+		if cell(17, row+1) != want.role || cell(3, row+1) != want.mac || cell(14, row+1) != want.clients {
+			t.Errorf("row %d = %v %v %v, want %+v", row+1, cell(17, row+1), cell(3, row+1), cell(14, row+1), want)
+		}
+	}
+}
+
+func TestSNMPGetBulkTruncated(t *testing.T) {
+	points := []*influx.Point{}
+	for i := 1; i <= 48; i++ {
+		points = append(points, testPoint(t, "usw_ports",
+			map[string]string{"device_name": "Core", "port_idx": formatValue(i)},
+			map[string]interface{}{"rx_bytes": int64(i), "tx_bytes": int64(i)}))
+	}
+	s := testSNMP(t, func(c *Config) { c.SNMPV3User = "monitor" }, points...)
+	req := &gosnmp.SnmpPacket{
+		Version: gosnmp.Version3, MsgFlags: gosnmp.NoAuthNoPriv, SecurityModel: gosnmp.UserSecurityModel,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{UserName: "monitor",
+			AuthoritativeEngineID: s.usm.AuthoritativeEngineID},
+		ContextEngineID: s.usm.AuthoritativeEngineID, PDUType: gosnmp.GetBulkRequest,
+		MsgID: 1, RequestID: 2, MsgMaxSize: 484, MaxRepetitions: 100,
+		Variables: []gosnmp.SnmpPDU{{Name: formatOID(append(append([]int{}, s.BaseOID...), 4)), Type: gosnmp.Null}},
+	}
+	msg, err := req.MarshalMsg()
+	if err != nil {
+		t.Fatalf("MarshalMsg: %v", err)
+	}
+	out, err := s.handle(msg)
+	if err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(out) > 484 {
+		t.Errorf("response is %d bytes, larger than the client's 484", len(out))
+	}
+	resp, err := s.decoder.SnmpDecodePacket(out)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if n := len(resp.Variables); n == 0 || n >= 100 {
+		t.Errorf("got %d variables, want fewer than 100 but some", n)
+	} else if resp.Variables[0].Name != formatOID(append(append([]int{}, s.BaseOID...), 4, 1, 1, 1)) {
+		t.Errorf("the response should start at the first cell: %s", resp.Variables[0].Name)
+	}
+}
+
+func TestSNMPv3Report(t *testing.T) {
+	s := testSNMP(t, func(c *Config) {
+		c.SNMPCommunity, c.SNMPV3User = "", "monitor"
+		c.SNMPV3AuthPass, c.SNMPV3PrivPass = "authpass123", "privpass123"
+	})
+	// Engine ID discovery: an empty engine ID gets a Report with the agent's.
+	req := &gosnmp.SnmpPacket{
+		Version: gosnmp.Version3, MsgFlags: gosnmp.NoAuthNoPriv | gosnmp.Reportable,
+		SecurityModel: gosnmp.UserSecurityModel, SecurityParameters: &gosnmp.UsmSecurityParameters{},
+		PDUType: gosnmp.GetRequest, MsgID: 7, RequestID: 8, Variables: []gosnmp.SnmpPDU{},
+	}
+	msg, err := req.MarshalMsg()
+	if err != nil {
+		t.Fatalf("MarshalMsg: %v", err)
+	}
+	out, err := s.handle(msg)
+	if err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	resp, err := s.decoder.SnmpDecodePacket(out)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	sp := resp.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if resp.PDUType != gosnmp.Report || resp.MsgID != 7 || sp.AuthoritativeEngineID != s.usm.AuthoritativeEngineID ||
+		len(resp.Variables) != 1 || resp.Variables[0].Name != snmpUnknownEngineIDs {
+		t.Errorf("wrong report: %v", resp)
+	}
+	// Without the reportable flag the request is dropped.
+	req.MsgFlags = gosnmp.NoAuthNoPriv
+	if msg, err = req.MarshalMsg(); err != nil {
+		t.Fatalf("MarshalMsg: %v", err)
+	} else if _, err := s.handle(msg); err == nil {
+		t.Error("an unreportable request with an unknown engine ID was answered")
+	}
+	// A real client discovers the engine ID, then authenticates and decrypts.
+	g := testSNMPClient(t, s, func(g *gosnmp.GoSNMP) {
+		g.Version, g.Community, g.SecurityModel, g.MsgFlags = gosnmp.Version3, "", gosnmp.UserSecurityModel, gosnmp.AuthPriv
+		g.SecurityParameters = &gosnmp.UsmSecurityParameters{UserName: "monitor",
+			AuthenticationProtocol: gosnmp.SHA, AuthenticationPassphrase: "authpass123",
+			PrivacyProtocol: gosnmp.AES, PrivacyPassphrase: "privpass123"}
+	})
+	result, err := g.Get([]string{formatOID(append(append([]int{}, s.BaseOID...), 1, 1, 0))})
+	if err != nil {
+		t.Fatalf("v3 Get: %v", err)
+	}
+	if v := result.Variables[0]; v.Type != gosnmp.OctetString || string(v.Value.([]byte)) != Version {
+		t.Errorf("wrong version: %v", v)
+	}
+}
+
+func TestSNMPv2cWalk(t *testing.T) {
+	s := testSNMP(t, nil, testPoint(t, "subsystems",
+		map[string]string{"name": "default", "subsystem": "wlan", "desc": "Default"},
+		map[string]interface{}{"num_user": 12, "status": "ok"}))
+	vars, err := testSNMPClient(t, s, nil).BulkWalkAll(formatOID(s.BaseOID))
+	if err != nil {
+		t.Fatalf("BulkWalkAll: %v", err)
+	}
+	if len(vars) != len(s.mib) {
+		t.Errorf("walked %d objects, want %d", len(vars), len(s.mib))
+	}
+	wrong := testSNMPClient(t, s, func(g *gosnmp.GoSNMP) { g.Community, g.Timeout, g.Retries = "private", 200*time.Millisecond, 0 })
+	if _, err := wrong.Get([]string{formatOID(s.mib[0].oid)}); err == nil {
+		t.Error("a request with the wrong community was answered")
+	}
+}
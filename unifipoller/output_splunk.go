@@ -0,0 +1,302 @@
+package unifipoller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	"golift.io/unifi"
+)
+
+const (
+	splunkSource       = "unifi-poller"
+	splunkEventPath    = "/services/collector"
+	splunkAckPath      = "/services/collector/ack"
+	splunkAckPollDelay = time.Second
+	splunkHTTPTimeout  = 30 * time.Second
+)
+
+// SplunkOutput sends IDS events and numeric measurements to a Splunk HTTP Event Collector.
+// IDS entries are sent as events. Every numeric field is sent as a metric using the
+// multiple-metric format; the point's tags become dimensions.
+type SplunkOutput struct {
+	URL          string
+	Token        string
+	Index        string
+	MetricsIndex string
+	Sourcetype   string
+	BatchSize    int
+	Ack          bool
+	AckTimeout   time.Duration
+	channel      string
+	client       *http.Client
+	sentIDS      map[string]time.Time // IDS events sent, by ID. The IDS query overlaps the last poll.
+}
+
+// hecEvent is a single HEC payload. Metrics use Event "metric" and put data in Fields.
+type hecEvent struct {
+	Time       float64                `json:"time"`
+	Event      interface{}            `json:"event"`
+	Source     string                 `json:"source,omitempty"`
+	Sourcetype string                 `json:"sourcetype,omitempty"`
+	Index      string                 `json:"index,omitempty"`
+	Host       string                 `json:"host,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+}
+
+// hecResponse is returned by the HEC event endpoint. AckID is only present with indexer acknowledgement.
+type hecResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// NewSplunkOutput returns a Splunk HEC output from the config.
+func NewSplunkOutput(c *Config) (*SplunkOutput, error) {
+	client, err := newHTTPClient(splunkHTTPTimeout, c.SplunkVerifySSL, c.SplunkCAFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &SplunkOutput{
+		URL:          strings.TrimRight(c.SplunkURL, "/"),
+		Token:        c.SplunkToken,
+		Index:        c.SplunkIndex,
+		MetricsIndex: c.SplunkMetricsIndex,
+		Sourcetype:   c.SplunkSourcetype,
+		BatchSize:    c.SplunkBatchSize,
+		Ack:          c.SplunkAck,
+		AckTimeout:   c.SplunkAckTimeout.Duration,
+		client:       client,
+		sentIDS:      make(map[string]time.Time),
+	}
+	if s.BatchSize < 1 {
+		s.BatchSize = defaultSplunkBatchSize
+	}
+	// A channel is required when indexer acknowledgement is enabled on the token.
+	s.channel, err = newUUID()
+	return s, err
+}
+
+// Name satisfies the Output interface.
+func (s *SplunkOutput) Name() string {
+	return "splunk output"
+}
+
+// Close closes idle connections to the Splunk HEC.
+func (s *SplunkOutput) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// WriteMetrics sends IDS events and metrics to the HEC in batches.
+// If acknowledgement is enabled, this waits for the indexer to acknowledge every batch.
+// IDS events already sent are skipped; HEC does not discard duplicates like InfluxDB.
+// Events are recorded as sent per batch, so a failed batch is sent again next poll.
+func (s *SplunkOutput) WriteMetrics(m *Metrics) error {
+	s.forgetIDS(m.IDSList)
+	events := []*hecEvent{}
+	for _, i := range m.IDSList {
+		if _, ok := s.sentIDS[i.ID]; ok {
+			continue
+		}
+		events = append(events, &hecEvent{
+			Time:       hecTime(i.Datetime),
+			Event:      i,
+			Source:     splunkSource,
+			Sourcetype: s.Sourcetype,
+			Index:      s.Index,
+		})
+	}
+	for _, p := range m.Points() {
+		e, err := s.metricEvent(p)
+		if err != nil {
+			return err
+		} else if e != nil {
+			events = append(events, e)
+		}
+	}
+	acks := []int64{}
+	batches := make(map[int64][]*hecEvent) // by ack ID
+	for i := 0; i < len(events); i += s.BatchSize {
+		end := i + s.BatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+		ackID, err := s.send(events[i:end])
+		if err != nil {
+			return err
+		}
+		s.markIDS(events[i:end], true)
+		if ackID != nil {
+			acks = append(acks, *ackID)
+			batches[*ackID] = events[i:end]
+		}
+	}
+	if s.Ack && len(acks) > 0 {
+		pending, err := s.waitAcks(acks)
+		for _, id := range pending {
+			s.markIDS(batches[id], false)
+		}
+		return err
+	}
+	return nil
+}
+
+// markIDS records the IDS events in a batch as sent, or as not sent.
+func (s *SplunkOutput) markIDS(batch []*hecEvent, sent bool) {
+	for _, e := range batch {
+		if i, ok := e.Event.(*unifi.IDS); !ok {
+			continue
+		} else if sent {
+			s.sentIDS[i.ID] = i.Datetime
+		} else {
+			delete(s.sentIDS, i.ID)
+		}
+	}
+}
+
+// forgetIDS forgets the sent IDS events older than the oldest event in this
+// poll's list. The query window only moves forward, so they are not read again.
+func (s *SplunkOutput) forgetIDS(list unifi.IDSList) {
+	if len(list) == 0 {
+		return
+	}
+	oldest := list[0].Datetime
+	for _, i := range list {
+		if i.Datetime.Before(oldest) {
+			oldest = i.Datetime
+		}
+	}
+	for id, t := range s.sentIDS {
+		if t.Before(oldest) {
+			delete(s.sentIDS, id)
+		}
+	}
+}
+
+// metricEvent turns a point into a multiple-metric HEC event.
+// Returns nil if the point has no numeric fields.
+func (s *SplunkOutput) metricEvent(p *influx.Point) (*hecEvent, error) {
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, err
+	}
+	f := make(map[string]interface{})
+	for k, v := range fields {
+		switch val := v.(type) {
+		case float64, int64, uint64:
+			f["metric_name:"+p.Name()+"."+k] = val
+		case bool:
+			f["metric_name:"+p.Name()+"."+k] = boolToInt(val)
+		}
+	}
+	if len(f) == 0 {
+		return nil, nil
+	}
+	for k, v := range p.Tags() {
+		if v != "" {
+			f[k] = v
+		}
+	}
+	return &hecEvent{
+		Time:   hecTime(p.Time()),
+		Event:  "metric",
+		Source: splunkSource,
+		Index:  s.MetricsIndex,
+		Fields: f,
+	}, nil
+}
+
+// send posts one batch of events and returns the ack ID, if there is one.
+func (s *SplunkOutput) send(events []*hecEvent) (*int64, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	resp := &hecResponse{}
+	if err := s.post(s.URL+splunkEventPath, &buf, resp); err != nil {
+		return nil, err
+	} else if resp.Code != 0 {
+		return nil, fmt.Errorf("hec error %d: %s", resp.Code, resp.Text)
+	}
+	return resp.AckID, nil
+}
+
+// waitAcks polls the ack endpoint until every ack ID is acknowledged or the timeout
+// passes. The ack IDs not acknowledged are returned with the error.
+func (s *SplunkOutput) waitAcks(acks []int64) ([]int64, error) {
+	deadline := time.Now().Add(s.AckTimeout)
+	for {
+		body, err := json.Marshal(map[string][]int64{"acks": acks})
+		if err != nil {
+			return acks, err
+		}
+		resp := struct {
+			Acks map[string]bool `json:"acks"`
+		}{}
+		if err := s.post(s.URL+splunkAckPath+"?channel="+s.channel, bytes.NewReader(body), &resp); err != nil {
+			return acks, err
+		}
+		pending := []int64{}
+		for _, id := range acks {
+			if !resp.Acks[fmt.Sprint(id)] {
+				pending = append(pending, id)
+			}
+		}
+		if acks = pending; len(acks) == 0 {
+			return nil, nil
+		} else if time.Now().After(deadline) {
+			return acks, fmt.Errorf("%d batch(es) not acknowledged by indexer after %v", len(acks), s.AckTimeout)
+		}
+		time.Sleep(splunkAckPollDelay)
+	}
+}
+
+// post sends a request to the HEC and decodes the json response into v.
+func (s *SplunkOutput) post(url string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.Token)
+	req.Header.Set("X-Splunk-Request-Channel", s.channel)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil || resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("hec returned %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// hecTime converts a time into epoch seconds with milliseconds.
+func hecTime(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Millisecond)) / 1000
+}
+
+// newUUID returns a random (v4) UUID string.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
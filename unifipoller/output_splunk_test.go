@@ -0,0 +1,151 @@
+package unifipoller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// testHEC is a Splunk HTTP Event Collector. It records the IDS event IDs of
+// each batch it accepts, and rejects or does not acknowledge batches on request.
+type testHEC struct {
+	sync.Mutex
+	batches [][]string
+	reject  map[string]bool // Reject a batch with one of these IDs.
+	unacked map[string]bool // Never acknowledge a batch with one of these IDs.
+	acks    map[int64]bool
+}
+
+func (h *testHEC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	defer h.Unlock()
+	if r.URL.Path == splunkAckPath {
+		var req struct {
+			Acks []int64 `json:"acks"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp := map[string]map[string]bool{"acks": {}}
+		for _, id := range req.Acks {
+			resp["acks"][fmt.Sprint(id)] = h.acks[id]
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	ids, acked := []string{}, true
+	for scanner := bufio.NewScanner(r.Body); scanner.Scan(); {
+		var e struct {
+			Event *unifi.IDS `json:"event"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			http.Error(w, `{"text":"Invalid data format","code":6}`, http.StatusBadRequest)
+			return
+		} else if h.reject[e.Event.ID] {
+			http.Error(w, `{"text":"Server is busy","code":9}`, http.StatusServiceUnavailable)
+			return
+		}
+		acked = acked && !h.unacked[e.Event.ID]
+		ids = append(ids, e.Event.ID)
+	}
+	ackID := int64(len(h.batches))
+	h.batches, h.acks[ackID] = append(h.batches, ids), acked
+	fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, ackID)
+}
+
+// sent returns the batches accepted since the last call.
+func (h *testHEC) sent() [][]string {
+	h.Lock()
+	defer h.Unlock()
+	b := h.batches
+	h.batches = nil
+	return b
+}
+
+// newTestHEC returns a testHEC and its server's URL.
+func newTestHEC(t *testing.T) (*testHEC, *httptest.Server) {
+	hec := &testHEC{reject: map[string]bool{}, unacked: map[string]bool{}, acks: map[int64]bool{}}
+	srv := httptest.NewServer(hec)
+	t.Cleanup(srv.Close)
+	return hec, srv
+}
+
+// testIDS returns an IDS event at testTime plus the provided seconds.
+func testIDS(id string, seconds int) *unifi.IDS {
+	return &unifi.IDS{ID: id, Datetime: testTime.Add(time.Duration(seconds) * time.Second)}
+}
+
+func TestSplunkIDSOverlap(t *testing.T) {
+	hec, srv := newTestHEC(t)
+	s := &SplunkOutput{URL: srv.URL, BatchSize: 100, client: srv.Client(), sentIDS: map[string]time.Time{}}
+	for i, test := range []struct {
+		ids  unifi.IDSList
+		want [][]string
+	}{
+		{unifi.IDSList{testIDS("e1", 0), testIDS("e2", 10)}, [][]string{{"e1", "e2"}}},
+		// The query overlaps the last poll; e3 has the same time as e2, the newest sent.
+		{unifi.IDSList{testIDS("e2", 10), testIDS("e3", 10), testIDS("e4", 20)}, [][]string{{"e3", "e4"}}},
+		{unifi.IDSList{testIDS("e4", 20)}, nil},
+	} {
+		m := testMetrics(t)
+		m.IDSList = test.ids
+		if err := s.WriteMetrics(m); err != nil {
+			t.Fatalf("poll %d: WriteMetrics: %v", i, err)
+		}
+		if got := hec.sent(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("poll %d: sent %v, want %v", i, got, test.want)
+		}
+	}
+	// Events older than the oldest in the poll are out of the window, and forgotten.
+	if len(s.sentIDS) != 1 {
+		t.Errorf("sent events outside the query window were kept: %v", s.sentIDS)
+	}
+}
+
+func TestSplunkFailedBatch(t *testing.T) {
+	hec, srv := newTestHEC(t)
+	s := &SplunkOutput{URL: srv.URL, BatchSize: 1, client: srv.Client(), sentIDS: map[string]time.Time{}}
+	m := testMetrics(t)
+	m.IDSList = unifi.IDSList{testIDS("e1", 0), testIDS("e2", 0), testIDS("e3", 0)}
+	hec.reject["e2"] = true
+	if err := s.WriteMetrics(m); err == nil {
+		t.Fatal("a rejected batch did not return an error")
+	}
+	if got := hec.sent(); !reflect.DeepEqual(got, [][]string{{"e1"}}) {
+		t.Errorf("sent %v, want the batch before the failure", got)
+	}
+	// The batch that was sent is not sent again; the rest are.
+	hec.reject["e2"] = false
+	if err := s.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	if got := hec.sent(); !reflect.DeepEqual(got, [][]string{{"e2"}, {"e3"}}) {
+		t.Errorf("sent %v, want e2 and e3", got)
+	}
+}
+
+func TestSplunkUnacknowledgedBatch(t *testing.T) {
+	hec, srv := newTestHEC(t)
+	s := &SplunkOutput{URL: srv.URL, BatchSize: 1, Ack: true, client: srv.Client(), sentIDS: map[string]time.Time{}}
+	m := testMetrics(t)
+	m.IDSList = unifi.IDSList{testIDS("e1", 0), testIDS("e2", 0)}
+	hec.unacked["e2"] = true
+	if err := s.WriteMetrics(m); err == nil {
+		t.Fatal("an unacknowledged batch did not return an error")
+	}
+	hec.sent()
+	// Only the batch the indexer did not acknowledge is sent again.
+	hec.unacked["e2"] = false
+	if err := s.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	if got := hec.sent(); !reflect.DeepEqual(got, [][]string{{"e2"}}) {
+		t.Errorf("sent %v, want e2 only", got)
+	}
+}
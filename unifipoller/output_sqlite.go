@@ -0,0 +1,133 @@
+package unifipoller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+	_ "modernc.org/sqlite" // database/sql driver named "sqlite". Pure Go; no cgo.
+)
+
+// sqliteSchema creates the history table. Tags and fields are stored as JSON.
+// The key and name columns are what the query command looks up. The key is a
+// device or client MAC, or "switch name:port index" for switch ports. The name
+// is the device or client name, or the port_id tag for switch ports.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS points (
+	time        INTEGER NOT NULL,
+	measurement TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	tags        TEXT NOT NULL,
+	fields      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS points_key ON points (measurement, key, time);
+CREATE INDEX IF NOT EXISTS points_name ON points (measurement, name, time);
+CREATE INDEX IF NOT EXISTS points_time ON points (time);`
+
+// SQLiteOutput stores a rolling window of points in a local SQLite database.
+// The query command reads this database, so the poller is useful without
+// running a separate database server.
+type SQLiteOutput struct {
+	*sql.DB
+	Path      string
+	Retention time.Duration
+}
+
+// NewSQLiteOutput opens (or creates) the database and makes sure the schema exists.
+func NewSQLiteOutput(c *Config) (*SQLiteOutput, error) {
+	db, err := openSQLite(c.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteOutput{DB: db, Path: c.SQLitePath, Retention: c.SQLiteRetention.Duration}, nil
+}
+
+// openSQLite opens a database with a busy timeout, so the query command and
+// the poller can use it at the same time. WAL mode allows reading while writing.
+// The pool is kept to one connection, so the busy timeout set here applies to
+// every statement; pragmas only affect the connection they run on.
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	for _, pragma := range []string{"PRAGMA busy_timeout = 5000", "PRAGMA journal_mode = WAL"} {
+		if _, err := db.Exec(pragma); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Name satisfies the Output interface.
+func (s *SQLiteOutput) Name() string {
+	return "sqlite output"
+}
+
+// WriteMetrics inserts every point in one transaction, then deletes points
+// older than the retention window.
+func (s *SQLiteOutput) WriteMetrics(m *Metrics) error {
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	if err := s.insert(tx, m.Points()); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if s.Retention > 0 {
+		if _, err := tx.Exec("DELETE FROM points WHERE time < ?", time.Now().Add(-s.Retention).Unix()); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insert adds the points to the points table.
+func (s *SQLiteOutput) insert(tx *sql.Tx, points []*influx.Point) error {
+	stmt, err := tx.Prepare("INSERT INTO points (time, measurement, key, name, tags, fields) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range points {
+		fields, err := p.Fields()
+		if err != nil {
+			return err
+		}
+		tags := p.Tags()
+		tagJSON, err := json.Marshal(tags)
+		if err != nil {
+			return err
+		}
+		fieldJSON, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		key, name := sqliteKey(p.Name(), tags)
+		if _, err := stmt.Exec(p.Time().Unix(), p.Name(), key, name, string(tagJSON), string(fieldJSON)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteKey returns the lookup key and name for a point. Both are lower case.
+func sqliteKey(measurement string, tags map[string]string) (string, string) {
+	if measurement == "usw_ports" {
+		port := strings.ToLower(tags["device_name"] + ":" + tags["port_idx"])
+		return port, strings.ToLower(tags["port_id"])
+	}
+	return strings.ToLower(tags["mac"]), strings.ToLower(tags["name"])
+}
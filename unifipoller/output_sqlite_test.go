@@ -0,0 +1,62 @@
+package unifipoller
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+func TestSQLiteOutput(t *testing.T) {
+	c := &Config{SQLitePath: filepath.Join(t.TempDir(), "history.db"), SQLiteRetention: Duration{time.Hour}}
+	s, err := NewSQLiteOutput(c)
+	if err != nil {
+		t.Fatalf("NewSQLiteOutput: %v", err)
+	}
+	defer s.Close()
+	var (
+		mode    string
+		timeout int
+	)
+	if err := s.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q (%v), want wal", mode, err)
+	}
+	if err := s.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil || timeout != 5000 {
+		t.Errorf("busy_timeout = %d (%v), want 5000", timeout, err)
+	}
+	tags := map[string]string{"mac": "AA:BB:CC:00:11:22", "name": "Office AP"}
+	recent, _ := influx.NewPoint("uap", tags, map[string]interface{}{"num_sta": 5}, time.Now())
+	expired, _ := influx.NewPoint("uap", tags, map[string]interface{}{"num_sta": 3}, time.Now().Add(-2*time.Hour))
+	if err := s.WriteMetrics(testMetrics(t, recent, expired)); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	var (
+		count      int
+		key, name  string
+		fieldsJSON string
+	)
+	if err := s.QueryRow("SELECT COUNT(*), key, name, fields FROM points").Scan(&count, &key, &name, &fieldsJSON); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if count != 1 || key != "aa:bb:cc:00:11:22" || name != "office ap" || fieldsJSON != `{"num_sta":5}` {
+		t.Errorf("wrong rows after retention: count=%d key=%q name=%q fields=%s", count, key, name, fieldsJSON)
+	}
+}
+
+func TestSQLiteKey(t *testing.T) {
+	tests := []struct {
+		measurement string
+		tags        map[string]string
+		key, name   string
+	}{
+		{"uap", map[string]string{"mac": "AA:BB", "name": "Office AP"}, "aa:bb", "office ap"},
+		{"clients", map[string]string{"mac": "CC:DD", "name": "Laptop"}, "cc:dd", "laptop"},
+		{"usw_ports", map[string]string{"device_name": "Core", "port_idx": "3", "port_id": "Core Port 3"}, "core:3", "core port 3"},
+	}
+	for _, test := range tests {
+		if key, name := sqliteKey(test.measurement, test.tags); key != test.key || name != test.name {
+			t.Errorf("sqliteKey(%s) = %q, %q, want %q, %q", test.measurement, key, name, test.key, test.name)
+		}
+	}
+}
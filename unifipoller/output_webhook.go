@@ -0,0 +1,276 @@
+package unifipoller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// webhookRetryDelay is how long to wait before retrying a failed webhook.
+const webhookRetryDelay = time.Second
+
+// WebhookConfig is a single webhook endpoint in the config file.
+// Webhooks may only be configured in a config file; not with env variables.
+type WebhookConfig struct {
+	URL          string   `json:"url" toml:"url" xml:"url" yaml:"url"`
+	Method       string   `json:"method" toml:"method" xml:"method" yaml:"method"`
+	Per          string   `json:"per" toml:"per" xml:"per" yaml:"per"`
+	Template     string   `json:"template" toml:"template" xml:"template" yaml:"template"`
+	TemplateFile string   `json:"template_file" toml:"template_file" xml:"template_file" yaml:"template_file"`
+	ContentType  string   `json:"content_type" toml:"content_type" xml:"content_type" yaml:"content_type"`
+	Headers      []string `json:"headers" toml:"headers" xml:"headers" yaml:"headers"`
+	User         string   `json:"user" toml:"user" xml:"user" yaml:"user"`
+	Pass         string   `json:"pass" toml:"pass" xml:"pass" yaml:"pass"`
+	Retries      int      `json:"retries" toml:"retries" xml:"retries" yaml:"retries"`
+	Timeout      Duration `json:"timeout" toml:"timeout" xml:"timeout" yaml:"timeout"`
+	VerifySSL    bool     `json:"verify_ssl" toml:"verify_ssl" xml:"verify_ssl" yaml:"verify_ssl"`
+}
+
+// WebhookData is passed into webhook templates. Metrics is always set. Site is
+// set when rendering per site or per device; Sites, Clients, IDSList and the
+// devices in Metrics are then limited to that site. Device and Type are only set
+// when rendering per device; Type is one of uap, usg, usw or udm.
+type WebhookData struct {
+	*Metrics
+	Site   *unifi.Site
+	Device interface{}
+	Type   string
+}
+
+// WebhookOutput renders a template and sends it to each configured endpoint.
+// Templates are rendered once per poll, once per site or once per device.
+type WebhookOutput struct {
+	hooks []*webhook
+}
+
+// webhook is a parsed WebhookConfig.
+type webhook struct {
+	*WebhookConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+// webhookFuncs are available in webhook templates, in addition to the built-ins.
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// NewWebhookOutput validates the webhook configs and parses their templates.
+func NewWebhookOutput(configs []*WebhookConfig) (*WebhookOutput, error) {
+	w := &WebhookOutput{}
+	for i, c := range configs {
+		h, err := newWebhook(c)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d (%s): %v", i+1, c.URL, err)
+		}
+		w.hooks = append(w.hooks, h)
+	}
+	return w, nil
+}
+
+// newWebhook sets defaults and parses the template for a single webhook.
+func newWebhook(c *WebhookConfig) (*webhook, error) {
+	if c.Method == "" {
+		c.Method = "POST"
+	}
+	if c.ContentType == "" {
+		c.ContentType = "application/json"
+	}
+	if c.Timeout.Duration == 0 {
+		c.Timeout.Duration = defaultWebhookTimeout
+	}
+	if c.Per = strings.ToLower(c.Per); c.Per == "" {
+		c.Per = "poll"
+	} else if !StringInSlice(c.Per, []string{"poll", "site", "device"}) {
+		return nil, fmt.Errorf("invalid per value: %s (use poll, site or device)", c.Per)
+	}
+	if c.TemplateFile != "" {
+		b, err := ioutil.ReadFile(c.TemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Template = string(b)
+	}
+	tmpl, err := template.New(c.URL).Funcs(webhookFuncs).Parse(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(c.Timeout.Duration, c.VerifySSL, "")
+	return &webhook{WebhookConfig: c, tmpl: tmpl, client: client}, err
+}
+
+// Name satisfies the Output interface.
+func (w *WebhookOutput) Name() string {
+	return "webhook output"
+}
+
+// Close closes idle connections to the webhook endpoints.
+func (w *WebhookOutput) Close() error {
+	for _, h := range w.hooks {
+		h.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// WriteMetrics renders and sends every webhook. All webhooks are attempted;
+// the first error is returned.
+func (w *WebhookOutput) WriteMetrics(m *Metrics) error {
+	var firstErr error
+	for _, h := range w.hooks {
+		for _, data := range h.data(m) {
+			if err := h.send(data); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", h.URL, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// data returns the template data for each request this webhook sends.
+func (h *webhook) data(m *Metrics) []*WebhookData {
+	switch h.Per {
+	case "site":
+		data := []*WebhookData{}
+		for _, s := range m.Sites {
+			data = append(data, &WebhookData{Metrics: siteMetrics(m, s), Site: s})
+		}
+		return data
+	case "device":
+		return deviceWebhookData(m)
+	default:
+		return []*WebhookData{{Metrics: m}}
+	}
+}
+
+// deviceWebhookData returns template data for every device, including its site.
+func deviceWebhookData(m *Metrics) []*WebhookData {
+	data := []*WebhookData{}
+	if m.Devices == nil {
+		return data
+	}
+	sites := make(map[string]*WebhookData)
+	for _, s := range m.Sites {
+		sites[s.ID] = &WebhookData{Metrics: siteMetrics(m, s), Site: s}
+	}
+	add := func(siteID string, d interface{}, kind string) {
+		if site := sites[siteID]; site != nil {
+			data = append(data, &WebhookData{Metrics: site.Metrics, Site: site.Site, Device: d, Type: kind})
+		} else {
+			data = append(data, &WebhookData{Metrics: m, Device: d, Type: kind})
+		}
+	}
+	for _, d := range m.UAPs {
+		add(d.SiteID, d, "uap")
+	}
+	for _, d := range m.USGs {
+		add(d.SiteID, d, "usg")
+	}
+	for _, d := range m.USWs {
+		add(d.SiteID, d, "usw")
+	}
+	for _, d := range m.UDMs {
+		add(d.SiteID, d, "udm")
+	}
+	return data
+}
+
+// siteMetrics returns a copy of the metrics with the sites, clients, IDS events
+// and devices limited to a single site. Everything else is shared with m.
+func siteMetrics(m *Metrics, site *unifi.Site) *Metrics {
+	sm := *m
+	sm.Sites = unifi.Sites{site}
+	sm.Clients, sm.IDSList = nil, nil
+	for _, c := range m.Clients {
+		if c.SiteID == site.ID {
+			sm.Clients = append(sm.Clients, c)
+		}
+	}
+	for _, i := range m.IDSList {
+		if i.SiteID == site.ID {
+			sm.IDSList = append(sm.IDSList, i)
+		}
+	}
+	if m.Devices == nil {
+		return &sm
+	}
+	sm.Devices = &unifi.Devices{}
+	for _, d := range m.UAPs {
+		if d.SiteID == site.ID {
+			sm.UAPs = append(sm.UAPs, d)
+		}
+	}
+	for _, d := range m.USGs {
+		if d.SiteID == site.ID {
+			sm.USGs = append(sm.USGs, d)
+		}
+	}
+	for _, d := range m.USWs {
+		if d.SiteID == site.ID {
+			sm.USWs = append(sm.USWs, d)
+		}
+	}
+	for _, d := range m.UDMs {
+		if d.SiteID == site.ID {
+			sm.UDMs = append(sm.UDMs, d)
+		}
+	}
+	return &sm
+}
+
+// send renders the template and sends the request, retrying on failure.
+func (h *webhook) send(data *WebhookData) error {
+	var body bytes.Buffer
+	if err := h.tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+	var err error
+	for i := 0; i <= h.Retries; i++ {
+		if i > 0 {
+			time.Sleep(webhookRetryDelay)
+		}
+		if err = h.do(body.Bytes()); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// do sends a single request.
+func (h *webhook) do(body []byte) error {
+	req, err := http.NewRequest(h.Method, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", h.ContentType)
+	for _, header := range h.Headers {
+		if s := strings.SplitN(header, ":", 2); len(s) == 2 {
+			req.Header.Set(strings.TrimSpace(s[0]), strings.TrimSpace(s[1]))
+		}
+	}
+	if h.User != "" {
+		req.SetBasicAuth(h.User, h.Pass)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package unifipoller
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golift.io/unifi"
+)
+
+// testWebhookMetrics has two sites, each with a client, an IDS event and a device.
+func testWebhookMetrics(t *testing.T) *Metrics {
+	t.Helper()
+	m := testMetrics(t)
+	m.Sites = unifi.Sites{{ID: "s1", Name: "default"}, {ID: "s2", Name: "lab"}}
+	m.Clients = unifi.Clients{{SiteID: "s1", Mac: "bb:01"}, {SiteID: "s2", Mac: "bb:02"}, {SiteID: "s2", Mac: "bb:03"}}
+	m.IDSList = unifi.IDSList{{SiteID: "s2"}}
+	m.Devices = &unifi.Devices{UAPs: []*unifi.UAP{{SiteID: "s1", Name: "Office"}},
+		USWs: []*unifi.USW{{SiteID: "s2", Name: "Lab Switch"}}, UDMs: []*unifi.UDM{{SiteID: "s9", Name: "Elsewhere"}}}
+	return m
+}
+
+// testWebhook sends the metrics to a webhook and returns the sorted request bodies.
+func testWebhook(t *testing.T, per, tmpl string, m *Metrics) []string {
+	t.Helper()
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+	}))
+	defer srv.Close()
+	w, err := NewWebhookOutput([]*WebhookConfig{{URL: srv.URL, Per: per, Template: tmpl}})
+	if err != nil {
+		t.Fatalf("NewWebhookOutput: %v", err)
+	}
+	if err := w.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	close(bodies)
+	got := []string{}
+	for b := range bodies {
+		got = append(got, b)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestWebhookPerSite(t *testing.T) {
+	m := testWebhookMetrics(t)
+	tmpl := `{{.Site.Name}}: sites {{len .Sites}}, clients {{len .Clients}}, ids {{len .IDSList}}, ` +
+		`uaps {{len .UAPs}}, usws {{len .USWs}}, udms {{len .UDMs}}`
+	want := []string{
+		"default: sites 1, clients 1, ids 0, uaps 1, usws 0, udms 0",
+		"lab: sites 1, clients 2, ids 1, uaps 0, usws 1, udms 0",
+	}
+	if got := testWebhook(t, "site", tmpl, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("per site bodies:\n%q\nwant:\n%q", got, want)
+	}
+	// Per site copies are filtered; the poll's metrics are not changed.
+	if len(m.Sites) != 2 || len(m.Clients) != 3 || len(m.IDSList) != 1 || len(m.UAPs) != 1 || len(m.UDMs) != 1 {
+		t.Errorf("the poll's metrics were changed: %+v", m)
+	}
+	want = []string{"clients 3, ids 1"}
+	if got := testWebhook(t, "poll", `clients {{len .Clients}}, ids {{len .IDSList}}`, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("per poll bodies = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookPerDevice(t *testing.T) {
+	tmpl := `{{.Type}} {{.Device.Name}}{{with .Site}} in {{.Name}}{{end}}: clients {{len .Clients}}`
+	// A device in a site that was not polled gets the whole poll's data.
+	want := []string{
+		"uap Office in default: clients 1",
+		"udm Elsewhere: clients 3",
+		"usw Lab Switch in lab: clients 2",
+	}
+	if got := testWebhook(t, "device", tmpl, testWebhookMetrics(t)); !reflect.DeepEqual(got, want) {
+		t.Errorf("per device bodies:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -0,0 +1,288 @@
+package unifipoller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+const (
+	zabbixTimeout   = 30 * time.Second
+	zabbixBatchSize = 1000
+)
+
+// zabbixHeader starts every Zabbix sender protocol packet.
+var zabbixHeader = []byte("ZBXD\x01")
+
+// zabbixLLD is a low-level discovery rule built from the tags on a measurement.
+// Macros maps LLD macro names to tag names. KeyTags are the tags that make up
+// the item key parameters. Item keys look like: unifi.<measurement>["<key tags>","<field>"]
+type zabbixLLD struct {
+	Key          string
+	Measurements []string
+	Macros       map[string]string
+	KeyTags      []string
+}
+
+// zabbixDiscoveries are the discovery rules sent to Zabbix. Only measurements
+// listed here have their item values sent. {#MEASUREMENT} is added to every rule.
+var zabbixDiscoveries = []*zabbixLLD{{
+	Key:          "unifi.site.discovery",
+	Measurements: []string{"subsystems"},
+	Macros:       map[string]string{"{#SITE}": "name", "{#SITEDESC}": "desc", "{#SUBSYSTEM}": "subsystem"},
+	KeyTags:      []string{"name", "subsystem"},
+}, {
+	Key:          "unifi.device.discovery",
+	Measurements: []string{"uap", "usg", "usw"},
+	Macros: map[string]string{"{#MAC}": "mac", "{#NAME}": "name", "{#SITE}": "site_name",
+		"{#MODEL}": "model", "{#TYPE}": "type", "{#SERIAL}": "serial"},
+	KeyTags: []string{"mac"},
+}, {
+	Key:          "unifi.port.discovery",
+	Measurements: []string{"usw_ports"},
+	Macros: map[string]string{"{#SWITCH}": "device_name", "{#PORTIDX}": "port_idx",
+		"{#PORTNAME}": "name", "{#SITE}": "site_name"},
+	KeyTags: []string{"device_name", "port_idx"},
+}, {
+	Key:          "unifi.ssid.discovery",
+	Measurements: []string{"uap_vaps"},
+	Macros: map[string]string{"{#AP}": "device_name", "{#ESSID}": "essid", "{#RADIO}": "radio",
+		"{#BSSID}": "bssid", "{#SITE}": "site_name"},
+	KeyTags: []string{"bssid"},
+}}
+
+// ZabbixOutput sends data to a Zabbix server or proxy with the sender (trapper) protocol.
+// Low-level discovery data for sites, devices, switch ports and SSIDs is sent first,
+// followed by item values for every field in those measurements. All items belong
+// to a single Zabbix host.
+type ZabbixOutput struct {
+	Server            string
+	Host              string
+	DiscoveryInterval time.Duration
+	DebugLog          func(msg string, fmt ...interface{})
+	lastDiscovery     time.Time
+}
+
+// zabbixValue is a single item value in a sender data request.
+type zabbixValue struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock,omitempty"`
+	NS    int    `json:"ns,omitempty"`
+}
+
+// zabbixResponse is returned by the server. Info contains processed/failed counts.
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// NewZabbixOutput returns a Zabbix sender output from the config.
+func NewZabbixOutput(c *Config, debugLog func(msg string, fmt ...interface{})) (*ZabbixOutput, error) {
+	z := &ZabbixOutput{
+		Server:            c.ZabbixServer,
+		Host:              c.ZabbixHost,
+		DiscoveryInterval: c.ZabbixDiscoveryInterval.Duration,
+		DebugLog:          debugLog,
+	}
+	if !strings.Contains(z.Server, ":") {
+		z.Server += ":10051"
+	}
+	if z.Host == "" {
+		return nil, fmt.Errorf("zabbix_host must be set")
+	}
+	return z, nil
+}
+
+// Name satisfies the Output interface.
+func (z *ZabbixOutput) Name() string {
+	return "zabbix output"
+}
+
+// Close does nothing; each write uses a new connection.
+func (z *ZabbixOutput) Close() error {
+	return nil
+}
+
+// WriteMetrics sends discovery data (at most once per discovery interval), then item values.
+func (z *ZabbixOutput) WriteMetrics(m *Metrics) error {
+	values := []*zabbixValue{}
+	discovered := make(map[*zabbixLLD]map[string]map[string]string)
+	for _, p := range m.Points() {
+		lld := zabbixRule(p.Name())
+		if lld == nil {
+			continue
+		}
+		if discovered[lld] == nil {
+			discovered[lld] = make(map[string]map[string]string)
+		}
+		id, macros := lld.discover(p)
+		discovered[lld][id] = macros
+		v, err := z.itemValues(lld, p)
+		if err != nil {
+			return err
+		}
+		values = append(values, v...)
+	}
+	if time.Since(z.lastDiscovery) >= z.DiscoveryInterval {
+		if err := z.sendDiscovery(discovered); err != nil {
+			return err
+		}
+		z.lastDiscovery = time.Now()
+	}
+	for i := 0; i < len(values); i += zabbixBatchSize {
+		end := i + zabbixBatchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		if err := z.send(values[i:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zabbixRule returns the discovery rule for a measurement, or nil.
+func zabbixRule(measurement string) *zabbixLLD {
+	for _, lld := range zabbixDiscoveries {
+		if StringInSlice(measurement, lld.Measurements) {
+			return lld
+		}
+	}
+	return nil
+}
+
+// discover returns the LLD macros for a point, and a string that uniquely identifies them.
+func (lld *zabbixLLD) discover(p *influx.Point) (string, map[string]string) {
+	tags := p.Tags()
+	macros := map[string]string{"{#MEASUREMENT}": p.Name()}
+	for macro, tag := range lld.Macros {
+		macros[macro] = tags[tag]
+	}
+	id := p.Name()
+	for _, tag := range lld.KeyTags {
+		id += "," + tags[tag]
+	}
+	return id, macros
+}
+
+// itemValues creates an item value for every field in a point.
+func (z *ZabbixOutput) itemValues(lld *zabbixLLD, p *influx.Point) ([]*zabbixValue, error) {
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, err
+	}
+	tags := p.Tags()
+	params := []string{}
+	for _, tag := range lld.KeyTags {
+		params = append(params, zabbixParam(tags[tag]))
+	}
+	values := []*zabbixValue{}
+	for k, v := range fields {
+		if b, ok := v.(bool); ok {
+			v = boolToInt(b)
+		}
+		values = append(values, &zabbixValue{
+			Host:  z.Host,
+			Key:   "unifi." + p.Name() + "[" + strings.Join(append(params, zabbixParam(k)), ",") + "]",
+			Value: formatValue(v),
+			Clock: p.Time().Unix(),
+			NS:    p.Time().Nanosecond(),
+		})
+	}
+	return values, nil
+}
+
+// sendDiscovery sends one LLD value for each discovery rule.
+func (z *ZabbixOutput) sendDiscovery(discovered map[*zabbixLLD]map[string]map[string]string) error {
+	values := []*zabbixValue{}
+	for lld, items := range discovered {
+		ids := make([]string, 0, len(items))
+		for id := range items {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		data := make([]map[string]string, len(ids))
+		for i, id := range ids {
+			data[i] = items[id]
+		}
+		b, err := json.Marshal(map[string]interface{}{"data": data})
+		if err != nil {
+			return err
+		}
+		values = append(values, &zabbixValue{Host: z.Host, Key: lld.Key, Value: string(b)})
+	}
+	return z.send(values)
+}
+
+// send writes a sender data request to the server and reads the response.
+func (z *ZabbixOutput) send(values []*zabbixValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(map[string]interface{}{"request": "sender data", "data": values})
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", z.Server, zabbixTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(zabbixTimeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(zabbixPacket(body)); err != nil {
+		return err
+	}
+	resp, err := readZabbixPacket(conn)
+	if err != nil {
+		return err
+	}
+	r := &zabbixResponse{}
+	if err := json.Unmarshal(resp, r); err != nil {
+		return err
+	} else if r.Response != "success" {
+		return fmt.Errorf("zabbix server %s: %s", r.Response, r.Info)
+	}
+	// Failed items usually do not exist (yet). This is not an error.
+	z.DebugLog("Zabbix: %s", r.Info)
+	return nil
+}
+
+// zabbixPacket adds the protocol header and data length to a payload.
+func zabbixPacket(data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(zabbixHeader)
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// readZabbixPacket reads and checks the header, then returns the payload.
+func readZabbixPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(zabbixHeader)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	} else if !bytes.Equal(header[:len(zabbixHeader)], zabbixHeader) {
+		return nil, fmt.Errorf("invalid zabbix response header: %q", header[:len(zabbixHeader)])
+	}
+	size := binary.LittleEndian.Uint64(header[len(zabbixHeader):])
+	return ioutil.ReadAll(io.LimitReader(r, int64(size)))
+}
+
+// zabbixParam quotes an item key parameter. Every parameter is quoted, so keys
+// are predictable when writing item prototypes, like: unifi.uap["{#MAC}","cpu"]
+func zabbixParam(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,128 @@
+package unifipoller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zabbixRequest is a sender data request, as the server reads it.
+type zabbixRequest struct {
+	Request string         `json:"request"`
+	Data    []*zabbixValue `json:"data"`
+}
+
+// testZabbixServer accepts sender connections and sends each request on the
+// returned channel. It answers with response.
+func testZabbixServer(t *testing.T, response string) (string, <-chan *zabbixRequest) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	requests := make(chan *zabbixRequest, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			req := &zabbixRequest{}
+			if b, err := readZabbixPacket(conn); err == nil && json.Unmarshal(b, req) == nil {
+				requests <- req
+			}
+			_, _ = conn.Write(zabbixPacket([]byte(response)))
+			_ = conn.Close()
+		}
+	}()
+	return l.Addr().String(), requests
+}
+
+// zabbixItems returns a request's values by item key.
+func zabbixItems(req *zabbixRequest) map[string]string {
+	items := make(map[string]string)
+	for _, v := range req.Data {
+		items[v.Key] = v.Value
+	}
+	return items
+}
+
+func TestZabbixPacket(t *testing.T) {
+	packet := zabbixPacket([]byte(`{"a":1}`))
+	if want := "ZBXD\x01\x07\x00\x00\x00\x00\x00\x00\x00" + `{"a":1}`; string(packet) != want {
+		t.Errorf("zabbixPacket = %q, want %q", packet, want)
+	}
+	// The length in the header limits what is read.
+	b, err := readZabbixPacket(bytes.NewReader(append(packet, "extra"...)))
+	if err != nil || string(b) != `{"a":1}` {
+		t.Errorf("readZabbixPacket = %q, %v", b, err)
+	}
+	if _, err := readZabbixPacket(strings.NewReader("HTTP/1.1 400 Bad Request\r\n")); err == nil {
+		t.Error("an invalid header was accepted")
+	}
+	if got := zabbixParam(`Office "AP"`); got != `"Office \"AP\""` {
+		t.Errorf("zabbixParam = %s", got)
+	}
+}
+
+func TestZabbixOutput(t *testing.T) {
+	addr, requests := testZabbixServer(t, `{"response":"success","info":"processed: 1; failed: 0"}`)
+	z := &ZabbixOutput{Server: addr, Host: "unifi", DiscoveryInterval: time.Hour, DebugLog: func(string, ...interface{}) {}}
+	m := testMetrics(t,
+		testPoint(t, "uap", map[string]string{"mac": "aa:01", "name": "Office", "site_name": "default", "model": "U7PG2"},
+			map[string]interface{}{"cpu": 12.5, "has_fan": true}),
+		testPoint(t, "usw_ports", map[string]string{"device_name": "Core", "port_idx": "4", "name": "Port 4"},
+			map[string]interface{}{"rx_bytes": 100}),
+		testPoint(t, "clients", map[string]string{"mac": "bb:01"}, map[string]interface{}{"rssi": -40}))
+	if err := z.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	// Discovery is sent first, with one LLD value for each rule with points.
+	discovery := <-requests
+	if discovery.Request != "sender data" || len(discovery.Data) != 2 {
+		t.Fatalf("wrong discovery request: %+v", discovery)
+	}
+	var devices struct {
+		Data []map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(zabbixItems(discovery)["unifi.device.discovery"]), &devices); err != nil {
+		t.Fatalf("the device LLD is not json: %v", err)
+	}
+	want := map[string]string{"{#MEASUREMENT}": "uap", "{#MAC}": "aa:01", "{#NAME}": "Office", "{#SITE}": "default",
+		"{#MODEL}": "U7PG2", "{#TYPE}": "", "{#SERIAL}": ""}
+	if len(devices.Data) != 1 || !reflect.DeepEqual(devices.Data[0], want) {
+		t.Errorf("device LLD = %v, want %v", devices.Data, want)
+	}
+	values := <-requests
+	if items, want := zabbixItems(values), map[string]string{
+		`unifi.uap["aa:01","cpu"]`:               "12.5",
+		`unifi.uap["aa:01","has_fan"]`:           "1",
+		`unifi.usw_ports["Core","4","rx_bytes"]`: "100",
+	}; !reflect.DeepEqual(items, want) {
+		t.Errorf("items = %v, want %v", items, want)
+	}
+	if v := values.Data[0]; v.Host != "unifi" || v.Clock != testTime.Unix() {
+		t.Errorf("wrong item value: %+v", v)
+	}
+	// Discovery is not sent again within the discovery interval.
+	if err := z.WriteMetrics(m); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	if values := <-requests; len(values.Data) != 3 {
+		t.Errorf("want only the item values, got %+v", values)
+	}
+}
+
+func TestZabbixOutputFailed(t *testing.T) {
+	addr, _ := testZabbixServer(t, `{"response":"failed","info":"host not found"}`)
+	z := &ZabbixOutput{Server: addr, Host: "unifi", DebugLog: func(string, ...interface{}) {}}
+	m := testMetrics(t, testPoint(t, "uap", map[string]string{"mac": "aa:01"}, map[string]interface{}{"cpu": 1.0}))
+	if err := z.WriteMetrics(m); err == nil || err.Error() != "zabbix server failed: host not found" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package unifipoller
+
+import (
+	"strings"
+
+	"golift.io/unifi"
+)
+
+// SwitchMACTable is the MAC address table of each port on a switch (or UDM).
+type SwitchMACTable struct {
+	SiteName  string `json:"-"`
+	Mac       string `json:"mac"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	PortTable []struct {
+		PortIdx  unifi.FlexInt  `json:"port_idx"`
+		Name     string         `json:"name"`
+		IsUplink unifi.FlexBool `json:"is_uplink"`
+		MacTable []*PortMAC     `json:"mac_table"`
+	} `json:"port_table"`
+}
+
+// PortMAC is a MAC address learned on a switch port.
+type PortMAC struct {
+	Hostname string         `json:"hostname"` // Replaced with the client's name, when it is a client.
+	IP       string         `json:"ip"`
+	Mac      string         `json:"mac"`
+	Age      unifi.FlexInt  `json:"age"`
+	Static   unifi.FlexBool `json:"static"`
+	Uptime   unifi.FlexInt  `json:"uptime"`
+	Vlan     unifi.FlexInt  `json:"vlan"`
+}
+
+// GetSwitchMACTables returns the port MAC tables of the USWs and UDMs in the
+// provided sites. Uplink ports carry every MAC behind them, so they are left out unless
+// port_mac_uplinks is set. Ports and devices without any learned MACs are too.
+func (u *UnifiPoller) GetSwitchMACTables(sites unifi.Sites, devices SiteDevices) ([]*SwitchMACTable, error) {
+	data := []*SwitchMACTable{}
+	for _, site := range sites {
+		var response []*SwitchMACTable
+		if err := devices.decode(site, &response); err != nil {
+			return data, err
+		}
+		for _, s := range response {
+			if s.Type != "usw" && s.Type != "udm" {
+				continue
+			}
+			ports := s.PortTable[:0]
+			for _, p := range s.PortTable {
+				if len(p.MacTable) > 0 && (!p.IsUplink.Val || u.Config.PortMACUplinks) {
+					ports = append(ports, p)
+				}
+			}
+			if len(ports) > 0 {
+				s.SiteName, s.PortTable = site.SiteName, ports
+				data = append(data, s)
+			}
+		}
+	}
+	return data, nil
+}
+
+// nameSwitchMACs sets the hostname and IP of each learned MAC that is a client.
+func nameSwitchMACs(tables []*SwitchMACTable, clients unifi.Clients) {
+	known := make(map[string]*unifi.Client)
+	for _, c := range clients {
+		known[strings.ToLower(c.Mac)] = c
+	}
+	for _, s := range tables {
+		for _, p := range s.PortTable {
+			for _, m := range p.MacTable {
+				c := known[strings.ToLower(m.Mac)]
+				if c == nil {
+					continue
+				}
+				m.Hostname = firstString(c.Name, c.Hostname, m.Hostname)
+				m.IP = firstString(c.IP, m.IP)
+			}
+		}
+	}
+}
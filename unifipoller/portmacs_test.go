@@ -0,0 +1,74 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golift.io/unifi"
+)
+
+// testPortMACDevices is a site's device list: an AP, whose port table has the
+// MACs behind it, and a switch with a client port, an uplink and an empty port.
+const testPortMACDevices = `[
+	{"mac": "aa:02", "name": "Office", "type": "uap", "port_table": [
+		{"port_idx": 1, "name": "Main", "mac_table": [{"mac": "bb:02"}]}]},
+	{"mac": "aa:01", "name": "Core", "type": "usw", "port_table": [
+		{"port_idx": 1, "name": "Port 1", "is_uplink": true, "mac_table": [{"mac": "aa:00"}, {"mac": "bb:01"}]},
+		{"port_idx": 4, "name": "Port 4", "mac_table": [{"mac": "BB:01", "hostname": "old", "vlan": 10},
+			{"mac": "cc:01", "ip": "10.0.0.9", "hostname": "printer"}]},
+		{"port_idx": 5, "name": "Port 5", "mac_table": []}]}
+]`
+
+func TestGetSwitchMACTables(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	devices := SiteDevices{"default": json.RawMessage(testPortMACDevices)}
+	for _, test := range []struct {
+		uplinks bool
+		ports   []string
+	}{
+		{false, []string{"Port 4"}},
+		{true, []string{"Port 1", "Port 4"}},
+	} {
+		u := &UnifiPoller{Config: &Config{PortMACUplinks: test.uplinks}}
+		tables, err := u.GetSwitchMACTables(unifi.Sites{site}, devices)
+		if err != nil {
+			t.Fatalf("GetSwitchMACTables: %v", err)
+		}
+		// The AP is not a switch; its port table is left out.
+		if len(tables) != 1 || tables[0].Name != "Core" || tables[0].SiteName != site.SiteName {
+			t.Fatalf("uplinks %v: wrong tables: %+v", test.uplinks, tables)
+		}
+		var ports []string
+		for _, p := range tables[0].PortTable {
+			ports = append(ports, p.Name)
+		}
+		if len(ports) != len(test.ports) || ports[len(ports)-1] != "Port 4" || ports[0] != test.ports[0] {
+			t.Errorf("uplinks %v: ports = %v, want %v", test.uplinks, ports, test.ports)
+		}
+	}
+}
+
+func TestNameSwitchMACs(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	devices := SiteDevices{"default": json.RawMessage(testPortMACDevices)}
+	tables, err := (&UnifiPoller{Config: &Config{}}).GetSwitchMACTables(unifi.Sites{site}, devices)
+	if err != nil {
+		t.Fatalf("GetSwitchMACTables: %v", err)
+	}
+	nameSwitchMACs(tables, unifi.Clients{{Mac: "bb:01", Hostname: "nas", IP: "10.0.0.5"}})
+	macs := tables[0].PortTable[0].MacTable
+	// Clients are matched without case; other MACs keep what the switch reported.
+	if macs[0].Hostname != "nas" || macs[0].IP != "10.0.0.5" {
+		t.Errorf("the client was not named: %+v", macs[0])
+	}
+	if macs[1].Hostname != "printer" || macs[1].IP != "10.0.0.9" {
+		t.Errorf("a MAC that is not a client was changed: %+v", macs[1])
+	}
+	points, err := USWPortMACPoints(tables[0], testTime)
+	if err != nil || len(points) != 2 {
+		t.Fatalf("USWPortMACPoints: %v %v", points, err)
+	}
+	if tags := points[0].Tags(); tags["port_id"] != "Core Port 4" || tags["vlan"] != "10" || tags["mac"] != "BB:01" {
+		t.Errorf("wrong tags: %v", tags)
+	}
+}
@@ -0,0 +1,191 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// queryDefaultFields are the columns printed for each kind of query when --fields is not provided.
+// Each column is a field name, or a tag name if the point has no field by that name.
+var queryDefaultFields = map[string][]string{
+	"device": {"state", "cpu", "mem", "loadavg_1", "num_sta", "uptime", "rx_bytes", "tx_bytes"},
+	"client": {"ip", "ap_name", "sw_port", "rssi", "signal", "rx_rate", "tx_rate", "rx_bytes", "tx_bytes"},
+	"port":   {"up", "speed", "rx_bytes", "tx_bytes", "rx_errors", "tx_errors", "rx_dropped", "tx_dropped", "poe_power"},
+}
+
+// queryMeasurements are the measurements searched for each kind of query.
+// A UDM writes a usg, usw and uap point with the same MAC every poll. They are
+// merged into one row; a field in more than one takes the first one's value here.
+var queryMeasurements = map[string][]string{
+	"device": {"usg", "usw", "uap"},
+	"client": {"clients"},
+	"port":   {"usw_ports"},
+}
+
+// QueryFlags are the CLI arguments for the query command.
+type QueryFlags struct {
+	Device string
+	Client string
+	Port   string
+	Since  time.Duration
+	Limit  int
+	Fields []string
+}
+
+// register adds the query command's flags to a flag set.
+func (q *QueryFlags) register(fs *pflag.FlagSet) {
+	fs.StringVarP(&q.Device, "device", "d", "", "Device name or MAC address.")
+	fs.StringVarP(&q.Client, "client", "m", "", "Client MAC address or name.")
+	fs.StringVarP(&q.Port, "port", "p", "", "Switch port as 'switch name:port number', or a port_id like 'Switch Port 3'.")
+	fs.DurationVarP(&q.Since, "since", "s", time.Hour, "How far back to look.")
+	fs.IntVarP(&q.Limit, "limit", "n", 20, "Maximum number of rows to print; the newest rows are printed.")
+	fs.StringSliceVarP(&q.Fields, "fields", "f", nil, "Fields (or tags) to print. Default depends on the query.")
+}
+
+// RunQuery runs the query command. It prints recent history for a device,
+// client or switch port from the SQLite history database as a table.
+func (u *UnifiPoller) RunQuery() error {
+	q := u.Flag.Query
+	if u.Config.SQLitePath == "" {
+		return fmt.Errorf("sqlite_path is not set in the config file; the query command reads its history")
+	}
+	kind, lookup := "", ""
+	switch {
+	case q.Device != "":
+		kind, lookup = "device", q.Device
+	case q.Client != "":
+		kind, lookup = "client", q.Client
+	case q.Port != "":
+		kind, lookup = "port", q.Port
+	default:
+		return fmt.Errorf("provide one of --device, --client or --port; see --help")
+	}
+	if len(q.Fields) == 0 {
+		q.Fields = queryDefaultFields[kind]
+	}
+	rows, err := u.queryHistory(kind, strings.ToLower(lookup), q)
+	if err != nil {
+		return err
+	} else if len(rows) == 0 {
+		return fmt.Errorf("no %s history found for %s in the last %v", kind, lookup, q.Since)
+	}
+	return printQuery(rows, q.Fields)
+}
+
+// queryRow is one point read back from the history database.
+type queryRow struct {
+	Time   time.Time
+	Name   string
+	Tags   map[string]string
+	Fields map[string]interface{}
+}
+
+// queryHistory reads matching points, oldest first, up to the limit. Points
+// from one poll of one device are merged into a row.
+func (u *UnifiPoller) queryHistory(kind, lookup string, q *QueryFlags) ([]*queryRow, error) {
+	db, err := openSQLite(u.Config.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	measurements := queryMeasurements[kind]
+	rank := make(map[string]int)
+	args := []interface{}{}
+	for i, m := range measurements {
+		rank[m] = i
+		args = append(args, m)
+	}
+	// Read enough points to fill the limit with merged rows.
+	args = append(args, lookup, lookup, time.Now().Add(-q.Since).Unix(), q.Limit*len(measurements))
+	query := "SELECT time, measurement, key, tags, fields FROM points WHERE measurement IN (?" +
+		strings.Repeat(", ?", len(measurements)-1) + ") AND (key = ? OR name = ?) AND time >= ? ORDER BY time DESC LIMIT ?"
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		groups = make(map[string][]*queryRow) // by time and key.
+		order  []string                       // group keys, newest first.
+		ranks  = make(map[*queryRow]int)
+	)
+	for rows.Next() {
+		var (
+			ts                             int64
+			measurement, key, tags, fields string
+		)
+		if err := rows.Scan(&ts, &measurement, &key, &tags, &fields); err != nil {
+			return nil, err
+		}
+		r := &queryRow{Time: time.Unix(ts, 0)}
+		if err := json.Unmarshal([]byte(tags), &r.Tags); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(fields), &r.Fields); err != nil {
+			return nil, err
+		}
+		switch {
+		case measurement == "usw_ports":
+			r.Name = r.Tags["port_id"]
+		case r.Tags["name"] != "":
+			r.Name = r.Tags["name"]
+		default:
+			r.Name = r.Tags["mac"]
+		}
+		group := strconv.FormatInt(ts, 10) + " " + key
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], r)
+		ranks[r] = rank[measurement]
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	results := []*queryRow{}
+	for _, group := range order {
+		if len(results) == q.Limit {
+			break
+		}
+		g := groups[group]
+		sort.SliceStable(g, func(i, j int) bool { return ranks[g[i]] < ranks[g[j]] })
+		for _, r := range g[1:] {
+			for k, v := range r.Fields {
+				if _, ok := g[0].Fields[k]; !ok {
+					g[0].Fields[k] = v
+				}
+			}
+		}
+		// Prepend, so the oldest row is first.
+		results = append([]*queryRow{g[0]}, results...)
+	}
+	return results, nil
+}
+
+// printQuery prints the rows as an aligned table.
+func printQuery(rows []*queryRow, columns []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tNAME\t"+strings.ToUpper(strings.Join(columns, "\t")))
+	for _, r := range rows {
+		values := []string{r.Time.Format("2006-01-02 15:04:05"), r.Name}
+		for _, c := range columns {
+			if v, ok := r.Fields[c]; ok && v != nil {
+				values = append(values, formatValue(v))
+			} else if v, ok := r.Tags[c]; ok && v != "" {
+				values = append(values, v)
+			} else {
+				values = append(values, "-")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	return w.Flush()
+}
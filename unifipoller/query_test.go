@@ -0,0 +1,59 @@
+package unifipoller
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	influx "github.com/influxdata/influxdb1-client/v2"
+)
+
+func TestQueryHistoryUDM(t *testing.T) {
+	c := &Config{SQLitePath: filepath.Join(t.TempDir(), "history.db"), SQLiteRetention: Duration{time.Hour}}
+	s, err := NewSQLiteOutput(c)
+	if err != nil {
+		t.Fatalf("NewSQLiteOutput: %v", err)
+	}
+	defer s.Close()
+	// A UDM is written as a usg, usw and uap point with the same MAC each poll.
+	tags := map[string]string{"mac": "aa:bb:cc:00:11:22", "name": "Dream Machine"}
+	points := []*influx.Point{}
+	for i := 2; i > 0; i-- {
+		ts := time.Now().Add(-time.Duration(i) * time.Minute)
+		for _, p := range []struct {
+			measurement string
+			fields      map[string]interface{}
+		}{
+			{"uap", map[string]interface{}{"num_sta": 9, "cpu": 1.0}},
+			{"usg", map[string]interface{}{"num_sta": 12, "cpu": 5.0}},
+			{"usw", map[string]interface{}{"num_sta": 3, "mem": 40.0}},
+		} {
+			pt, err := influx.NewPoint(p.measurement, tags, p.fields, ts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			points = append(points, pt)
+		}
+	}
+	if err := s.WriteMetrics(testMetrics(t, points...)); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	u := &UnifiPoller{Config: c}
+	rows, err := u.queryHistory("device", "dream machine", &QueryFlags{Since: time.Hour, Limit: 20})
+	if err != nil {
+		t.Fatalf("queryHistory: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want one for each of 2 polls", len(rows))
+	}
+	// Fields in more than one point come from the usg point.
+	if f := rows[0].Fields; f["num_sta"] != 12.0 || f["cpu"] != 5.0 || f["mem"] != 40.0 {
+		t.Errorf("wrong merged fields: %v", f)
+	}
+	if !rows[0].Time.Before(rows[1].Time) {
+		t.Errorf("rows are not oldest first: %v, %v", rows[0].Time, rows[1].Time)
+	}
+	if rows, err = u.queryHistory("device", "aa:bb:cc:00:11:22", &QueryFlags{Since: time.Hour, Limit: 1}); err != nil || len(rows) != 1 {
+		t.Errorf("got %d rows (%v) with a limit of 1", len(rows), err)
+	}
+}
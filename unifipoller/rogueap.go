@@ -0,0 +1,98 @@
+package unifipoller
+
+import (
+	"time"
+
+	"golift.io/unifi"
+)
+
+// RogueAPPath is the API path for the neighboring access points a site's UAPs hear.
+const RogueAPPath = "/api/s/%s/stat/rogueap"
+
+// rogueAPForget is how long a BSSID must go unheard before it is new again.
+const rogueAPForget = 24 * time.Hour
+
+// RogueAP is a neighboring (or rogue) access point heard by one of our UAPs.
+type RogueAP struct {
+	SiteName   string         `json:"-"`
+	ApName     string         `json:"-"`
+	OwnSSID    bool           `json:"-"` // Broadcasting one of the site's SSIDs.
+	New        bool           `json:"-"` // Not heard in the last day.
+	ID         string         `json:"_id"`
+	ApMac      string         `json:"ap_mac"`
+	Age        unifi.FlexInt  `json:"age"`
+	Band       string         `json:"band"`
+	Bssid      string         `json:"bssid"`
+	Bw         unifi.FlexInt  `json:"bw"`
+	CenterFreq unifi.FlexInt  `json:"center_freq"`
+	Channel    unifi.FlexInt  `json:"channel"`
+	Essid      string         `json:"essid"`
+	Freq       unifi.FlexInt  `json:"freq"`
+	IsAdhoc    unifi.FlexBool `json:"is_adhoc"`
+	IsRogue    unifi.FlexBool `json:"is_rogue"`
+	IsUbnt     unifi.FlexBool `json:"is_ubnt"`
+	LastSeen   unifi.FlexInt  `json:"last_seen"`
+	Noise      unifi.FlexInt  `json:"noise"`
+	Oui        string         `json:"oui"`
+	Radio      string         `json:"radio"`
+	RadioName  string         `json:"radio_name"`
+	Rssi       unifi.FlexInt  `json:"rssi"`
+	Security   string         `json:"security"`
+	Signal     unifi.FlexInt  `json:"signal"`
+	SiteID     string         `json:"site_id"`
+}
+
+// GetRogueAPs returns the neighboring access points heard in the provided sites.
+func (u *UnifiPoller) GetRogueAPs(sites unifi.Sites) ([]*RogueAP, error) {
+	data := []*RogueAP{}
+	for _, site := range sites {
+		var response []*RogueAP
+		if err := u.getSiteData(RogueAPPath, site, &response); err != nil {
+			return data, err
+		}
+		for _, r := range response {
+			r.SiteName = site.SiteName
+		}
+		data = append(data, response...)
+	}
+	return data, nil
+}
+
+// flagRogueAPs names the UAP that heard each rogue AP, and flags the rogues using
+// one of the site's own SSIDs and the BSSIDs not heard in the last day. Nothing
+// is flagged new on the first poll, since every BSSID is new then. A new rogue
+// on one of our SSIDs is also logged; it may be impersonating our network.
+func (u *UnifiPoller) flagRogueAPs(metrics *Metrics, devices map[string]string) {
+	ssids := make(map[string]bool) // site name + ssid
+	for _, r := range metrics.UAPs {
+		for _, v := range r.VapTable {
+			ssids[r.SiteName+"/"+v.Essid] = true
+		}
+	}
+	first := u.rogueAPs == nil
+	if first {
+		u.rogueAPs = make(map[string]time.Time)
+	}
+	newAPs := make(map[string]bool)
+	for _, r := range metrics.RogueAPs {
+		if _, ok := u.rogueAPs[r.Bssid]; !ok && !first {
+			newAPs[r.Bssid] = true
+		}
+	}
+	now := time.Now()
+	for _, r := range metrics.RogueAPs {
+		r.ApName = devices[r.ApMac]
+		r.OwnSSID = r.Essid != "" && ssids[r.SiteName+"/"+r.Essid]
+		r.New = newAPs[r.Bssid]
+		if r.New && r.OwnSSID && u.rogueAPs[r.Bssid].IsZero() {
+			u.Logf("New rogue AP %s (%s) is using our SSID %s, heard by %s on channel %s (site: %s)",
+				r.Bssid, r.Oui, r.Essid, r.ApName, r.Channel.Txt, r.SiteName)
+		}
+		u.rogueAPs[r.Bssid] = now
+	}
+	for bssid, seen := range u.rogueAPs {
+		if now.Sub(seen) > rogueAPForget {
+			delete(u.rogueAPs, bssid)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// testRogueAPMetrics is a poll with one UAP broadcasting Corp in the default
+// site, and the rogues it heard with the given BSSIDs and SSIDs.
+func testRogueAPMetrics(t *testing.T, rogues ...*RogueAP) *Metrics {
+	t.Helper()
+	uap := &unifi.UAP{SiteName: "Default (default)", Mac: "aa:01", Name: "Office"}
+	if err := json.Unmarshal([]byte(`[{"essid": "Corp"}, {"essid": ""}]`), &uap.VapTable); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	for _, r := range rogues {
+		r.ApMac = "aa:01"
+		if r.SiteName == "" {
+			r.SiteName = "Default (default)"
+		}
+	}
+	return &Metrics{Devices: &unifi.Devices{UAPs: []*unifi.UAP{uap}}, RogueAPs: rogues}
+}
+
+func TestFlagRogueAPs(t *testing.T) {
+	u := &UnifiPoller{Config: &Config{Quiet: true}}
+	devices := map[string]string{"aa:01": "Office"}
+	// Nothing is new on the first poll.
+	m := testRogueAPMetrics(t, &RogueAP{Bssid: "b1", Essid: "Corp"}, &RogueAP{Bssid: "b2", Essid: "Neighbor"},
+		&RogueAP{Bssid: "b3"})
+	u.flagRogueAPs(m, devices)
+	for _, r := range m.RogueAPs {
+		if r.New || r.ApName != "Office" || r.OwnSSID != (r.Bssid == "b1") {
+			t.Errorf("first poll: wrong flags for %s: new %v, own %v, heard by %q", r.Bssid, r.New, r.OwnSSID, r.ApName)
+		}
+	}
+	// Corp is only our SSID in the default site, and hidden SSIDs are never ours.
+	m = testRogueAPMetrics(t, &RogueAP{Bssid: "b1", Essid: "Corp"}, &RogueAP{Bssid: "b4", Essid: "Corp"},
+		&RogueAP{Bssid: "b5", Essid: "Corp", SiteName: "Lab (lab)"}, &RogueAP{Bssid: "b6"})
+	u.flagRogueAPs(m, devices)
+	for i, want := range []struct{ new, own bool }{{false, true}, {true, true}, {true, false}, {true, false}} {
+		if r := m.RogueAPs[i]; r.New != want.new || r.OwnSSID != want.own {
+			t.Errorf("second poll: %s: new %v, own %v, want %+v", r.Bssid, r.New, r.OwnSSID, want)
+		}
+	}
+	// A BSSID that goes unheard for a day is forgotten, and is new when heard again.
+	u.rogueAPs["b2"] = time.Now().Add(-rogueAPForget - time.Minute)
+	u.flagRogueAPs(testRogueAPMetrics(t, &RogueAP{Bssid: "b1", Essid: "Corp"}), devices)
+	if _, ok := u.rogueAPs["b2"]; ok {
+		t.Error("a BSSID unheard for a day was not forgotten")
+	}
+	if _, ok := u.rogueAPs["b3"]; !ok {
+		t.Error("a BSSID heard in the last day was forgotten")
+	}
+	m = testRogueAPMetrics(t, &RogueAP{Bssid: "b2", Essid: "Neighbor"})
+	if u.flagRogueAPs(m, devices); !m.RogueAPs[0].New {
+		t.Error("a forgotten BSSID is not new")
+	}
+}
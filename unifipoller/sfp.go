@@ -0,0 +1,65 @@
+package unifipoller
+
+import "golift.io/unifi"
+
+// SFPModules are the SFP and SFP+ modules found in a switch (or UDM), with their
+// digital optical monitoring (DOM) readings.
+type SFPModules struct {
+	SiteName  string     `json:"-"`
+	Mac       string     `json:"mac"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Model     string     `json:"model"`
+	PortTable []*SFPPort `json:"port_table"`
+}
+
+// SFPPort is a port with a module in it. Temperature is in Celsius, voltage in
+// volts, optical power in dBm and bias current in mA.
+type SFPPort struct {
+	PortIdx        unifi.FlexInt  `json:"port_idx"`
+	Name           string         `json:"name"`
+	Media          string         `json:"media"`
+	Up             unifi.FlexBool `json:"up"`
+	Speed          unifi.FlexInt  `json:"speed"`
+	SfpFound       unifi.FlexBool `json:"sfp_found"`
+	SfpVendor      string         `json:"sfp_vendor"`
+	SfpPart        string         `json:"sfp_part"`
+	SfpSerial      string         `json:"sfp_serial"`
+	SfpRev         string         `json:"sfp_rev"`
+	SfpCompliance  string         `json:"sfp_compliance"`
+	SfpTemperature unifi.FlexInt  `json:"sfp_temperature"`
+	SfpVoltage     unifi.FlexInt  `json:"sfp_voltage"`
+	SfpTxpower     unifi.FlexInt  `json:"sfp_txpower"`
+	SfpRxpower     unifi.FlexInt  `json:"sfp_rxpower"`
+	SfpCurrent     unifi.FlexInt  `json:"sfp_current"`
+	SfpTxfault     unifi.FlexBool `json:"sfp_txfault"`
+	SfpRxfault     unifi.FlexBool `json:"sfp_rxfault"`
+}
+
+// GetSFPModules returns the SFP modules in the USWs and UDMs in the provided
+// sites. Only ports with a module are returned, and only devices with one.
+func (u *UnifiPoller) GetSFPModules(sites unifi.Sites, devices SiteDevices) ([]*SFPModules, error) {
+	data := []*SFPModules{}
+	for _, site := range sites {
+		var response []*SFPModules
+		if err := devices.decode(site, &response); err != nil {
+			return data, err
+		}
+		for _, s := range response {
+			if s.Type != "usw" && s.Type != "udm" {
+				continue
+			}
+			ports := []*SFPPort{}
+			for _, p := range s.PortTable {
+				if p.SfpFound.Val {
+					ports = append(ports, p)
+				}
+			}
+			if len(ports) > 0 {
+				s.SiteName, s.PortTable = site.SiteName, ports
+				data = append(data, s)
+			}
+		}
+	}
+	return data, nil
+}
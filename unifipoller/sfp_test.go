@@ -0,0 +1,56 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golift.io/unifi"
+)
+
+// testSFPDevices is a site's device list: a switch with one module, a UDM with
+// one, an AP that reports sfp_found, and a switch without any modules.
+const testSFPDevices = `[
+	{"mac": "aa:01", "name": "Core", "type": "usw", "model": "US16XG", "port_table": [
+		{"port_idx": 1, "name": "Port 1", "up": true, "speed": 1000},
+		{"port_idx": 2, "name": "SFP+ 2", "media": "SFP+", "up": true, "speed": 10000, "sfp_found": true,
+		 "sfp_vendor": "Ubiquiti Inc.", "sfp_part": "UACC-OM-MM-10G-D", "sfp_serial": "FS123", "sfp_rev": "A",
+		 "sfp_compliance": "10G Base-SR", "sfp_temperature": 35.5, "sfp_voltage": 3.3, "sfp_txpower": -2.5,
+		 "sfp_rxpower": -3.1, "sfp_current": 6.5, "sfp_rxfault": true}]},
+	{"mac": "aa:00", "name": "Dream", "type": "udm", "model": "UDMPRO", "port_table": [
+		{"port_idx": 10, "name": "SFP+ 2", "sfp_found": true, "sfp_vendor": "FS"}]},
+	{"mac": "aa:02", "name": "Office", "type": "uap", "port_table": [{"port_idx": 1, "sfp_found": true}]},
+	{"mac": "aa:03", "name": "Desk", "type": "usw", "port_table": [{"port_idx": 1, "up": true}]}
+]`
+
+func TestGetSFPModules(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	devices := SiteDevices{"default": json.RawMessage(testSFPDevices)}
+	modules, err := (&UnifiPoller{}).GetSFPModules(unifi.Sites{site}, devices)
+	if err != nil {
+		t.Fatalf("GetSFPModules: %v", err)
+	}
+	if len(modules) != 2 || modules[0].Name != "Core" || modules[1].Name != "Dream" {
+		t.Fatalf("only switches and UDMs with modules should be returned: %+v", modules)
+	}
+	if len(modules[0].PortTable) != 1 || modules[0].PortTable[0].PortIdx.Val != 2 || modules[0].SiteName != site.SiteName {
+		t.Fatalf("only ports with a module should be returned: %+v", modules[0].PortTable)
+	}
+	points, err := SFPPoints(modules[0], testTime)
+	if err != nil || len(points) != 1 {
+		t.Fatalf("SFPPoints: %v %v", points, err)
+	}
+	for k, want := range map[string]string{"device_name": "Core", "device_type": "usw", "model": "US16XG",
+		"port_idx": "2", "port_id": "Core Port 2", "media": "SFP+", "vendor": "Ubiquiti Inc.",
+		"part": "UACC-OM-MM-10G-D", "serial": "FS123", "compliance": "10G Base-SR"} {
+		if got := points[0].Tags()[k]; got != want {
+			t.Errorf("tag %s = %q, want %q", k, got, want)
+		}
+	}
+	fields, _ := points[0].Fields()
+	for k, want := range map[string]interface{}{"temperature": 35.5, "voltage": 3.3, "tx_power": -2.5,
+		"rx_power": -3.1, "current": 6.5, "tx_fault": false, "rx_fault": true, "up": true, "speed": 10000.0, "rev": "A"} {
+		if fields[k] != want {
+			t.Errorf("field %s = %v, want %v", k, fields[k], want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// siteConfigKind is a kind of site configuration, its API path, and the settings
+// written as inventory fields. Every object of a kind gets the same fields.
+type siteConfigKind struct {
+	Kind, Path string
+	Summary    []string
+}
+
+// siteConfigKinds are the kinds of site configuration collected with collect_config.
+var siteConfigKinds = []siteConfigKind{
+	{"wlanconf", "/api/s/%s/rest/wlanconf", []string{"enabled", "security", "wpa_mode", "wpa_enc", "is_guest",
+		"hide_ssid", "wlan_band", "vlan_enabled", "vlan", "networkconf_id", "usergroup_id", "mac_filter_enabled"}},
+	{"networkconf", "/api/s/%s/rest/networkconf", []string{"enabled", "purpose", "networkgroup", "vlan_enabled",
+		"vlan", "ip_subnet", "domain_name", "dhcpd_enabled", "dhcpd_start", "dhcpd_stop", "igmp_snooping", "vpn_type"}},
+	{"portconf", "/api/s/%s/rest/portconf", []string{"forward", "native_networkconf_id", "voice_networkconf_id",
+		"op_mode", "poe_mode", "autoneg", "speed", "full_duplex", "isolation", "stormctrl_enabled", "dot1x_ctrl"}},
+}
+
+// siteConfigSecrets are parts of secret setting names that lack the x_ prefix,
+// like RADIUS secrets and VPN keys. Settings containing one are redacted too.
+var siteConfigSecrets = []string{"password", "passphrase", "secret", "psk", "pre_shared_key",
+	"private_key", "shared_key"}
+
+// SiteConfig is one configuration object, like a WLAN, as the controller returns it.
+type SiteConfig map[string]interface{}
+
+// SiteConfigs are the configuration objects of one kind in a site.
+type SiteConfigs struct {
+	SiteName string
+	Site     string // The site's short name, used in API paths.
+	Kind     string
+	Summary  []string // The kind's inventory fields.
+	Items    []SiteConfig
+}
+
+// GetSiteConfigs returns the provided kinds of configuration of the provided
+// sites. Objects are sorted by ID.
+func (u *UnifiPoller) GetSiteConfigs(sites unifi.Sites, kinds []siteConfigKind) ([]*SiteConfigs, error) {
+	data := []*SiteConfigs{}
+	for _, site := range sites {
+		for _, k := range kinds {
+			var response []SiteConfig
+			if err := u.getSiteData(k.Path, site, &response); err != nil {
+				return data, err
+			}
+			sort.Slice(response, func(i, j int) bool { return response[i].ID() < response[j].ID() })
+			data = append(data, &SiteConfigs{SiteName: site.SiteName, Site: site.Name, Kind: k.Kind,
+				Summary: k.Summary, Items: response})
+		}
+	}
+	return data, nil
+}
+
+// ID returns the object's ID.
+func (c SiteConfig) ID() string {
+	id, _ := c["_id"].(string)
+	return id
+}
+
+// Name returns the object's name, or its ID if it has no name.
+func (c SiteConfig) Name() string {
+	if name, _ := c["name"].(string); name != "" {
+		return name
+	}
+	return c.ID()
+}
+
+// Value returns a setting as a string. Secrets are redacted; lists and objects
+// are JSON.
+func (c SiteConfig) Value(key string) string {
+	switch v := c[key].(type) {
+	case nil:
+		return ""
+	case string:
+		if isSecret(key) && v != "" {
+			return "(redacted)"
+		}
+		return v
+	default:
+		if isSecret(key) {
+			return "(redacted)"
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// Definition returns a copy of the object as it is configured: secrets are
+// redacted, and firewall rule hit counters, which change every poll, are left out.
+func (c SiteConfig) Definition() SiteConfig {
+	r := make(SiteConfig)
+	for k, v := range c {
+		if isCounter(k) {
+			continue
+		} else if isSecret(k) {
+			v = c.Value(k)
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// isCounter returns true for the firewall rule hit counters.
+func isCounter(key string) bool {
+	for _, c := range firewallRuleCounters {
+		if key == c {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecret returns true for settings starting with x_, like x_passphrase, and
+// settings named like one of siteConfigSecrets, like radius_secret.
+func isSecret(key string) bool {
+	if strings.HasPrefix(key, "x_") {
+		return true
+	}
+	key = strings.ToLower(key)
+	for _, s := range siteConfigSecrets {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackSiteConfigs compares the configuration with the last poll's, and returns a
+// config_change event for every object added, removed or changed. Secrets are
+// compared, but never written. Changed configuration is saved as a JSON snapshot
+// when a snapshot directory is configured. The configuration is returned for the
+// inventory measurement when anything changed, or config_inventory_interval passed.
+func (u *UnifiPoller) trackSiteConfigs(configs []*SiteConfigs) ([]*SiteConfigs, []*Event) {
+	if u.configs == nil {
+		u.configs = make(map[string]map[string]SiteConfig)
+	}
+	now := time.Now()
+	events := []*Event{}
+	changed := false
+	for _, s := range configs {
+		key := s.Site + "/" + s.Kind
+		cur := make(map[string]SiteConfig)
+		for _, c := range s.Items {
+			cur[c.ID()] = c
+		}
+		old, ok := u.configs[key]
+		u.configs[key] = cur
+		if ok {
+			e := diffSiteConfigs(s, old, cur, now)
+			if len(e) == 0 {
+				continue
+			}
+			events = append(events, e...)
+		}
+		changed = true
+		if u.Config.ConfigSnapshotDir != "" {
+			u.LogError(writeConfigSnapshot(u.Config.ConfigSnapshotDir, s, now), "config snapshot")
+		}
+	}
+	for _, e := range events {
+		u.Logf("Configuration changed: %s", e.Message)
+	}
+	if !changed && now.Sub(u.configTime) < u.Config.ConfigInventoryInterval.Duration {
+		return nil, events
+	}
+	u.configTime = now
+	return configs, events
+}
+
+// diffSiteConfigs returns an event for each object added, removed or changed.
+func diffSiteConfigs(s *SiteConfigs, old, cur map[string]SiteConfig, now time.Time) []*Event {
+	events := []*Event{}
+	event := func(c SiteConfig, what, oldVal, newVal string) {
+		events = append(events, &Event{Time: now, SiteName: s.SiteName, Type: "config_change",
+			Subject: s.Kind + "/" + c.Name(), Old: oldVal, New: newVal,
+			Message: fmt.Sprintf("%s %s %s (site: %s)", s.Kind, c.Name(), what, s.SiteName)})
+	}
+	for _, c := range s.Items {
+		o, ok := old[c.ID()]
+		if !ok {
+			event(c, "added", "", "")
+			continue
+		}
+		keys := changedKeys(o, c)
+		if len(keys) == 0 {
+			continue
+		}
+		oldVals, newVals := []string{}, []string{}
+		for _, k := range keys {
+			oldVals = append(oldVals, k+"="+o.Value(k))
+			newVals = append(newVals, k+"="+c.Value(k))
+		}
+		event(c, "changed: "+strings.Join(keys, ", "), strings.Join(oldVals, " "), strings.Join(newVals, " "))
+	}
+	ids := []string{}
+	for id := range old {
+		if _, ok := cur[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		event(old[id], "removed", "", "")
+	}
+	return events
+}
+
+// changedKeys returns the sorted settings that differ between two objects. Hit
+// counters are not settings; they change with traffic.
+func changedKeys(old, cur SiteConfig) []string {
+	keys := []string{}
+	for k, v := range cur {
+		if isCounter(k) {
+			continue
+		}
+		a, _ := json.Marshal(old[k])
+		b, _ := json.Marshal(v)
+		if string(a) != string(b) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok && !isCounter(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeConfigSnapshot saves one kind of a site's configuration definition, with
+// secrets redacted and without counters, to dir/<site>/<kind>-<time>.json.
+func writeConfigSnapshot(dir string, s *SiteConfigs, now time.Time) error {
+	dir = filepath.Join(dir, s.Site)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	items := []SiteConfig{}
+	for _, c := range s.Items {
+		items = append(items, c.Definition())
+	}
+	b, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, s.Kind+"-"+now.UTC().Format("20060102T150405Z")+".json")
+	return ioutil.WriteFile(name, append(b, '\n'), 0600)
+}
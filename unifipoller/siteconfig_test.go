@@ -0,0 +1,124 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteConfigSecrets(t *testing.T) {
+	c := SiteConfig{"_id": "1", "name": "Corp", "x_passphrase": "hunter22", "radius_secret": "s3cret",
+		"x_ipsec_pre_shared_key": "psk", "ipsec_pre_shared_key": "psk", "wireguard_private_key": "key",
+		"x_empty": "", "security": "wpapsk", "vlan": 10.0}
+	for key, want := range map[string]string{
+		"x_passphrase":          "(redacted)",
+		"radius_secret":         "(redacted)",
+		"ipsec_pre_shared_key":  "(redacted)",
+		"wireguard_private_key": "(redacted)",
+		"x_empty":               "",
+		"security":              "wpapsk",
+		"vlan":                  "10",
+		"missing":               "",
+	} {
+		if got := c.Value(key); got != want {
+			t.Errorf("Value(%s) = %q, want %q", key, got, want)
+		}
+	}
+	b, _ := json.Marshal(c.Definition())
+	for _, secret := range []string{"hunter22", "s3cret", `"psk"`, `"key"`} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("the redacted copy contains %s: %s", secret, b)
+		}
+	}
+	if c["x_passphrase"] != "hunter22" {
+		t.Error("Definition changed the original object")
+	}
+}
+
+func TestSiteConfigPoints(t *testing.T) {
+	s := &SiteConfigs{SiteName: "Default (default)", Kind: "wlanconf", Summary: siteConfigKinds[0].Summary,
+		Items: []SiteConfig{
+			{"_id": "1", "name": "Corp", "security": "wpapsk", "x_passphrase": "hunter22", "vlan": 10.0},
+			{"_id": "2", "name": "Guest", "is_guest": true, "schedule": []interface{}{"mon|0800-1700"}},
+		}}
+	points, err := SiteConfigPoints(s, testTime)
+	if err != nil || len(points) != 2 {
+		t.Fatalf("SiteConfigPoints: %v %v", points, err)
+	}
+	var columns []string
+	for i, pt := range points {
+		if pt.Name() != "config_inventory_wlanconf" {
+			t.Errorf("measurement = %s", pt.Name())
+		}
+		fields, _ := pt.Fields()
+		keys := []string{}
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if i == 0 {
+			columns = keys
+		} else if !reflect.DeepEqual(keys, columns) {
+			t.Errorf("objects of one kind have different fields:\n%v\n%v", columns, keys)
+		}
+	}
+	fields, _ := points[1].Fields()
+	if fields["is_guest"] != "true" || fields["security"] != "" || len(fields) != len(s.Summary)+1 {
+		t.Errorf("wrong fields: %v", fields)
+	}
+	if settings, _ := points[0].Fields(); strings.Contains(settings["settings"].(string), "hunter22") {
+		t.Errorf("settings contains a secret: %v", settings["settings"])
+	}
+}
+
+func TestFirewallRuleCounters(t *testing.T) {
+	old := SiteConfig{"_id": "1", "name": "Block IoT", "action": "drop", "hits": 10.0, "packets": 20.0, "bytes": 3000.0}
+	cur := SiteConfig{"_id": "1", "name": "Block IoT", "action": "drop", "hits": 12.0, "packets": 25.0}
+	if keys := changedKeys(old, cur); len(keys) != 0 {
+		t.Errorf("counters should not be changes: %v", keys)
+	}
+	cur["action"] = "accept"
+	if keys := changedKeys(old, cur); !reflect.DeepEqual(keys, []string{"action"}) {
+		t.Errorf("changedKeys = %v, want [action]", keys)
+	}
+	if d := cur.Definition(); d["hits"] != nil || d["packets"] != nil || d["action"] != "accept" {
+		t.Errorf("the definition should not have counters: %v", d)
+	}
+	u := &UnifiPoller{Config: &Config{Quiet: true, ConfigInventoryInterval: Duration{time.Hour}, ConfigSnapshotDir: t.TempDir()}}
+	rules := func(hits float64) []*SiteConfigs {
+		return []*SiteConfigs{{SiteName: "Default (default)", Site: "default", Kind: "firewallrule",
+			Items: []SiteConfig{{"_id": "1", "name": "Block IoT", "action": "drop", "hits": hits}}}}
+	}
+	u.trackSiteConfigs(rules(1))
+	inventory, events := u.trackSiteConfigs(rules(2))
+	if len(events) != 0 || inventory != nil {
+		t.Errorf("a counter change was tracked as a config change: %v %v", events, inventory)
+	}
+	files, _ := filepath.Glob(filepath.Join(u.Config.ConfigSnapshotDir, "default", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("want the first poll's snapshot only, got %v", files)
+	}
+	if b, _ := ioutil.ReadFile(files[0]); strings.Contains(string(b), "hits") {
+		t.Errorf("the snapshot has counters: %s", b)
+	}
+}
+
+func TestFirewallRulePoints(t *testing.T) {
+	s := &SiteConfigs{SiteName: "Default (default)", Kind: "firewallrule", Items: []SiteConfig{
+		{"_id": "1", "name": "Block IoT", "ruleset": "LAN_IN", "rule_index": 2000.0, "action": "drop", "enabled": true, "hits": 12.0},
+	}}
+	points, err := FirewallRulePoints(s, testTime)
+	if err != nil || len(points) != 1 {
+		t.Fatalf("FirewallRulePoints: %v %v", points, err)
+	}
+	fields, _ := points[0].Fields()
+	// The index changes when rules are reordered; as a tag it would start a new series.
+	if _, ok := points[0].Tags()["rule_index"]; ok || fields["rule_index"] != 2000.0 || fields["hits"] != 12.0 {
+		t.Errorf("rule_index should be a field only: %v %v", points[0].Tags(), fields)
+	}
+}
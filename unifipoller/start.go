@@ -16,26 +16,13 @@ import (
 // Parses flags, parses config and executes Run().
 func Start() error {
 	log.SetFlags(log.LstdFlags)
-	up := &UnifiPoller{
-		Flag: &Flag{},
-		Config: &Config{
-			// Preload our defaults.
-			InfluxURL:  defaultInfluxURL,
-			InfluxUser: defaultInfluxUser,
-			InfluxPass: defaultInfluxPass,
-			InfluxDB:   defaultInfluxDB,
-			UnifiUser:  defaultUnifiUser,
-			UnifiPass:  os.Getenv("UNIFI_PASSWORD"), // deprecated name.
-			UnifiBase:  defaultUnifiURL,
-			Interval:   Duration{defaultInterval},
-			Sites:      []string{"all"},
-		}}
+	up := &UnifiPoller{Flag: &Flag{}, Config: defaultConfig()}
 	up.Flag.Parse(os.Args[1:])
 	if up.Flag.ShowVer {
 		fmt.Printf("unifi-poller v%s\n", Version)
 		return nil // don't run anything else w/ version request.
 	}
-	if up.Flag.DumpJSON == "" { // do not print this when dumping JSON.
+	if up.Flag.DumpJSON == "" && up.Flag.Command == "" { // do not print this when dumping JSON or running a command.
 		up.Logf("Loading Configuration File: %s", up.Flag.ConfigFile)
 	}
 	// Parse config file.
@@ -50,24 +37,125 @@ func Start() error {
 	return up.Run()
 }
 
+// defaultConfig returns a Config with all the defaults preloaded.
+func defaultConfig() *Config {
+	return &Config{
+		// Preload our defaults.
+		InfluxURL:  defaultInfluxURL,
+		InfluxUser: defaultInfluxUser,
+		InfluxPass: defaultInfluxPass,
+		InfluxDB:   defaultInfluxDB,
+		UnifiUser:  defaultUnifiUser,
+		UnifiPass:  os.Getenv("UNIFI_PASSWORD"), // deprecated name.
+		UnifiBase:  defaultUnifiURL,
+		Interval:   Duration{defaultInterval},
+		Sites:      []string{"all"},
+		FileFormat: defaultFileFormat,
+		// Splunk HEC defaults.
+		SplunkSourcetype: defaultSplunkSourcetype,
+		SplunkBatchSize:  defaultSplunkBatchSize,
+		SplunkAckTimeout: Duration{defaultSplunkAckTimeout},
+		LokiFormat:       defaultLokiFormat,
+		// Zabbix sender defaults.
+		ZabbixHost:              defaultZabbixHost,
+		ZabbixDiscoveryInterval: Duration{defaultZabbixDiscovery},
+		// NATS, SQLite and Datadog defaults.
+		NATSSubject:      defaultNATSSubject,
+		NATSAckTimeout:   Duration{defaultNATSAckTimeout},
+		SQLiteRetention:  Duration{defaultSQLiteRetention},
+		DatadogURL:       defaultDatadogURL,
+		DatadogNamespace: defaultDatadogNamespace,
+		DatadogCounters:  defaultDatadogCounters,
+		DatadogIncludeTags: []string{"site_name", "name", "mac", "device_name", "port_idx", "radio",
+			"radio_name", "essid", "subsystem", "ap_name", "sw_name", "model", "type"},
+		// CloudWatch defaults.
+		CloudWatchNamespace:  defaultCloudWatchNS,
+		CloudWatchDimensions: []string{"site_name", "name", "subsystem"},
+		CloudWatchBatchSize:  defaultCloudWatchBatchSize,
+		// SNMP agent defaults.
+		SNMPBaseOID:     defaultSNMPBaseOID,
+		SNMPEngineID:    defaultSNMPEngineID,
+		SNMPV3AuthProto: defaultSNMPAuthProto,
+		SNMPV3PrivProto: defaultSNMPPrivProto,
+		// Kafka defaults.
+		KafkaTopicPrefix:  defaultKafkaTopicPrefix,
+		KafkaFormat:       defaultKafkaFormat,
+		KafkaCompression:  defaultKafkaCompression,
+		KafkaBatchSize:    defaultKafkaBatchSize,
+		KafkaBatchTimeout: Duration{defaultKafkaBatchTimeout},
+		KafkaRequiredAcks: defaultKafkaRequiredAcks,
+		// OpenTSDB defaults.
+		OpenTSDBPrefix:    defaultOpenTSDBPrefix,
+		OpenTSDBTags:      []string{"site_name", "name", "mac", "device_name", "port_idx", "radio", "essid", "subsystem"},
+		OpenTSDBMaxTags:   defaultOpenTSDBMaxTags,
+		OpenTSDBBatchSize: defaultOpenTSDBBatchSize,
+		// Site configuration inventory defaults.
+		ConfigInventoryInterval: Duration{defaultConfigInventory},
+	}
+}
+
 // Parse turns CLI arguments into data structures. Called by Start() on startup.
 func (f *Flag) Parse(args []string) {
 	f.FlagSet = pflag.NewFlagSet("unifi-poller", pflag.ExitOnError)
 	f.Usage = func() {
-		fmt.Println("Usage: unifi-poller [--config=/path/to/up.conf] [--version]")
+		fmt.Println("Usage: unifi-poller [--config=/path/to/up.conf] [--version] [command [--help]]")
 		f.PrintDefaults()
+		fmt.Println("Commands:\n  check    Nagios/Icinga compatible check plugin.")
+		fmt.Println("  query    Print history for a device, client or switch port from the SQLite output.")
+		fmt.Println("  topology Print the device and client graph as Graphviz DOT or JSON.")
+		fmt.Println("  backfill Write the controller's historical reports for a time range to the outputs.")
 	}
 	f.StringVarP(&f.DumpJSON, "dumpjson", "j", "",
 		"This debug option prints a json payload and exits. See man page for more info.")
 	f.StringVarP(&f.ConfigFile, "config", "c", DefaultConfFile, "Poller config file path.")
 	f.BoolVarP(&f.ShowVer, "version", "v", false, "Print the version and exit.")
+	f.SetInterspersed(false)  // Flags after a command belong to the command.
 	_ = f.FlagSet.Parse(args) // pflag.ExitOnError means this will never return error.
+	if f.NArg() > 0 {
+		f.parseCommand(f.Args())
+	}
+}
+
+// parseCommand parses the flags for a command. Every command accepts --config.
+// Unknown commands are not parsed; Run() returns an error for them.
+func (f *Flag) parseCommand(args []string) {
+	f.Command = strings.ToLower(args[0])
+	fs := pflag.NewFlagSet("unifi-poller "+f.Command, pflag.ExitOnError)
+	fs.StringVarP(&f.ConfigFile, "config", "c", f.ConfigFile, "Poller config file path.")
+	switch f.Command {
+	case "check":
+		f.Check = &CheckFlags{}
+		f.Check.register(fs)
+	case "query":
+		f.Query = &QueryFlags{}
+		f.Query.register(fs)
+	case "topology":
+		f.Topology = &TopologyFlags{}
+		f.Topology.register(fs)
+	case "backfill":
+		f.Backfill = &BackfillFlags{}
+		f.Backfill.register(fs)
+	default:
+		return
+	}
+	_ = fs.Parse(args[1:]) // pflag.ExitOnError means this will never return error.
 }
 
 // Run invokes all the application logic and routines.
 func (u *UnifiPoller) Run() (err error) {
-	if u.Flag.DumpJSON != "" {
+	switch {
+	case u.Flag.DumpJSON != "":
 		return u.DumpJSONPayload()
+	case u.Flag.Command == "check":
+		return u.RunCheck()
+	case u.Flag.Command == "query":
+		return u.RunQuery()
+	case u.Flag.Command == "topology":
+		return u.RunTopology()
+	case u.Flag.Command == "backfill":
+		return u.RunBackfill()
+	case u.Flag.Command != "":
+		return fmt.Errorf("unknown command: %s", u.Flag.Command)
 	}
 	if u.Config.Debug {
 		log.SetFlags(log.Lshortfile | log.Lmicroseconds | log.Ldate)
@@ -79,22 +167,38 @@ func (u *UnifiPoller) Run() (err error) {
 	}
 	u.Logf("Polling UniFi Controller at %s v%s as user %s. Sites: %v",
 		u.Config.UnifiBase, u.Unifi.ServerVersion, u.Config.UnifiUser, u.Config.Sites)
-	if err = u.GetInfluxDB(); err != nil {
-		return err
-	}
-	u.Logf("Logging Measurements to InfluxDB at %s as user %s", u.Config.InfluxURL, u.Config.InfluxUser)
 	switch strings.ToLower(u.Config.Mode) {
-	case "influxlambda", "lambdainflux", "lambda_influx", "influx_lambda":
+	case "influxlambda", "lambdainflux", "lambda_influx", "influx_lambda", "lambda":
 		u.LogDebugf("Lambda Mode Enabled")
+		if err = u.GetOutputs(); err != nil {
+			return err
+		}
+		u.LastCheck = time.Now()
+		return u.CollectAndReport()
+	case "exec", "telegraf", "telegraf_exec":
+		u.LogDebugf("Telegraf Exec Mode Enabled")
+		u.Outputs = []Output{NewLineProtocolOutput(os.Stdout)}
 		u.LastCheck = time.Now()
 		return u.CollectAndReport()
+	case "execd", "telegraf_execd":
+		u.LogDebugf("Telegraf Execd Mode Enabled")
+		u.Outputs = []Output{NewLineProtocolOutput(os.Stdout)}
+		return u.PollStdin(os.Stdin)
 	default:
+		if err = u.GetOutputs(); err != nil {
+			return err
+		}
 		return u.PollController()
 	}
 }
 
 // GetInfluxDB returns an InfluxDB interface.
+// Does nothing if InfluxDB is disabled in the config.
 func (u *UnifiPoller) GetInfluxDB() (err error) {
+	if u.Config.NoInflux {
+		u.Logf("InfluxDB output disabled")
+		return nil
+	}
 	u.Influx, err = influx.NewHTTPClient(influx.HTTPConfig{
 		Addr:     u.Config.InfluxURL,
 		Username: u.Config.InfluxUser,
@@ -103,9 +207,136 @@ func (u *UnifiPoller) GetInfluxDB() (err error) {
 	if err != nil {
 		return fmt.Errorf("influxdb: %v", err)
 	}
+	u.Logf("Logging Measurements to InfluxDB at %s as user %s", u.Config.InfluxURL, u.Config.InfluxUser)
 	return nil
 }
 
+// GetOutputs initializes InfluxDB and all the other configured outputs.
+func (u *UnifiPoller) GetOutputs() error {
+	if err := u.GetInfluxDB(); err != nil {
+		return err
+	}
+	if u.Config.FilePath != "" {
+		f, err := NewFileOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("file output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, f)
+		u.Logf("Writing Measurements to %s files in %s", f.Format, f.Path)
+	}
+	if u.Config.SplunkURL != "" {
+		s, err := NewSplunkOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("splunk output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, s)
+		u.Logf("Sending Events and Metrics to Splunk HEC at %s (ack: %v)", s.URL, s.Ack)
+	}
+	if u.Config.LokiURL != "" {
+		l, err := NewLokiOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("loki output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, l)
+		u.Logf("Pushing IDS and Change Events to Loki at %s as %s", l.URL, l.Format)
+		if !u.Config.CollectIDS {
+			u.Logf("loki output enabled, but collect_ids is false; only change events will be sent to loki")
+		}
+	}
+	if u.Config.ZabbixServer != "" {
+		z, err := NewZabbixOutput(u.Config, u.LogDebugf)
+		if err != nil {
+			return fmt.Errorf("zabbix output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, z)
+		u.Logf("Sending Measurements to Zabbix at %s as host %s", z.Server, z.Host)
+	}
+	if u.Config.NATSURL != "" {
+		n, err := NewNATSOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("nats output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, n)
+		u.Logf("Publishing Measurements to NATS at %s (jetstream: %v)", n.ConnectedUrl(), n.JetStream)
+	}
+	if u.Config.SQLitePath != "" {
+		s, err := NewSQLiteOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("sqlite output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, s)
+		u.Logf("Storing Measurements in SQLite database %s (retention: %v)", s.Path, s.Retention)
+	}
+	if u.Config.DatadogAPIKey != "" {
+		d, err := NewDatadogOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("datadog output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, d)
+		u.Logf("Sending Metrics to Datadog at %s (counters as: %s)", d.URL, d.Counters)
+	}
+	if u.Config.CloudWatchRegion != "" {
+		cw, err := NewCloudWatchOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("cloudwatch output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, cw)
+		u.Logf("Sending Metrics to CloudWatch at %s in namespace %s", cw.URL, cw.Namespace)
+	}
+	if u.Config.SNMPListen != "" {
+		s, err := NewSNMPOutput(u.Config, u.LogDebugf, u.LogErrorf)
+		if err != nil {
+			return fmt.Errorf("snmp output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, s)
+		u.Logf("Serving SNMP on %s under %s (v2c: %v, v3: %v)", s.Listen, u.Config.SNMPBaseOID, s.Community != "", s.User != "")
+		if u.Config.SNMPBaseOID == defaultSNMPBaseOID {
+			u.Logf("snmp_base_oid is the default, in net-snmp's experimental playpen; set an OID you own in production")
+		}
+	}
+	if len(u.Config.KafkaBrokers) > 0 {
+		k, err := NewKafkaOutput(u.Config, u.LogError)
+		if err != nil {
+			return fmt.Errorf("kafka output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, k)
+		u.Logf("Producing %s records to Kafka at %s (topics: %s<measurement>, async: %v)",
+			k.Format, strings.Join(k.Brokers, ","), k.TopicPrefix, k.config.Async)
+	}
+	if u.Config.OpenTSDBURL != "" {
+		o, err := NewOpenTSDBOutput(u.Config)
+		if err != nil {
+			return fmt.Errorf("opentsdb output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, o)
+		u.Logf("Sending Metrics to OpenTSDB at %s (prefix: %s, tags: %s)", o.URL, o.Prefix, strings.Join(o.Tags, ","))
+	}
+	if len(u.Config.Webhooks) > 0 {
+		w, err := NewWebhookOutput(u.Config.Webhooks)
+		if err != nil {
+			return fmt.Errorf("webhook output: %v", err)
+		}
+		u.Outputs = append(u.Outputs, w)
+		u.Logf("Sending Metrics to %d Webhook(s)", len(w.hooks))
+	}
+	if u.Influx == nil && len(u.Outputs) == 0 {
+		return fmt.Errorf("influxdb is disabled and no other outputs are configured")
+	}
+	return nil
+}
+
+// CloseOutputs closes InfluxDB and all the other outputs, releasing their
+// connections, files and sockets. Failures are logged.
+func (u *UnifiPoller) CloseOutputs() {
+	if u.Influx != nil {
+		u.LogError(u.Influx.Close(), "influxdb.Close()")
+	}
+	for _, o := range u.Outputs {
+		u.LogError(o.Close(), o.Name()+".Close()")
+	}
+	u.Influx, u.Outputs = nil, nil
+}
+
 // GetUnifi returns a UniFi controller interface.
 func (u *UnifiPoller) GetUnifi() (err error) {
 	// Create an authenticated session to the Unifi Controller.
@@ -0,0 +1,40 @@
+package unifipoller
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testOutput records calls. Its methods fail when err is set.
+type testOutput struct {
+	name    string
+	err     error
+	written int
+	closed  int
+}
+
+func (o *testOutput) Name() string { return o.name }
+
+func (o *testOutput) WriteMetrics(*Metrics) error {
+	o.written++
+	return o.err
+}
+
+func (o *testOutput) Close() error {
+	o.closed++
+	return o.err
+}
+
+func TestCloseOutputs(t *testing.T) {
+	good, bad := &testOutput{name: "good"}, &testOutput{name: "bad", err: fmt.Errorf("close failed")}
+	errs := []string{}
+	u := &UnifiPoller{Config: &Config{Quiet: true}, Outputs: []Output{bad, good}}
+	u.onError = func(msg string) { errs = append(errs, msg) }
+	u.CloseOutputs()
+	if good.closed != 1 || bad.closed != 1 {
+		t.Errorf("every output should be closed once: good=%d bad=%d", good.closed, bad.closed)
+	}
+	if len(errs) != 1 || u.Outputs != nil {
+		t.Errorf("wrong result: errors=%v outputs=%v", errs, u.Outputs)
+	}
+}
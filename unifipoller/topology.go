@@ -0,0 +1,361 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"golift.io/unifi"
+)
+
+// DeviceLinks are a device's uplink and LLDP neighbors.
+type DeviceLinks struct {
+	SiteName string `json:"-"`
+	Mac      string `json:"mac"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Model    string `json:"model"`
+	IP       string `json:"ip"`
+	Uplink   struct {
+		Name             string        `json:"-"` // The uplink device's name.
+		Type             string        `json:"type"`
+		PortIdx          unifi.FlexInt `json:"port_idx"`
+		Speed            unifi.FlexInt `json:"speed"`
+		UplinkMac        string        `json:"uplink_mac"`
+		UplinkRemotePort unifi.FlexInt `json:"uplink_remote_port"`
+	} `json:"uplink"`
+	LldpTable []*LLDPNeighbor `json:"lldp_table"`
+}
+
+// LLDPNeighbor is an entry in a device's LLDP table.
+type LLDPNeighbor struct {
+	Name          string         `json:"-"` // The neighbor's name, if it is one of our devices.
+	ChassisID     string         `json:"chassis_id"`
+	IsWired       unifi.FlexBool `json:"is_wired"`
+	LocalPortIdx  unifi.FlexInt  `json:"local_port_idx"`
+	LocalPortName string         `json:"local_port_name"`
+	PortID        string         `json:"port_id"`
+}
+
+// GetDeviceLinks returns the uplink and LLDP neighbors of every device in the
+// provided sites. Neighbors that are our own devices are named.
+func (u *UnifiPoller) GetDeviceLinks(sites unifi.Sites, devices SiteDevices) ([]*DeviceLinks, error) {
+	data := []*DeviceLinks{}
+	for _, site := range sites {
+		var response []*DeviceLinks
+		if err := devices.decode(site, &response); err != nil {
+			return data, err
+		}
+		for _, d := range response {
+			d.SiteName = site.SiteName
+		}
+		data = append(data, response...)
+	}
+	names := make(map[string]string)
+	for _, d := range data {
+		names[strings.ToLower(d.Mac)] = d.Name
+	}
+	for _, d := range data {
+		d.Uplink.Name = names[strings.ToLower(d.Uplink.UplinkMac)]
+		for _, n := range d.LldpTable {
+			n.Name = names[strings.ToLower(n.ChassisID)]
+		}
+	}
+	return data, nil
+}
+
+// TopologyFlags are the CLI arguments for the topology command.
+type TopologyFlags struct {
+	Sites   []string
+	Format  string
+	Clients bool
+}
+
+// register adds the topology command's flags to a flag set.
+func (t *TopologyFlags) register(fs *pflag.FlagSet) {
+	fs.StringSliceVarP(&t.Sites, "site", "s", nil, "Site(s) to export. Default is the sites in the config file.")
+	fs.StringVarP(&t.Format, "format", "f", "dot", "Output format: dot (Graphviz) or json.")
+	fs.BoolVar(&t.Clients, "clients", true, "Include clients. Use --clients=false for devices only.")
+}
+
+// topologySite is one site's graph: every device, its ports, and what is
+// connected to each port. Everything is sorted, so two exports can be diffed.
+type topologySite struct {
+	Site    string          `json:"site"`
+	Devices []*topologyNode `json:"devices"`
+}
+
+// topologyNode is a device in the graph.
+type topologyNode struct {
+	Mac   string          `json:"mac"`
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Model string          `json:"model,omitempty"`
+	IP    string          `json:"ip,omitempty"`
+	Ports []*topologyPort `json:"ports"`
+}
+
+// topologyPort is a device port. Wireless links and links with an unknown
+// local port have an empty port.
+type topologyPort struct {
+	Port  string          `json:"port"`
+	Links []*topologyLink `json:"links"`
+}
+
+// topologyLink is the device or client on the other end of a port.
+type topologyLink struct {
+	Mac  string `json:"mac"`
+	Name string `json:"name"`
+	Type string `json:"type"`           // A device type, client, or neighbor for LLDP neighbors that are not ours.
+	Port string `json:"port,omitempty"` // The port on the other end, when known.
+	Via  string `json:"via"`            // uplink, mesh, lldp, wired or wireless.
+}
+
+// topologyEdge connects port APort on A with port BPort on B.
+type topologyEdge struct {
+	A, APort string
+	B, BPort string
+	Via      string
+}
+
+// RunTopology runs the topology command. It logs into the controller and prints
+// each site's device graph as Graphviz DOT or JSON.
+func (u *UnifiPoller) RunTopology() error {
+	t := u.Flag.Topology
+	u.Config.Quiet = true
+	if len(t.Sites) > 0 {
+		u.Config.Sites = t.Sites
+	}
+	if t.Format = strings.ToLower(t.Format); t.Format != "dot" && t.Format != "json" {
+		return fmt.Errorf("invalid format: %s (use dot or json)", t.Format)
+	}
+	if err := u.GetUnifi(); err != nil {
+		return err
+	}
+	sites, err := u.GetFilteredSites()
+	if err != nil {
+		return err
+	}
+	devices, err := u.GetSiteDevices(sites)
+	if err != nil {
+		return err
+	}
+	links, err := u.GetDeviceLinks(sites, devices)
+	if err != nil {
+		return err
+	}
+	var clients unifi.Clients
+	if t.Clients {
+		if clients, err = u.Unifi.GetClients(sites); err != nil {
+			return err
+		}
+	}
+	topo := buildTopology(sites, links, clients)
+	if t.Format == "json" {
+		return writeTopologyJSON(os.Stdout, topo)
+	}
+	return writeTopologyDOT(os.Stdout, topo)
+}
+
+// buildTopology joins device uplinks, LLDP tables and clients into one graph per
+// site. A link reported more than once (an uplink, and the LLDP entry on the
+// other end) is kept once; the first report wins and later ones fill in ports.
+func buildTopology(sites unifi.Sites, links []*DeviceLinks, clients unifi.Clients) []*topologySite {
+	nodes := make(map[string]*topologyLink) // Everything that may be on the end of a link, by MAC.
+	for _, d := range links {
+		nodes[strings.ToLower(d.Mac)] = &topologyLink{Mac: strings.ToLower(d.Mac), Name: d.Name, Type: d.Type}
+	}
+	for _, c := range clients {
+		name := c.Name
+		if name == "" {
+			name = c.Hostname
+		}
+		mac := strings.ToLower(c.Mac)
+		if nodes[mac] == nil {
+			nodes[mac] = &topologyLink{Mac: mac, Name: name, Type: "client"}
+		}
+	}
+	edges := []*topologyEdge{}
+	seen := make(map[string]*topologyEdge)
+	add := func(e *topologyEdge) {
+		e.A, e.B = strings.ToLower(e.A), strings.ToLower(e.B)
+		if e.A == "" || e.B == "" || e.A == e.B {
+			return
+		}
+		key := e.A + "-" + e.B
+		if e.B < e.A {
+			key = e.B + "-" + e.A
+		}
+		old, ok := seen[key]
+		switch {
+		case !ok:
+			seen[key] = e
+			edges = append(edges, e)
+		case old.A == e.A:
+			old.APort, old.BPort = firstString(old.APort, e.APort), firstString(old.BPort, e.BPort)
+		default:
+			old.APort, old.BPort = firstString(old.APort, e.BPort), firstString(old.BPort, e.APort)
+		}
+	}
+	for _, d := range links {
+		via := "uplink"
+		if d.Uplink.Type == "wireless" {
+			via = "mesh"
+		}
+		add(&topologyEdge{A: d.Mac, APort: d.Uplink.PortIdx.Txt,
+			B: d.Uplink.UplinkMac, BPort: d.Uplink.UplinkRemotePort.Txt, Via: via})
+	}
+	for _, d := range links {
+		for _, n := range d.LldpTable {
+			add(&topologyEdge{A: d.Mac, APort: n.LocalPortIdx.Txt, B: n.ChassisID, BPort: n.PortID, Via: "lldp"})
+		}
+	}
+	for _, c := range clients {
+		if c.IsWired.Val {
+			add(&topologyEdge{A: c.SwMac, APort: c.SwPort.Txt, B: c.Mac, Via: "wired"})
+		} else {
+			add(&topologyEdge{A: c.ApMac, B: c.Mac, Via: "wireless"})
+		}
+	}
+	topo := []*topologySite{}
+	for _, site := range sites {
+		s := &topologySite{Site: site.SiteName, Devices: []*topologyNode{}}
+		for _, d := range links {
+			if d.SiteName == site.SiteName {
+				s.Devices = append(s.Devices, topologyDevice(d, edges, nodes))
+			}
+		}
+		sort.Slice(s.Devices, func(i, j int) bool { return s.Devices[i].Mac < s.Devices[j].Mac })
+		topo = append(topo, s)
+	}
+	return topo
+}
+
+// topologyDevice returns a device and everything linked to each of its ports.
+func topologyDevice(d *DeviceLinks, edges []*topologyEdge, nodes map[string]*topologyLink) *topologyNode {
+	mac := strings.ToLower(d.Mac)
+	node := &topologyNode{Mac: mac, Name: d.Name, Type: d.Type, Model: d.Model, IP: d.IP, Ports: []*topologyPort{}}
+	ports := make(map[string]*topologyPort)
+	for _, e := range edges {
+		port, peer, peerPort := e.APort, e.B, e.BPort
+		if e.B == mac {
+			port, peer, peerPort = e.BPort, e.A, e.APort
+		} else if e.A != mac {
+			continue
+		}
+		if ports[port] == nil {
+			ports[port] = &topologyPort{Port: port, Links: []*topologyLink{}}
+			node.Ports = append(node.Ports, ports[port])
+		}
+		link := &topologyLink{Mac: peer, Type: "neighbor", Port: peerPort, Via: e.Via}
+		if n := nodes[peer]; n != nil {
+			link.Name, link.Type = n.Name, n.Type
+		}
+		ports[port].Links = append(ports[port].Links, link)
+	}
+	sort.Slice(node.Ports, func(i, j int) bool { return portLess(node.Ports[i].Port, node.Ports[j].Port) })
+	for _, p := range node.Ports {
+		sort.Slice(p.Links, func(i, j int) bool { return p.Links[i].Mac < p.Links[j].Mac })
+	}
+	return node
+}
+
+// writeTopologyJSON writes the graph as indented JSON.
+func writeTopologyJSON(w io.Writer, topo []*topologySite) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(topo)
+}
+
+// writeTopologyDOT writes the graph in Graphviz DOT format. Each site is a
+// cluster; port numbers are on the ends of each edge. Wireless edges are dashed.
+func writeTopologyDOT(w io.Writer, topo []*topologySite) error {
+	var b strings.Builder
+	b.WriteString("graph unifi {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	drawn := make(map[string]bool)
+	for i, s := range topo {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", i, dotQuote(s.Site))
+		for _, d := range s.Devices {
+			fmt.Fprintf(&b, "\t\t%s [label=%s];\n", dotQuote(d.Mac), dotQuote(firstString(d.Name, d.Mac), d.Model, d.IP))
+			drawn[d.Mac] = true
+		}
+		for _, d := range s.Devices {
+			for _, p := range d.Ports {
+				for _, l := range p.Links {
+					if drawn[l.Mac] {
+						continue
+					}
+					shape := "ellipse"
+					if l.Type == "neighbor" {
+						shape = "diamond"
+					}
+					fmt.Fprintf(&b, "\t\t%s [label=%s, shape=%s];\n", dotQuote(l.Mac), dotQuote(l.Name, l.Mac), shape)
+					drawn[l.Mac] = true
+				}
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	edges := make(map[string]bool)
+	for _, s := range topo {
+		for _, d := range s.Devices {
+			for _, p := range d.Ports {
+				for _, l := range p.Links {
+					if edges[l.Mac+"-"+d.Mac] {
+						continue // Drawn from the other end.
+					}
+					edges[d.Mac+"-"+l.Mac] = true
+					style := ""
+					if l.Via == "wireless" || l.Via == "mesh" {
+						style = ", style=dashed"
+					}
+					fmt.Fprintf(&b, "\t%s -- %s [taillabel=%s, headlabel=%s, tooltip=%s%s];\n",
+						dotQuote(d.Mac), dotQuote(l.Mac), dotQuote(p.Port), dotQuote(l.Port), dotQuote(l.Via), style)
+				}
+			}
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns a quoted DOT string with each non-empty line on its own line.
+func dotQuote(lines ...string) string {
+	out := []string{}
+	for _, l := range lines {
+		if l != "" {
+			out = append(out, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(l))
+		}
+	}
+	return `"` + strings.Join(out, `\n`) + `"`
+}
+
+// portLess sorts port numbers numerically, and names after numbers.
+func portLess(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return x < y
+	case errA == nil || errB == nil:
+		return errA == nil
+	default:
+		return a < b
+	}
+}
+
+// firstString returns the first non-empty string.
+func firstString(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
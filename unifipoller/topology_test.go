@@ -0,0 +1,279 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golift.io/unifi"
+)
+
+// testTopologyDevices is a site's device list: a gateway, a switch behind it
+// with an LLDP neighbor that is not ours, and an access point behind the switch.
+const testTopologyDevices = `[
+	{"mac": "aa:00", "name": "Gateway", "type": "ugw", "model": "UGW3", "ip": "10.0.0.1",
+	 "lldp_table": [{"chassis_id": "AA:01", "is_wired": true, "local_port_idx": 2, "port_id": "1"}]},
+	{"mac": "AA:01", "name": "Core", "type": "usw", "model": "US8", "ip": "10.0.0.2",
+	 "uplink": {"type": "wire", "port_idx": 1, "uplink_mac": "aa:00", "uplink_remote_port": 2},
+	 "lldp_table": [{"chassis_id": "ff:ff", "is_wired": true, "local_port_idx": 8, "port_id": "Gi0/1"}]},
+	{"mac": "aa:02", "name": "Office", "type": "uap", "model": "U7PG2",
+	 "uplink": {"type": "wire", "port_idx": 1, "uplink_mac": "aa:01", "uplink_remote_port": 3}}
+]`
+
+// testTopologyClients are a wired client on the switch and a wireless one on the AP.
+var testTopologyClients = unifi.Clients{
+	{Mac: "bb:01", Hostname: "nas", IsWired: unifi.FlexBool{Val: true}, SwMac: "aa:01", SwPort: unifi.FlexInt{Val: 4, Txt: "4"}},
+	{Mac: "BB:02", Name: "Phone", Hostname: "android-1", ApMac: "aa:02"},
+}
+
+// testDeviceLinks decodes each site's device list the way a poll does.
+func testDeviceLinks(t *testing.T, sites unifi.Sites, devices ...string) []*DeviceLinks {
+	t.Helper()
+	raw := make(SiteDevices)
+	for i, site := range sites {
+		raw[site.Name] = json.RawMessage(devices[i])
+	}
+	links, err := (&UnifiPoller{}).GetDeviceLinks(sites, raw)
+	if err != nil {
+		t.Fatalf("GetDeviceLinks: %v", err)
+	}
+	return links
+}
+
+func TestBuildTopology(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	lab := &unifi.Site{Name: "lab", SiteName: "Lab (lab)"}
+	gateway := &topologyLink{Mac: "aa:00", Name: "Gateway", Type: "ugw"}
+	core := &topologyLink{Mac: "aa:01", Name: "Core", Type: "usw"}
+	office := &topologyLink{Mac: "aa:02", Name: "Office", Type: "uap"}
+	link := func(l *topologyLink, port, via string) *topologyLink {
+		return &topologyLink{Mac: l.Mac, Name: l.Name, Type: l.Type, Port: port, Via: via}
+	}
+	gatewayNode := &topologyNode{Mac: "aa:00", Name: "Gateway", Type: "ugw", Model: "UGW3", IP: "10.0.0.1",
+		Ports: []*topologyPort{{Port: "2", Links: []*topologyLink{link(core, "1", "uplink")}}}}
+	tests := []struct {
+		name    string
+		sites   unifi.Sites
+		devices []string
+		clients unifi.Clients
+		want    []*topologySite
+	}{
+		{
+			name:    "devices, clients and neighbors",
+			sites:   unifi.Sites{site},
+			devices: []string{testTopologyDevices},
+			clients: testTopologyClients,
+			want: []*topologySite{{Site: "Default (default)", Devices: []*topologyNode{
+				gatewayNode,
+				{Mac: "aa:01", Name: "Core", Type: "usw", Model: "US8", IP: "10.0.0.2", Ports: []*topologyPort{
+					{Port: "1", Links: []*topologyLink{link(gateway, "2", "uplink")}},
+					{Port: "3", Links: []*topologyLink{link(office, "1", "uplink")}},
+					{Port: "4", Links: []*topologyLink{{Mac: "bb:01", Name: "nas", Type: "client", Via: "wired"}}},
+					{Port: "8", Links: []*topologyLink{{Mac: "ff:ff", Type: "neighbor", Port: "Gi0/1", Via: "lldp"}}},
+				}},
+				{Mac: "aa:02", Name: "Office", Type: "uap", Model: "U7PG2", Ports: []*topologyPort{
+					{Port: "1", Links: []*topologyLink{link(core, "3", "uplink")}},
+					{Port: "", Links: []*topologyLink{{Mac: "bb:02", Name: "Phone", Type: "client", Via: "wireless"}}},
+				}},
+			}}},
+		},
+		{
+			name:  "lldp fills in a missing uplink port",
+			sites: unifi.Sites{site},
+			devices: []string{`[
+				{"mac": "aa:00", "name": "Gateway", "type": "ugw", "model": "UGW3", "ip": "10.0.0.1",
+				 "lldp_table": [{"chassis_id": "aa:01", "local_port_idx": 2, "port_id": "1"}]},
+				{"mac": "aa:01", "name": "Core", "type": "usw", "model": "US8", "ip": "10.0.0.2",
+				 "uplink": {"type": "wire", "uplink_mac": "aa:00"}}]`},
+			want: []*topologySite{{Site: "Default (default)", Devices: []*topologyNode{
+				gatewayNode,
+				{Mac: "aa:01", Name: "Core", Type: "usw", Model: "US8", IP: "10.0.0.2", Ports: []*topologyPort{
+					{Port: "1", Links: []*topologyLink{link(gateway, "2", "uplink")}},
+				}},
+			}}},
+		},
+		{
+			name:  "mesh uplinks and sites",
+			sites: unifi.Sites{site, lab},
+			devices: []string{`[]`, `[
+				{"mac": "aa:02", "name": "Office", "type": "uap", "model": "U7PG2",
+				 "uplink": {"type": "wireless", "uplink_mac": "aa:03"}},
+				{"mac": "aa:03", "name": "Lab", "type": "uap", "model": "UAL6"}]`},
+			want: []*topologySite{
+				{Site: "Default (default)", Devices: []*topologyNode{}},
+				{Site: "Lab (lab)", Devices: []*topologyNode{
+					{Mac: "aa:02", Name: "Office", Type: "uap", Model: "U7PG2", Ports: []*topologyPort{
+						{Port: "", Links: []*topologyLink{{Mac: "aa:03", Name: "Lab", Type: "uap", Via: "mesh"}}},
+					}},
+					{Mac: "aa:03", Name: "Lab", Type: "uap", Model: "UAL6", Ports: []*topologyPort{
+						{Port: "", Links: []*topologyLink{link(office, "", "mesh")}},
+					}},
+				}},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := buildTopology(test.sites, testDeviceLinks(t, test.sites, test.devices...), test.clients)
+		if !reflect.DeepEqual(got, test.want) {
+			g, _ := json.Marshal(got)
+			w, _ := json.Marshal(test.want)
+			t.Errorf("%s:\n got %s\nwant %s", test.name, g, w)
+		}
+	}
+}
+
+func TestGetDeviceLinksNames(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	links := testDeviceLinks(t, unifi.Sites{site}, testTopologyDevices)
+	if len(links) != 3 || links[1].SiteName != "Default (default)" {
+		t.Fatalf("wrong links: %v", links)
+	}
+	if links[1].Uplink.Name != "Gateway" || links[0].LldpTable[0].Name != "Core" || links[1].LldpTable[0].Name != "" {
+		t.Errorf("uplinks and neighbors that are our devices should be named: %q %q %q",
+			links[1].Uplink.Name, links[0].LldpTable[0].Name, links[1].LldpTable[0].Name)
+	}
+	if _, err := (&UnifiPoller{}).GetDeviceLinks(unifi.Sites{site}, SiteDevices{}); err == nil {
+		t.Error("a site whose devices were not read did not return an error")
+	}
+}
+
+func TestWriteTopology(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: `Home "A"`}
+	topo := buildTopology(unifi.Sites{site}, testDeviceLinks(t, unifi.Sites{site}, `[
+		{"mac": "aa:01", "name": "Core", "type": "usw", "model": "US8", "ip": "10.0.0.2",
+		 "lldp_table": [{"chassis_id": "ff:ff", "local_port_idx": 8, "port_id": "Gi0/1"}]},
+		{"mac": "aa:02", "name": "Office", "type": "uap", "model": "U7PG2",
+		 "uplink": {"type": "wire", "port_idx": 1, "uplink_mac": "aa:01", "uplink_remote_port": 3}}]`),
+		unifi.Clients{{Mac: "bb:02", Name: "Phone", ApMac: "aa:02"}})
+	tests := []struct {
+		format string
+		write  func(*strings.Builder) error
+		want   string
+	}{
+		{
+			format: "dot",
+			write:  func(b *strings.Builder) error { return writeTopologyDOT(b, topo) },
+			want: `graph unifi {
+	rankdir=LR;
+	node [shape=box];
+	subgraph cluster_0 {
+		label="Home \"A\"";
+		"aa:01" [label="Core\nUS8\n10.0.0.2"];
+		"aa:02" [label="Office\nU7PG2"];
+		"ff:ff" [label="ff:ff", shape=diamond];
+		"bb:02" [label="Phone\nbb:02", shape=ellipse];
+	}
+	"aa:01" -- "aa:02" [taillabel="3", headlabel="1", tooltip="uplink"];
+	"aa:01" -- "ff:ff" [taillabel="8", headlabel="Gi0/1", tooltip="lldp"];
+	"aa:02" -- "bb:02" [taillabel="", headlabel="", tooltip="wireless", style=dashed];
+}
+`,
+		},
+		{
+			format: "json",
+			write:  func(b *strings.Builder) error { return writeTopologyJSON(b, topo) },
+			want: `[
+  {
+    "site": "Home \"A\"",
+    "devices": [
+      {
+        "mac": "aa:01",
+        "name": "Core",
+        "type": "usw",
+        "model": "US8",
+        "ip": "10.0.0.2",
+        "ports": [
+          {
+            "port": "3",
+            "links": [
+              {
+                "mac": "aa:02",
+                "name": "Office",
+                "type": "uap",
+                "port": "1",
+                "via": "uplink"
+              }
+            ]
+          },
+          {
+            "port": "8",
+            "links": [
+              {
+                "mac": "ff:ff",
+                "name": "",
+                "type": "neighbor",
+                "port": "Gi0/1",
+                "via": "lldp"
+              }
+            ]
+          }
+        ]
+      },
+      {
+        "mac": "aa:02",
+        "name": "Office",
+        "type": "uap",
+        "model": "U7PG2",
+        "ports": [
+          {
+            "port": "1",
+            "links": [
+              {
+                "mac": "aa:01",
+                "name": "Core",
+                "type": "usw",
+                "port": "3",
+                "via": "uplink"
+              }
+            ]
+          },
+          {
+            "port": "",
+            "links": [
+              {
+                "mac": "bb:02",
+                "name": "Phone",
+                "type": "client",
+                "via": "wireless"
+              }
+            ]
+          }
+        ]
+      }
+    ]
+  }
+]
+`,
+		},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		if err := test.write(&b); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+		} else if b.String() != test.want {
+			t.Errorf("wrong %s output:\n%s\nwant:\n%s", test.format, b.String(), test.want)
+		}
+	}
+}
+
+func TestTopologyPoints(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	links := testDeviceLinks(t, unifi.Sites{site}, testTopologyDevices)
+	points, err := TopologyPoints(links[1], testTime)
+	if err != nil || len(points) != 2 {
+		t.Fatalf("TopologyPoints: %v %v", points, err)
+	}
+	// Both kinds of link name the port on each end.
+	for i, want := range []map[string]string{
+		{"link": "uplink", "local_port": "1", "remote_mac": "aa:00", "remote_name": "Gateway", "remote_port": "2"},
+		{"link": "lldp", "local_port": "8", "remote_mac": "ff:ff", "remote_name": "", "remote_port": "Gi0/1"},
+	} {
+		tags := points[i].Tags()
+		for k, v := range want {
+			if tags[k] != v {
+				t.Errorf("%s tag %s = %q, want %q", want["link"], k, tags[k], v)
+			}
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package unifipoller
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"time"
@@ -11,10 +13,11 @@ import (
 )
 
 // CheckSites makes sure the list of provided sites exists on the controller.
-// This does not run in Lambda (run-once) mode.
+// This does not run in Lambda or Telegraf exec (run-once) modes.
 func (u *UnifiPoller) CheckSites() error {
-	if strings.Contains(strings.ToLower(u.Config.Mode), "lambda") {
-		return nil // Skip this in lambda mode.
+	mode := strings.ToLower(u.Config.Mode)
+	if strings.Contains(mode, "lambda") || StringInSlice(mode, []string{"exec", "telegraf", "telegraf_exec"}) {
+		return nil // Skip this in run-once modes.
 	}
 	u.LogDebugf("Checking Controller Sites List")
 	sites, err := u.Unifi.GetSites()
@@ -50,23 +53,47 @@ func (u *UnifiPoller) PollController() error {
 	log.Println("[INFO] Everything checks out! Poller started, interval:", interval)
 	ticker := time.NewTicker(interval)
 	for u.LastCheck = range ticker.C {
-		var err error
-		if u.Config.ReAuth {
-			u.LogDebugf("Re-authenticating to UniFi Controller")
-			// Some users need to re-auth every interval because the cookie times out.
-			if err = u.Unifi.Login(); err != nil {
-				u.LogError(err, "re-authenticating")
-			}
+		if err := u.pollOnce(); err != nil {
+			return err
 		}
-		if err == nil {
-			// Only run this if the authentication procedure didn't return error.
-			_ = u.CollectAndReport()
+	}
+	return nil
+}
+
+// PollStdin polls UniFi and prints the metrics every time a new line is read.
+// This is used by Telegraf's execd input plugin, which sends a new line on
+// stdin every interval. Returns when stdin is closed.
+func (u *UnifiPoller) PollStdin(stdin io.Reader) error {
+	log.Println("[INFO] Everything checks out! Poller started, waiting for input on stdin.")
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		u.LastCheck = time.Now()
+		if err := u.pollOnce(); err != nil {
+			return err
 		}
-		if u.Config.MaxErrors >= 0 && u.errorCount > u.Config.MaxErrors {
-			return fmt.Errorf("reached maximum error count, stopping poller (%d > %d)",
-				u.errorCount, u.Config.MaxErrors)
+	}
+	return scanner.Err()
+}
+
+// pollOnce re-authenticates (if configured), then collects and reports metrics.
+// Only returns an error when the maximum error count is reached.
+func (u *UnifiPoller) pollOnce() error {
+	var err error
+	if u.Config.ReAuth {
+		u.LogDebugf("Re-authenticating to UniFi Controller")
+		// Some users need to re-auth every interval because the cookie times out.
+		if err = u.Unifi.Login(); err != nil {
+			u.LogError(err, "re-authenticating")
 		}
 	}
+	if err == nil {
+		// Only run this if the authentication procedure didn't return error.
+		_ = u.CollectAndReport()
+	}
+	if u.Config.MaxErrors >= 0 && u.errorCount > u.Config.MaxErrors {
+		return fmt.Errorf("reached maximum error count, stopping poller (%d > %d)",
+			u.errorCount, u.Config.MaxErrors)
+	}
 	return nil
 }
 
@@ -83,9 +110,7 @@ func (u *UnifiPoller) CollectAndReport() error {
 	if err := u.AugmentMetrics(metrics); err != nil {
 		return err
 	}
-	err = u.ReportMetrics(metrics)
-	u.LogError(err, "reporting metrics")
-	return err
+	return u.ReportMetrics(metrics) // Failures are logged by ReportMetrics.
 }
 
 // CollectMetrics grabs all the measurements from a UniFi controller and returns them.
@@ -102,10 +127,85 @@ func (u *UnifiPoller) CollectMetrics() (*Metrics, error) {
 		u.LogError(err, "unifi.GetIDS()")
 	}
 	// Get all the points.
+	start := time.Now()
 	m.Clients, err = u.Unifi.GetClients(m.Sites)
 	u.LogError(err, "unifi.GetClients()")
+	clientsTime, start := time.Since(start), time.Now()
 	m.Devices, err = u.Unifi.GetDevices(m.Sites)
 	u.LogError(err, "unifi.GetDevices()")
+	devicesTime := time.Since(start)
+	if u.Config.CollectRogueAPs {
+		m.RogueAPs, err = u.GetRogueAPs(m.Sites)
+		u.LogError(err, "GetRogueAPs()")
+	}
+	var devices SiteDevices
+	if u.Config.CollectTopology || u.Config.CollectPortMACs || u.Config.CollectSFP || u.Config.CollectVPN {
+		// One read of each site's devices serves every collector below.
+		devices, err = u.GetSiteDevices(m.Sites)
+		u.LogError(err, "GetSiteDevices()")
+	}
+	if u.Config.CollectTopology {
+		m.DeviceLinks, err = u.GetDeviceLinks(m.Sites, devices)
+		u.LogError(err, "GetDeviceLinks()")
+	}
+	if u.Config.CollectPortMACs {
+		m.PortMACs, err = u.GetSwitchMACTables(m.Sites, devices)
+		u.LogError(err, "GetSwitchMACTables()")
+	}
+	if u.Config.CollectSFP {
+		m.SFPModules, err = u.GetSFPModules(m.Sites, devices)
+		u.LogError(err, "GetSFPModules()")
+	}
+	if u.Config.CollectController {
+		m.Controller, err = u.GetControllerInfo(m.Sites)
+		u.LogError(err, "GetControllerInfo()")
+		if m.Controller != nil {
+			m.Controller.addSelfStats(m, clientsTime, devicesTime)
+			if e := u.controllerVersionEvent(m.Controller); e != nil {
+				m.Events = append(m.Events, e)
+			}
+		}
+	}
+	kinds := []siteConfigKind{}
+	if u.Config.CollectConfig {
+		kinds = append(kinds, siteConfigKinds...)
+	}
+	if u.Config.CollectFirewall {
+		kinds = append(kinds, firewallConfigKinds...)
+		m.Forwards, err = u.GetPortForwards(m.Sites)
+		u.LogError(err, "GetPortForwards()")
+		m.Routes, err = u.GetRoutes(m.Sites)
+		u.LogError(err, "GetRoutes()")
+	}
+	var configs []*SiteConfigs
+	if len(kinds) > 0 {
+		configs, err = u.GetSiteConfigs(m.Sites, kinds)
+		u.LogError(err, "GetSiteConfigs()")
+		if err == nil {
+			var events []*Event
+			m.SiteConfigs, events = u.trackSiteConfigs(configs)
+			m.Events = append(m.Events, events...)
+		}
+		for _, s := range configs {
+			if s.Kind == "firewallrule" {
+				m.Firewall = append(m.Firewall, s) // Rule counters are written every poll.
+			}
+		}
+	}
+	if u.Config.CollectVPN {
+		m.VPNTunnels, err = u.GetVPNTunnels(m.Sites, devices, configs)
+		u.LogError(err, "GetVPNTunnels()")
+		if err == nil {
+			m.Events = append(m.Events, u.vpnTunnelEvents(m.VPNTunnels)...)
+		}
+		m.VPNUsers, err = u.GetRemoteUserSessions(m.Sites)
+		u.LogError(err, "GetRemoteUserSessions()")
+	}
+	if u.Config.CollectHotspot {
+		m.Hotspots, err = u.GetHotspots(m.Sites)
+		u.LogError(err, "GetHotspots()")
+		u.flagHotspotNew(m.Hotspots)
+	}
 	// Make a new Influx Points Batcher.
 	m.BatchPoints, err = influx.NewBatchPoints(influx.BatchPointsConfig{Database: u.Config.InfluxDB})
 	u.LogError(err, "influx.NewBatchPoints")
@@ -114,7 +214,8 @@ func (u *UnifiPoller) CollectMetrics() (*Metrics, error) {
 
 // AugmentMetrics is our middleware layer between collecting metrics and writing them.
 // This is where we can manipuate the returned data or make arbitrary decisions.
-// This function currently adds parent device names to client metrics.
+// This function currently adds parent device names to client and rogue AP metrics,
+// and client names to switch port MAC tables.
 func (u *UnifiPoller) AugmentMetrics(metrics *Metrics) error {
 	devices := make(map[string]string)
 	bssdIDs := make(map[string]string)
@@ -140,20 +241,22 @@ func (u *UnifiPoller) AugmentMetrics(metrics *Metrics) error {
 		metrics.Clients[i].GwName = devices[c.GwMac]
 		metrics.Clients[i].RadioDescription = bssdIDs[metrics.Clients[i].Bssid] + metrics.Clients[i].RadioProto
 	}
+	if len(metrics.RogueAPs) > 0 {
+		u.flagRogueAPs(metrics, devices)
+	}
+	nameSwitchMACs(metrics.PortMACs, metrics.Clients)
 	return nil
 }
 
-// ReportMetrics batches all the metrics and writes them to InfluxDB.
-// Returns an error if the write to influx fails.
+// ReportMetrics batches all the metrics and writes them to InfluxDB and any other outputs.
+// Every destination is written to, even if another fails. Each failure is logged,
+// and the returned error combines them.
 func (u *UnifiPoller) ReportMetrics(metrics *Metrics) error {
 	// Batch (and send) all the points.
 	for _, err := range metrics.ProcessPoints() {
 		u.LogError(err, "asset.Points()")
 	}
-	err := u.Influx.Write(metrics.BatchPoints)
-	if err != nil {
-		return fmt.Errorf("influxdb.Write(points): %v", err)
-	}
+	err := u.writeMetrics(metrics, u.Outputs)
 	var fields, points int
 	for _, p := range metrics.Points() {
 		points++
@@ -164,10 +267,35 @@ func (u *UnifiPoller) ReportMetrics(metrics *Metrics) error {
 	if u.Config.CollectIDS {
 		idsMsg = fmt.Sprintf("IDS Events: %d, ", len(metrics.IDSList))
 	}
+	if u.Config.CollectRogueAPs {
+		idsMsg += fmt.Sprintf("Rogue APs: %d, ", len(metrics.RogueAPs))
+	}
 	u.Logf("UniFi Measurements Recorded. Sites: %d, Clients: %d, "+
 		"Wireless APs: %d, Gateways: %d, Switches: %d, %sPoints: %d, Fields: %d",
 		len(metrics.Sites), len(metrics.Clients), len(metrics.UAPs),
 		len(metrics.UDMs)+len(metrics.USGs), len(metrics.USWs), idsMsg, points, fields)
+	return err
+}
+
+// writeMetrics writes the batched points to InfluxDB and the provided outputs.
+// A failed destination does not stop the rest; each failure is logged.
+func (u *UnifiPoller) writeMetrics(metrics *Metrics, outputs []Output) error {
+	failed := []string{}
+	if u.Influx != nil {
+		if err := u.Influx.Write(metrics.BatchPoints); err != nil {
+			u.LogError(err, "influxdb.Write(points)")
+			failed = append(failed, fmt.Sprintf("influxdb: %v", err))
+		}
+	}
+	for _, o := range outputs {
+		if err := o.WriteMetrics(metrics); err != nil {
+			u.LogError(err, o.Name())
+			failed = append(failed, fmt.Sprintf("%s: %v", o.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d destination(s) failed: %s", len(failed), strings.Join(failed, "; "))
+	}
 	return nil
 }
 
@@ -203,6 +331,58 @@ func (m *Metrics) ProcessPoints() []error {
 		pts, err := IDSPoints(asset) // no m.TS.
 		processPoints(m, pts, err)
 	}
+	for _, asset := range m.RogueAPs {
+		pts, err := RogueAPPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.DeviceLinks {
+		pts, err := TopologyPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.PortMACs {
+		pts, err := USWPortMACPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.SFPModules {
+		pts, err := SFPPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	if m.Controller != nil {
+		pts, err := ControllerPoints(m.Controller, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.SiteConfigs {
+		pts, err := SiteConfigPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.Firewall {
+		pts, err := FirewallRulePoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.Forwards {
+		pts, err := PortForwardPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.Routes {
+		pts, err := RoutePoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.VPNTunnels {
+		pts, err := VPNTunnelPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.VPNUsers {
+		pts, err := RemoteUserPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.Hotspots {
+		pts, err := HotspotPoints(asset, m.TS)
+		processPoints(m, pts, err)
+	}
+	for _, asset := range m.Events {
+		pts, err := EventPoints(asset) // no m.TS.
+		processPoints(m, pts, err)
+	}
 
 	if m.Devices == nil {
 		return errs
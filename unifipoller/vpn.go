@@ -0,0 +1,200 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golift.io/unifi"
+)
+
+// API paths for the site's VPN networks and the connected remote users.
+const (
+	VPNNetworkPath    = "/api/s/%s/rest/networkconf"
+	RemoteUserVPNPath = "/api/s/%s/stat/remoteuservpn"
+)
+
+// VPNTunnel is a site-to-site VPN network, with the state and counters of its
+// tunnel interface on the gateway.
+type VPNTunnel struct {
+	SiteName   string         `json:"-"`
+	ID         string         `json:"_id"`
+	Name       string         `json:"name"`
+	Purpose    string         `json:"purpose"`
+	VPNType    string         `json:"vpn_type"`
+	Enabled    unifi.FlexBool `json:"enabled"`
+	Ifname     string         `json:"ifname"`
+	PeerIP     string         `json:"ipsec_peer_ip"`
+	OpenVPN    string         `json:"openvpn_remote_host"`
+	RemoteSite string         `json:"remote_site_id"`
+	Gateway    string         `json:"-"` // Name of the gateway with the tunnel interface, if found.
+	Found      bool           `json:"-"` // The gateway has the tunnel interface.
+	Iface      vpnInterface   `json:"-"`
+}
+
+// Peer returns the tunnel's remote address, or the remote site's ID for auto IPsec.
+func (t *VPNTunnel) Peer() string {
+	return firstString(t.PeerIP, t.OpenVPN, t.RemoteSite)
+}
+
+// State returns up, down, disabled or unknown. A tunnel without an interface on
+// the gateway, like a policy-based IPsec tunnel, has an unknown state.
+func (t *VPNTunnel) State() string {
+	switch {
+	case !t.Enabled.Val:
+		return "disabled"
+	case !t.Found:
+		return "unknown"
+	case t.Iface.Up.Val:
+		return "up"
+	default:
+		return "down"
+	}
+}
+
+// vpnInterface is an entry in a gateway's interface table.
+type vpnInterface struct {
+	Name      string         `json:"name"`
+	Up        unifi.FlexBool `json:"up"`
+	Uptime    unifi.FlexInt  `json:"uptime"`
+	RxBytes   unifi.FlexInt  `json:"rx_bytes"`
+	TxBytes   unifi.FlexInt  `json:"tx_bytes"`
+	RxPackets unifi.FlexInt  `json:"rx_packets"`
+	TxPackets unifi.FlexInt  `json:"tx_packets"`
+	RxErrors  unifi.FlexInt  `json:"rx_errors"`
+	TxErrors  unifi.FlexInt  `json:"tx_errors"`
+}
+
+// vpnGateway is the part of a USG or UDM we need to find tunnel interfaces.
+type vpnGateway struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	IfTable []*vpnInterface `json:"if_table"`
+}
+
+// RemoteUserSession is a remote user connected to the site's L2TP or OpenVPN server.
+type RemoteUserSession struct {
+	SiteName  string        `json:"-"`
+	ID        string        `json:"_id"`
+	Name      string        `json:"name"`
+	Network   string        `json:"network_name"`
+	Type      string        `json:"vpn_type"`
+	RemoteIP  string        `json:"remote_ip"`
+	IP        string        `json:"ip"`
+	Uptime    unifi.FlexInt `json:"uptime"`
+	RxBytes   unifi.FlexInt `json:"rx_bytes"`
+	TxBytes   unifi.FlexInt `json:"tx_bytes"`
+	RxPackets unifi.FlexInt `json:"rx_packets"`
+	TxPackets unifi.FlexInt `json:"tx_packets"`
+}
+
+// GetVPNTunnels returns the site-to-site VPN networks of the provided sites. Each
+// is matched to its interface on the site's gateway by name.
+func (u *UnifiPoller) GetVPNTunnels(sites unifi.Sites, devices SiteDevices, configs []*SiteConfigs) ([]*VPNTunnel, error) {
+	data := []*VPNTunnel{}
+	for _, site := range sites {
+		networks, err := u.getVPNNetworks(site, configs)
+		if err != nil {
+			return data, err
+		}
+		var gateways []*vpnGateway
+		if err := devices.decode(site, &gateways); err != nil {
+			return data, err
+		}
+		for _, t := range networks {
+			if t.Purpose != "site-vpn" {
+				continue
+			}
+			t.SiteName = site.SiteName
+			matchVPNInterface(t, gateways)
+			data = append(data, t)
+		}
+	}
+	return data, nil
+}
+
+// getVPNNetworks returns a site's networks. They are decoded from the site's
+// networkconf configuration when collect_config read it this poll, and read
+// from the controller when it did not.
+func (u *UnifiPoller) getVPNNetworks(site *unifi.Site, configs []*SiteConfigs) ([]*VPNTunnel, error) {
+	var networks []*VPNTunnel
+	for _, s := range configs {
+		if s.Site != site.Name || s.Kind != "networkconf" {
+			continue
+		}
+		b, err := json.Marshal(s.Items)
+		if err != nil {
+			return nil, err
+		}
+		return networks, json.Unmarshal(b, &networks)
+	}
+	return networks, u.getSiteData(VPNNetworkPath, site, &networks)
+}
+
+// matchVPNInterface finds a tunnel's interface on the site's gateways.
+func matchVPNInterface(t *VPNTunnel, devices []*vpnGateway) {
+	if t.Ifname == "" {
+		return
+	}
+	for _, d := range devices {
+		if d.Type != "ugw" && d.Type != "udm" {
+			continue
+		}
+		for _, i := range d.IfTable {
+			if strings.EqualFold(i.Name, t.Ifname) {
+				t.Gateway, t.Found, t.Iface = d.Name, true, *i
+				return
+			}
+		}
+	}
+}
+
+// GetRemoteUserSessions returns the remote user VPN sessions of the provided sites.
+func (u *UnifiPoller) GetRemoteUserSessions(sites unifi.Sites) ([]*RemoteUserSession, error) {
+	data := []*RemoteUserSession{}
+	for _, site := range sites {
+		var response []*RemoteUserSession
+		if err := u.getSiteData(RemoteUserVPNPath, site, &response); err != nil {
+			return data, err
+		}
+		for _, s := range response {
+			s.SiteName = site.SiteName
+		}
+		data = append(data, response...)
+	}
+	return data, nil
+}
+
+// vpnTunnelEvents returns a vpn_tunnel event for every tunnel that went up or down
+// since the last poll, and remembers each tunnel's state. Returns none on the first poll.
+// An unknown state is not a change; the tunnel keeps its last known state.
+func (u *UnifiPoller) vpnTunnelEvents(tunnels []*VPNTunnel) []*Event {
+	first := u.tunnels == nil
+	if first {
+		u.tunnels = make(map[string]string)
+	}
+	now := time.Now()
+	events := []*Event{}
+	for _, t := range tunnels {
+		key, state := t.SiteName+"/"+t.ID, t.State()
+		if state == "unknown" {
+			continue
+		}
+		old := u.tunnels[key]
+		if u.tunnels[key] = state; first || old == state {
+			continue
+		}
+		u.Logf("VPN tunnel %s to %s is %s (site: %s)", t.Name, t.Peer(), state, t.SiteName)
+		events = append(events, &Event{
+			Time:     now,
+			SiteName: t.SiteName,
+			Type:     "vpn_tunnel",
+			Subject:  t.Name,
+			Old:      old,
+			New:      state,
+			Message:  fmt.Sprintf("VPN tunnel %s to %s changed from %s to %s", t.Name, t.Peer(), firstString(old, "unknown"), state),
+		})
+	}
+	return events
+}
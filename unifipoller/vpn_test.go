@@ -0,0 +1,126 @@
+package unifipoller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golift.io/unifi"
+)
+
+// testVPNDevices is a site's device list: a switch, then a USG with one IPsec
+// tunnel interface up and one down.
+const testVPNDevices = `[
+	{"name": "Core", "type": "usw", "if_table": [{"name": "vti0", "up": true}]},
+	{"name": "Gateway", "type": "ugw", "if_table": [
+		{"name": "eth0", "up": true, "rx_bytes": 1},
+		{"name": "vti0", "up": true, "uptime": 3600, "rx_bytes": 1000, "tx_bytes": 2000, "rx_packets": 10, "tx_packets": 20},
+		{"name": "vti1", "up": false}]}
+]`
+
+// testVPNNetworks is the site's networkconf, as collect_config reads it.
+const testVPNNetworks = `[
+	{"_id": "1", "name": "LAN", "purpose": "corporate", "enabled": true},
+	{"_id": "2", "name": "To HQ", "purpose": "site-vpn", "vpn_type": "ipsec-vpn", "enabled": true,
+	 "ifname": "VTI0", "ipsec_peer_ip": "203.0.113.1"},
+	{"_id": "3", "name": "To Lab", "purpose": "site-vpn", "vpn_type": "ipsec-vpn", "enabled": true,
+	 "ifname": "vti1", "remote_site_id": "5e1"},
+	{"_id": "4", "name": "Unused", "purpose": "site-vpn", "vpn_type": "openvpn-vpn", "enabled": false,
+	 "openvpn_remote_host": "vpn.example.com"},
+	{"_id": "5", "name": "Pending", "purpose": "site-vpn", "vpn_type": "ipsec-vpn", "enabled": true}
+]`
+
+func TestGetVPNTunnels(t *testing.T) {
+	site := &unifi.Site{Name: "default", SiteName: "Default (default)"}
+	var items []SiteConfig
+	if err := json.Unmarshal([]byte(testVPNNetworks), &items); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	configs := []*SiteConfigs{{Site: "default", Kind: "networkconf", Items: items}}
+	devices := SiteDevices{"default": json.RawMessage(testVPNDevices)}
+	// The networks come from the collected configuration, so nothing is read.
+	tunnels, err := (&UnifiPoller{}).GetVPNTunnels(unifi.Sites{site}, devices, configs)
+	if err != nil {
+		t.Fatalf("GetVPNTunnels: %v", err)
+	}
+	tests := []struct {
+		name, peer, state, gateway string
+		found                      bool
+		rxBytes                    float64
+	}{
+		{"To HQ", "203.0.113.1", "up", "Gateway", true, 1000}, // Interface names match without case.
+		{"To Lab", "5e1", "down", "Gateway", true, 0},
+		{"Unused", "vpn.example.com", "disabled", "", false, 0},
+		{"Pending", "", "unknown", "", false, 0}, // No interface name, like a policy-based tunnel.
+	}
+	if len(tunnels) != len(tests) {
+		t.Fatalf("got %d tunnels, want %d; only site-vpn networks are tunnels", len(tunnels), len(tests))
+	}
+	for i, want := range tests {
+		got := tunnels[i]
+		if got.Name != want.name || got.Peer() != want.peer || got.State() != want.state || got.Gateway != want.gateway ||
+			got.Found != want.found || got.Iface.RxBytes.Val != want.rxBytes || got.SiteName != site.SiteName {
+			t.Errorf("tunnel %d = %s %s %s %s %v %v, want %+v", i, got.Name, got.Peer(), got.State(), got.Gateway,
+				got.Found, got.Iface.RxBytes.Val, want)
+		}
+	}
+	if tunnels[0].Iface.Uptime.Val != 3600 || tunnels[0].Iface.TxPackets.Val != 20 {
+		t.Errorf("wrong interface counters: %+v", tunnels[0].Iface)
+	}
+}
+
+func TestMatchVPNInterface(t *testing.T) {
+	var gateways []*vpnGateway
+	if err := json.Unmarshal([]byte(testVPNDevices), &gateways); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	// A UDM is a gateway too; the interface is found on the second gateway.
+	gateways = append([]*vpnGateway{{Name: "Old USG", Type: "ugw"}}, gateways...)
+	gateways[2].Type = "udm"
+	tunnel := &VPNTunnel{Name: "To HQ", Enabled: unifi.FlexBool{Val: true}, Ifname: "vti0"}
+	if matchVPNInterface(tunnel, gateways); !tunnel.Found || tunnel.Gateway != "Gateway" || tunnel.State() != "up" {
+		t.Errorf("wrong match: %+v", tunnel)
+	}
+	tunnel = &VPNTunnel{Name: "Gone", Enabled: unifi.FlexBool{Val: true}, Ifname: "vti9"}
+	if matchVPNInterface(tunnel, gateways); tunnel.Found || tunnel.Gateway != "" || tunnel.State() != "unknown" {
+		t.Errorf("a missing interface was found: %+v", tunnel)
+	}
+}
+
+func TestVPNTunnelEvents(t *testing.T) {
+	u := &UnifiPoller{Config: &Config{Quiet: true}}
+	tunnel := func(found, up bool) *VPNTunnel {
+		return &VPNTunnel{SiteName: "Default (default)", ID: "2", Name: "To HQ", Enabled: unifi.FlexBool{Val: true},
+			Found: found, Iface: vpnInterface{Up: unifi.FlexBool{Val: up}}}
+	}
+	for i, test := range []struct {
+		tunnel   *VPNTunnel
+		old, new string // The event's states; empty for no event.
+	}{
+		{tunnel(true, true), "", ""}, // First poll.
+		{tunnel(false, false), "", ""},
+		{tunnel(true, true), "", ""}, // Still up after an unknown state.
+		{tunnel(true, false), "up", "down"},
+		{tunnel(false, false), "", ""},
+		{tunnel(true, true), "down", "up"},
+	} {
+		events := u.vpnTunnelEvents([]*VPNTunnel{test.tunnel})
+		switch {
+		case test.new == "" && len(events) != 0:
+			t.Errorf("poll %d: unexpected event: %+v", i, events[0])
+		case test.new != "" && (len(events) != 1 || events[0].Old != test.old || events[0].New != test.new):
+			t.Errorf("poll %d: wrong events: %+v, want %s to %s", i, events, test.old, test.new)
+		}
+	}
+}
+
+func TestRemoteUserPoints(t *testing.T) {
+	s := &RemoteUserSession{SiteName: "Default (default)", ID: "5e2", Name: "alice", Type: "l2tp", RemoteIP: "198.51.100.7"}
+	points, err := RemoteUserPoints(s, testTime)
+	if err != nil {
+		t.Fatalf("RemoteUserPoints: %v", err)
+	}
+	// Two sessions of one user are separate series.
+	if tags := points[0].Tags(); tags["id"] != "5e2" || tags["name"] != "alice" {
+		t.Errorf("wrong tags: %v", tags)
+	}
+}